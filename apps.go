@@ -1,9 +1,84 @@
 package cast
 
+import "github.com/vkl/go-cast/controllers"
+
 const (
 	AppBackdrop     = "E8C28D3C"
 	AppMedia        = "CC1AD845"
 	AppURL          = "5CB45E5A"
 	AppYouTubeMusic = "2DB7CC49"
 	AppYouTube      = "233637DE"
+	AppDashCast     = "84912283"
 )
+
+// App describes a known receiver application.
+type App struct {
+	ID   string
+	Name string
+	// Namespaces the app exposes to senders, which pick the controllers
+	// attached to it.
+	Namespaces []string
+}
+
+// Apps is the catalogue of known receiver applications, by app ID.
+var Apps = map[string]App{
+	AppBackdrop: {
+		ID:   AppBackdrop,
+		Name: "Backdrop",
+	},
+	AppMedia: {
+		ID:         AppMedia,
+		Name:       "Default Media Receiver",
+		Namespaces: []string{controllers.NamespaceMedia},
+	},
+	AppURL: {
+		ID:         AppURL,
+		Name:       "URL Cast",
+		Namespaces: []string{controllers.NamespaceURL},
+	},
+	AppDashCast: {
+		ID:         AppDashCast,
+		Name:       "DashCast",
+		Namespaces: []string{controllers.NamespaceDashCast},
+	},
+	AppYouTube: {
+		ID:         AppYouTube,
+		Name:       "YouTube",
+		Namespaces: []string{controllers.NamespaceMedia, controllers.NamespaceYouTubeMdx},
+	},
+	AppYouTubeMusic: {
+		ID:         AppYouTubeMusic,
+		Name:       "YouTube Music",
+		Namespaces: []string{controllers.NamespaceMedia, controllers.NamespaceYouTubeMdx},
+	},
+}
+
+// LookupApp returns the catalogue entry of an app ID.
+func LookupApp(id string) (App, bool) {
+	app, ok := Apps[id]
+	return app, ok
+}
+
+// appNamespaces returns the namespaces a running session exposes, merged
+// with those the catalogue knows of.
+func appNamespaces(session *controllers.ApplicationSession) []string {
+	seen := map[string]bool{}
+	namespaces := make([]string, 0)
+	add := func(ns string) {
+		if !seen[ns] {
+			seen[ns] = true
+			namespaces = append(namespaces, ns)
+		}
+	}
+	if session.AppID != nil {
+		if app, ok := LookupApp(*session.AppID); ok {
+			for _, ns := range app.Namespaces {
+				add(ns)
+			}
+		}
+	}
+	for _, ns := range session.Namespaces {
+		add(ns.Name)
+	}
+	return namespaces
+}
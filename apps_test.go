@@ -0,0 +1,63 @@
+package cast
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+
+	"github.com/vkl/go-cast/controllers"
+	castnet "github.com/vkl/go-cast/net"
+)
+
+func TestAttachAppUsesCatalogue(t *testing.T) {
+	out := func(namespace, payload string) castnet.Record {
+		return castnet.Record{Direction: castnet.DirectionOutbound, SourceId: DefaultSender, DestinationId: DefaultReceiver, Namespace: namespace, Payload: payload}
+	}
+	in := func(namespace, payload string) castnet.Record {
+		return castnet.Record{Direction: castnet.DirectionInbound, SourceId: DefaultReceiver, DestinationId: DefaultSender, Namespace: namespace, Payload: payload}
+	}
+	receiver := "urn:x-cast:com.google.cast.receiver"
+	replay := castnet.NewReplay([]castnet.Record{
+		out(castnet.NamespaceConnection, `{"type":"CONNECT"}`),
+		out(receiver, `{"type":"GET_STATUS","requestId":1}`),
+		in(receiver, `{"type":"RECEIVER_STATUS","requestId":1,"status":{"applications":[`+
+			`{"appId":"233637DE","displayName":"YouTube","namespaces":[],"sessionId":"s1","statusText":"","transportId":"t1"}],`+
+			`"volume":{"level":0.5,"muted":false}}}`),
+		out(castnet.NamespaceConnection, `{"type":"CONNECT"}`),
+		out(receiver, `{"type":"GET_APP_AVAILABILITY","requestId":2,"appId":["233637DE","00000000"]}`),
+		in(receiver, `{"type":"GET_APP_AVAILABILITY","requestId":2,"availability":{"233637DE":"APP_AVAILABLE","00000000":"APP_UNAVAILABLE"}}`),
+		out("urn:x-cast:test", ``),
+	})
+
+	client := NewClientWithOptions(net.IPv4(127, 0, 0, 1), 8009, WithSenderID(DefaultSender))
+	assert.NoError(t, client.ConnectTransport(context.Background(), replay))
+	defer client.Close()
+
+	session, err := client.AttachApp(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, AppYouTube, *session.AppID)
+	assert.Equal(t, StateAppConnected, client.State())
+
+	media, err := client.Media(context.Background(), AppYouTube)
+	assert.NoError(t, err)
+	assert.Equal(t, "t1", media.DestinationID)
+	_, err = client.YouTubeMdx()
+	assert.NoError(t, err)
+
+	receiverCtrl, err := client.Receiver()
+	assert.NoError(t, err)
+	availability, err := receiverCtrl.GetAppAvailability(context.Background(), AppYouTube, "00000000")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]bool{AppYouTube: true, "00000000": false}, availability)
+}
+
+func TestLookupApp(t *testing.T) {
+	app, ok := LookupApp(AppMedia)
+	assert.True(t, ok)
+	assert.Equal(t, []string{controllers.NamespaceMedia}, app.Namespaces)
+
+	_, ok = LookupApp("00000000")
+	assert.False(t, ok)
+}
@@ -1,15 +1,16 @@
 package cast
 
 import (
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"net"
+	"sync"
 
 	"golang.org/x/net/context"
 
 	"github.com/vkl/go-cast/controllers"
 	"github.com/vkl/go-cast/events"
-	_ "github.com/vkl/go-cast/logger"
 	castnet "github.com/vkl/go-cast/net"
 )
 
@@ -21,6 +22,16 @@ type DisplayStatus struct {
 	Volume      float64 `json:"volume"`
 }
 
+// DeviceInfo describes a device as announced by discovery.
+type DeviceInfo struct {
+	Name   string `json:"name"`
+	UUID   string `json:"uuid"`
+	Model  string `json:"model"`
+	Host   string `json:"host"`
+	Port   int    `json:"port"`
+	Status string `json:"status"`
+}
+
 type Client struct {
 	name          string
 	info          map[string]string
@@ -35,28 +46,74 @@ type Client struct {
 	media         *controllers.MediaController
 	youtubemdx    *controllers.YouTubeMdxController
 	url           *controllers.URLController
+	dashcast      *controllers.DashCastController
+	sessionID     string
 	displayStatus DisplayStatus
-	isconnected   bool
+	mu            sync.Mutex
+	state         State
+	tap           castnet.Tap
+	options       ClientOptions
+	subscribers   map[chan events.Event]struct{}
 
 	Events chan events.Event
 }
 
+// DefaultSender is the well-known sender ID. Clients generate a unique
+// sender ID instead unless configured WithSenderID(DefaultSender).
 const DefaultSender = "sender-0"
 const DefaultReceiver = "receiver-0"
 const TransportSender = "Tr@n$p0rt-0"
 const TransportReceiver = "Tr@n$p0rt-0"
 
 func NewClient(host net.IP, port int) *Client {
+	return NewClientWithOptions(host, port)
+}
+
+// NewClientWithOptions creates a client configured by opts on top of
+// DefaultOptions.
+func NewClientWithOptions(host net.IP, port int, opts ...Option) *Client {
+	options := DefaultOptions()
+	for _, opt := range opts {
+		opt(&options)
+	}
+	options = options.withDefaults()
 	return &Client{
 		host:          host,
 		port:          port,
 		ctx:           context.Background(),
-		Events:        make(chan events.Event, 16),
+		Events:        make(chan events.Event, options.eventBuffer()),
 		displayStatus: DisplayStatus{},
-		isconnected:   false,
+		state:         StateDisconnected,
+		options:       options,
 	}
 }
 
+// Options returns the configuration of the client.
+func (c *Client) Options() ClientOptions {
+	return c.options
+}
+
+// SenderID returns the sender ID the client uses towards the device.
+func (c *Client) SenderID() string {
+	return c.options.SenderID
+}
+
+// SetLogger sets the logger used by the client and its connection. Records
+// are annotated with the device name.
+func (c *Client) SetLogger(logger *slog.Logger) {
+	c.options.Logger = logger
+}
+
+// SetMetrics sets where the client reports the measurements of its
+// connection. It takes effect on Connect.
+func (c *Client) SetMetrics(metrics castnet.Metrics) {
+	c.options.Metrics = metrics
+}
+
+func (c *Client) Logger() *slog.Logger {
+	return c.options.Logger.With("device", c.name)
+}
+
 func (c *Client) IP() net.IP {
 	return c.host
 }
@@ -93,6 +150,17 @@ func (c *Client) Status() string {
 	return c.info["rs"]
 }
 
+func (c *Client) DeviceInfo() DeviceInfo {
+	return DeviceInfo{
+		Name:   c.name,
+		UUID:   c.Uuid(),
+		Model:  c.Device(),
+		Host:   c.host.String(),
+		Port:   c.port,
+		Status: c.Status(),
+	}
+}
+
 func (c *Client) DisplayStatus() DisplayStatus {
 	return c.displayStatus
 }
@@ -102,41 +170,169 @@ func (c *Client) String() string {
 }
 
 func (c *Client) IsConnected() bool {
-	return c.isconnected
+	return c.State().connected()
+}
+
+// State returns the current connection state.
+func (c *Client) State() State {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.state
+}
+
+// setState moves the client to state to, failing with a StateError naming
+// op if the transition is not allowed. A StateChanged event is emitted.
+func (c *Client) setState(op string, to State) error {
+	c.mu.Lock()
+	from := c.state
+	if from == to {
+		c.mu.Unlock()
+		return nil
+	}
+	if !canTransition(from, to) {
+		c.mu.Unlock()
+		return &StateError{Op: op, State: from}
+	}
+	c.state = to
+	c.mu.Unlock()
+	c.stateChanged(from, to)
+	return nil
+}
+
+// beginClose moves the client to StateClosing. Only the caller that made
+// the transition gets true, and must shut the connection down.
+func (c *Client) beginClose(op string) (bool, error) {
+	c.mu.Lock()
+	from := c.state
+	if from == StateDisconnected || from == StateClosing {
+		c.mu.Unlock()
+		return false, nil
+	}
+	if !canTransition(from, StateClosing) {
+		c.mu.Unlock()
+		return false, &StateError{Op: op, State: from}
+	}
+	c.state = StateClosing
+	c.mu.Unlock()
+	c.stateChanged(from, StateClosing)
+	return true, nil
+}
+
+// stateChanged emits the StateChanged event of a transition.
+func (c *Client) stateChanged(from, to State) {
+	c.Logger().Debug("state changed", "from", from, "to", to)
+	select {
+	case c.Events <- events.StateChanged{From: from.String(), To: to.String()}:
+	default:
+		c.Logger().Warn("dropped event", "event", "StateChanged")
+	}
+}
+
+// requireConnected returns a StateError naming op unless the client is
+// connected.
+func (c *Client) requireConnected(op string) error {
+	state := c.State()
+	if !state.connected() {
+		return &StateError{Op: op, State: state}
+	}
+	return nil
+}
+
+// SetTap installs a tap on the connection to observe, or record with a
+// castnet.Recorder, all protocol traffic. It takes effect on Connect.
+func (c *Client) SetTap(tap castnet.Tap) {
+	c.tap = tap
+}
+
+// SetHeartbeatConfig sets the ping interval, the number of missed pongs
+// tolerated and the latency threshold. It takes effect on Connect.
+func (c *Client) SetHeartbeatConfig(config controllers.HeartbeatConfig) {
+	c.options.Heartbeat = config
+}
+
+// LinkStats returns the heartbeat round-trip statistics of the connection.
+func (c *Client) LinkStats() controllers.LinkStats {
+	if c.heartbeat == nil {
+		return controllers.LinkStats{}
+	}
+	return c.heartbeat.Stats()
 }
 
 func (c *Client) Connect(ctx context.Context) error {
+	return c.connect(ctx, func(ctx context.Context, conn *castnet.Connection) error {
+		return conn.Connect(ctx, c.host, c.port)
+	})
+}
 
-	log.Println("Connect client " + c.name)
+// ConnectTransport connects the client over an already established
+// transport, such as a castnet.Replay of a recorded session.
+func (c *Client) ConnectTransport(ctx context.Context, transport net.Conn) error {
+	return c.connect(ctx, func(ctx context.Context, conn *castnet.Connection) error {
+		return conn.ConnectTransport(ctx, transport)
+	})
+}
+
+func (c *Client) connect(ctx context.Context, dial func(context.Context, *castnet.Connection) error) error {
+	if err := c.options.Validate(); err != nil {
+		return err
+	}
+	if err := c.setState("connect", StateConnecting); err != nil {
+		return err
+	}
+	err := c.start(ctx, dial)
+	if err != nil {
+		if closing, _ := c.beginClose("connect"); closing {
+			c.shutdown()
+			c.setState("connect", StateDisconnected)
+		}
+		return err
+	}
+	return nil
+}
+
+func (c *Client) start(ctx context.Context, dial func(context.Context, *castnet.Connection) error) error {
+
+	c.Logger().Info("connecting client")
 
 	ctx, cancel := context.WithCancel(ctx)
 	c.cancel = cancel
 
 	c.conn = castnet.NewConnection()
-	err := c.conn.Connect(ctx, c.host, c.port)
+	c.conn.SetLogger(c.Logger())
+	c.conn.SetTap(c.tap)
+	c.conn.SetMetrics(c.options.Metrics)
+	c.conn.SetTLSConfig(c.options.TLSConfig)
+	c.conn.SetDialTimeout(c.options.DialTimeout)
+	err := dial(ctx, c.conn)
 	if err != nil {
 		return err
 	}
+	go c.watchConnection(ctx, c.conn)
 
 	// start connection
-	c.connection = controllers.NewConnectionController(c.conn, c.Events, DefaultSender, DefaultReceiver)
+	c.connection = controllers.NewConnectionController(c.conn, c.Events, c.options.SenderID, DefaultReceiver)
 	if err := c.connection.Start(ctx); err != nil {
 		return err
 	}
 
 	// start heartbeat
 	c.heartbeat = controllers.NewHeartbeatController(c.conn, c.Events, TransportSender, TransportReceiver)
+	if err := c.heartbeat.SetConfig(c.options.Heartbeat); err != nil {
+		return err
+	}
 	if err := c.heartbeat.Start(ctx); err != nil {
 		return err
 	}
 
 	// start receiver
-	c.receiver = controllers.NewReceiverController(c.conn, c.Events, DefaultSender, DefaultReceiver)
+	c.receiver = controllers.NewReceiverController(c.conn, c.Events, c.options.SenderID, DefaultReceiver)
 	if err := c.receiver.Start(ctx); err != nil {
 		return err
 	}
 
-	c.isconnected = true
+	if err := c.setState("connect", StateConnected); err != nil {
+		return err
+	}
 
 	c.Events <- events.Connected{}
 
@@ -146,93 +342,257 @@ func (c *Client) Connect(ctx context.Context) error {
 	return nil
 }
 
-func (c *Client) NewChannel(sourceId, destinationId, namespace string) *castnet.Channel {
-	return c.conn.NewChannel(sourceId, destinationId, namespace)
+// watchConnection reports an unexpected loss of the connection as a
+// Disconnected event carrying the underlying cause, unless the client is
+// shut down, cancelling ctx, first.
+func (c *Client) watchConnection(ctx context.Context, conn *castnet.Connection) {
+	<-conn.Done()
+	err := conn.Err()
+	if errors.Is(err, castnet.ErrConnectionClosed) {
+		return
+	}
+	select {
+	case c.Events <- events.Disconnected{Reason: err}:
+	case <-ctx.Done():
+	}
+}
+
+func (c *Client) NewChannel(sourceId, destinationId, namespace string) (*castnet.Channel, error) {
+	if err := c.requireConnected("open channel"); err != nil {
+		return nil, err
+	}
+	return c.conn.NewChannel(sourceId, destinationId, namespace), nil
 }
 
+// Close disconnects from the device. Closing a client that is not
+// connected does nothing.
 func (c *Client) Close() error {
+	closing, err := c.beginClose("close")
+	if !closing {
+		return err
+	}
+	err = c.shutdown()
+	c.setState("close", StateDisconnected)
+	return err
+}
+
+func (c *Client) shutdown() error {
 	var err error
-	c.cancel()
+	// close before cancelling, or the receive loop would end the
+	// connection without the CLOSE messages
 	if c.conn != nil {
 		err = c.conn.Close()
 		c.conn = nil
 	}
+	if c.cancel != nil {
+		c.cancel()
+		c.cancel = nil
+	}
 	c.media = nil
 	c.receiver = nil
 	c.youtubemdx = nil
 	c.url = nil
-	c.isconnected = false
+	c.dashcast = nil
+	c.sessionID = ""
 	return err
 }
 
-func (c *Client) Receiver() *controllers.ReceiverController {
-	return c.receiver
+func (c *Client) Receiver() (*controllers.ReceiverController, error) {
+	if err := c.requireConnected("use receiver"); err != nil {
+		return nil, err
+	}
+	return c.receiver, nil
 }
 
 func (c *Client) Media(ctx context.Context, appId string) (*controllers.MediaController, error) {
+	if err := c.requireConnected("use media"); err != nil {
+		return nil, err
+	}
 	if c.media != nil {
 		return c.media, nil
 	}
 
+	if err := c.launch(ctx, appId); err != nil {
+		return nil, err
+	}
+	if c.media == nil {
+		return nil, fmt.Errorf("app %s does not expose %s", appId, controllers.NamespaceMedia)
+	}
+	return c.media, nil
+}
+
+// URL returns the controller of the URL cast app, launching appId if it
+// isn't running.
+func (c *Client) URL(ctx context.Context, appId string) (*controllers.URLController, error) {
+	if err := c.requireConnected("use url"); err != nil {
+		return nil, err
+	}
+	if c.url != nil {
+		return c.url, nil
+	}
+
+	if err := c.launch(ctx, appId); err != nil {
+		return nil, err
+	}
+	if c.url == nil {
+		return nil, fmt.Errorf("app %s does not expose %s", appId, controllers.NamespaceURL)
+	}
+	return c.url, nil
+}
+
+// DashCast returns the controller of the DashCast receiver, launching it
+// if it isn't running.
+func (c *Client) DashCast(ctx context.Context) (*controllers.DashCastController, error) {
+	if err := c.requireConnected("use dashcast"); err != nil {
+		return nil, err
+	}
+	if c.dashcast != nil {
+		return c.dashcast, nil
+	}
+
+	if err := c.launch(ctx, AppDashCast); err != nil {
+		return nil, err
+	}
+	if c.dashcast == nil {
+		return nil, fmt.Errorf("app %s does not expose %s", AppDashCast, controllers.NamespaceDashCast)
+	}
+	return c.dashcast, nil
+}
+
+// AttachApp attaches to the application running on the device, ignoring
+// the idle screen, and sets up the controllers for the namespaces it
+// exposes. It returns nil if no application is running.
+func (c *Client) AttachApp(ctx context.Context) (*controllers.ApplicationSession, error) {
+	if err := c.requireConnected("attach app"); err != nil {
+		return nil, err
+	}
+
 	status, err := c.receiver.GetStatus(ctx)
 	if err != nil {
-		log.Println(err)
 		return nil, err
 	}
-	for _, app := range status.Applications {
-		if *app.AppID == appId {
-			media := controllers.NewMediaController(
-				c.conn,
-				c.Events,
-				DefaultSender,
-				*app.TransportId,
-			)
-			log.Println("Media", *app.TransportId)
-			c.media = media
-			goto CONN
+	for _, session := range status.Applications {
+		if session.AppID == nil || *session.AppID == AppBackdrop || session.TransportId == nil {
+			continue
 		}
+		if err := c.attach(ctx, session); err != nil {
+			return nil, err
+		}
+		if err := c.setState("attach app", StateAppConnected); err != nil {
+			return nil, err
+		}
+		return session, nil
 	}
+	return nil, nil
+}
 
-	status, err = c.receiver.LaunchApp(ctx, appId)
+// launch attaches to appId, launching it first if it isn't running.
+func (c *Client) launch(ctx context.Context, appId string) error {
+	previous := c.State()
+	status, err := c.receiver.GetStatus(ctx)
 	if err != nil {
-		log.Println(err)
-		return nil, err
+		c.Logger().Warn("failed to get receiver status", "error", err)
+		return err
 	}
-	for _, app := range status.Applications {
-		if *app.AppID == appId {
-			media := controllers.NewMediaController(
-				c.conn,
-				c.Events,
-				DefaultSender,
-				*app.TransportId,
-			)
-			log.Println("Media", *app.TransportId)
-			c.media = media
-			goto CONN
+
+	session := status.GetSessionByAppId(appId)
+	if session == nil {
+		if err := c.setState("launch app", StateAppLaunching); err != nil {
+			return err
+		}
+		status, err = c.receiver.LaunchApp(ctx, appId)
+		if err != nil {
+			c.Logger().Warn("failed to launch app", "appId", appId, "error", err)
+			c.setState("launch app", previous)
+			return err
+		}
+		session = status.GetSessionByAppId(appId)
+		if session == nil {
+			c.setState("launch app", previous)
+			return fmt.Errorf("app %s did not start", appId)
 		}
 	}
-CONN:
-	if appId == AppYouTubeMusic || appId == AppYouTube {
-		c.youtubemdx = controllers.NewAppTubeController(
-			c.conn,
-			c.Events,
-			DefaultSender,
-			c.media.DestinationID)
+
+	if err := c.attach(ctx, session); err != nil {
+		c.setState("connect app", previous)
+		return err
+	}
+	return c.setState("connect app", StateAppConnected)
+}
+
+// attach opens a virtual connection to a running application and creates
+// a controller for each namespace it exposes that the library supports.
+func (c *Client) attach(ctx context.Context, session *controllers.ApplicationSession) error {
+	transportId := *session.TransportId
+	if session.SessionID != nil {
+		c.sessionID = *session.SessionID
 	}
-	c.connection = controllers.NewConnectionController(
+	c.Logger().Debug("attaching app", "appId", *session.AppID, "transportId", transportId)
+
+	connection := controllers.NewConnectionController(
 		c.conn,
 		c.Events,
-		DefaultSender,
-		c.media.DestinationID)
-	if err := c.connection.Start(ctx); err != nil {
-		return nil, err
+		c.options.SenderID,
+		transportId)
+	if err := connection.Start(ctx); err != nil {
+		return err
+	}
+	c.connection = connection
+
+	for _, namespace := range appNamespaces(session) {
+		switch namespace {
+		case controllers.NamespaceMedia:
+			c.media = controllers.NewMediaController(c.conn, c.Events, c.options.SenderID, transportId)
+		case controllers.NamespaceYouTubeMdx:
+			c.youtubemdx = controllers.NewAppTubeController(c.conn, c.Events, c.options.SenderID, transportId)
+		case controllers.NamespaceURL:
+			c.url = controllers.NewURLController(c.conn, c.Events, c.options.SenderID, transportId)
+		case controllers.NamespaceDashCast:
+			c.dashcast = controllers.NewDashCastController(c.conn, c.Events, c.options.SenderID, transportId)
+		}
 	}
+	return nil
+}
 
-	return c.media, nil
+func (c *Client) YouTubeMdx() (*controllers.YouTubeMdxController, error) {
+	if state := c.State(); state != StateAppConnected || c.youtubemdx == nil {
+		return nil, &StateError{Op: "use YouTube MDX", State: state}
+	}
+	return c.youtubemdx, nil
 }
 
-func (c *Client) YouTubeMdx() *controllers.YouTubeMdxController {
-	return c.youtubemdx
+// Subscribe returns a channel receiving a copy of every event the client
+// handles, and a function to cancel the subscription. Events are dropped
+// for subscribers that fall behind by more than the event buffer.
+func (c *Client) Subscribe() (<-chan events.Event, func()) {
+	ch := make(chan events.Event, c.options.eventBuffer())
+	c.mu.Lock()
+	if c.subscribers == nil {
+		c.subscribers = map[chan events.Event]struct{}{}
+	}
+	c.subscribers[ch] = struct{}{}
+	c.mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			c.mu.Lock()
+			delete(c.subscribers, ch)
+			c.mu.Unlock()
+		})
+	}
+}
+
+func (c *Client) publish(event events.Event) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for ch := range c.subscribers {
+		select {
+		case ch <- event:
+		default:
+			c.Logger().Warn("dropped event for subscriber", "event", fmt.Sprintf("%T", event))
+		}
+	}
 }
 
 func (c *Client) Listen(ctx context.Context) {
@@ -240,39 +600,51 @@ func (c *Client) Listen(ctx context.Context) {
 	for {
 		select {
 		case <-ctx.Done():
-			log.Println("stop listening")
+			c.Logger().Debug("stop listening")
 			return
 		default:
 			event := <-c.Events
+			c.publish(event)
 			if value, ok := event.(events.StatusUpdated); ok {
-				log.Println("status", value)
+				c.Logger().Debug("status updated", "level", value.Level, "muted", value.Muted)
 				c.displayStatus.Volume = value.Level
 			}
 			if value, ok := event.(events.MediaStatusUpdated); ok {
-				log.Println("media status", value)
+				c.Logger().Debug("media status updated", "playerState", value.PlayerState)
 				c.displayStatus.MediaStatus = value.PlayerState
 				if value.MetaData != nil {
 					c.displayStatus.MediaData = *value.MetaData
 				}
 			}
 			if value, ok := event.(events.AppStarted); ok {
-				log.Println("app started", value)
+				c.Logger().Info("app started", "appId", value.AppID, "displayName", value.DisplayName)
 				c.displayStatus.Status = value.DisplayName
 			}
 			if value, ok := event.(events.AppStopped); ok {
-				log.Println("app stopped", value)
+				c.Logger().Info("app stopped", "appId", value.AppID, "sessionId", value.SessionID, "displayName", value.DisplayName)
+				if value.SessionID != "" && value.SessionID != c.sessionID {
+					// another sender's session, ours is unaffected
+					continue
+				}
+				c.sessionID = ""
 				c.media = nil
+				c.youtubemdx = nil
+				c.url = nil
+				c.dashcast = nil
+				if c.State() == StateAppConnected {
+					c.setState("stop app", StateConnected)
+				}
 			}
 			if value, ok := event.(events.Disconnected); ok {
-				log.Println("disconnected", value)
+				c.Logger().Info("disconnected", "reason", value.Reason)
 				c.Close()
 				return
 			}
-			if value, ok := event.(events.Connected); ok {
-				log.Println("connected", value)
+			if _, ok := event.(events.Connected); ok {
+				c.Logger().Info("connected")
 			}
-			if value, ok := event.(events.ChannelClosed); ok {
-				log.Println("channel closed", value)
+			if _, ok := event.(events.ChannelClosed); ok {
+				c.Logger().Debug("channel closed")
 			}
 		}
 	}
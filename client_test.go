@@ -0,0 +1,28 @@
+package cast
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/vkl/go-cast/events"
+)
+
+func TestSubscribe(t *testing.T) {
+	client := NewClientWithOptions(nil, 0, WithEventBuffer(1))
+	first, cancelFirst := client.Subscribe()
+	second, cancelSecond := client.Subscribe()
+	defer cancelSecond()
+
+	client.publish(events.Connected{})
+	assert.Equal(t, events.Connected{}, <-first)
+	assert.Equal(t, events.Connected{}, <-second)
+
+	cancelFirst()
+	cancelFirst()
+	client.publish(events.ChannelClosed{})
+	// the full buffer of a slow subscriber drops events
+	client.publish(events.ChannelClosed{})
+	assert.Len(t, first, 0)
+	assert.Len(t, second, 1)
+}
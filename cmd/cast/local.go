@@ -0,0 +1,177 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/urfave/cli"
+	"golang.org/x/net/context"
+
+	"github.com/vkl/go-cast"
+	"github.com/vkl/go-cast/events"
+	"github.com/vkl/go-cast/mediaserver"
+	"github.com/vkl/go-cast/playlist"
+	"github.com/vkl/go-cast/subtitle"
+)
+
+// isLocalPath reports whether arg names a local file or directory rather
+// than a URL.
+func isLocalPath(arg string) bool {
+	if strings.Contains(arg, "://") {
+		return false
+	}
+	_, err := os.Stat(arg)
+	return err == nil
+}
+
+// mediaPlayLocal serves a local file or directory and plays it as a
+// queue, until the queue finishes or the user interrupts.
+func mediaPlayLocal(c *cli.Context, path string) error {
+	tracks, err := mediaserver.Scan(path)
+	if err != nil {
+		return exitError(err)
+	}
+	if err := selectSubtitles(c, tracks); err != nil {
+		return err
+	}
+
+	ctx, cancel := signalContext()
+	defer cancel()
+	commandCtx, commandCancel := context.WithTimeout(ctx, timeout(c))
+	defer commandCancel()
+	client, err := connect(commandCtx, c)
+	if err != nil {
+		return exitError(err)
+	}
+	defer client.Close()
+
+	ip, err := mediaserver.LocalAddr(client.IP())
+	if err != nil {
+		return exitError(err)
+	}
+	server := mediaserver.New()
+	if err := server.Listen(net.JoinHostPort(ip.String(), "0")); err != nil {
+		return exitError(err)
+	}
+	defer server.Close()
+	server.SetSubtitleOffset(c.Duration("subtitle-offset"))
+	items, err := server.QueueItems(commandCtx, tracks, nil)
+	if err != nil {
+		return exitError(err)
+	}
+
+	eventsCh, unsubscribe := client.Subscribe()
+	defer unsubscribe()
+	media, err := client.Media(commandCtx, cast.AppMedia)
+	if err != nil {
+		return exitError(err)
+	}
+	if err := applyDefaultVolume(commandCtx, c, client); err != nil {
+		return exitError(err)
+	}
+	if err := playlist.LoadItems(commandCtx, media, items); err != nil {
+		return exitError(err)
+	}
+	fmt.Printf("Playing %d tracks from %s, press Ctrl-C to stop\n", len(items), path)
+
+	err = waitForPlayback(ctx, eventsCh, func(title string) {
+		fmt.Printf("Now playing: %s\n", title)
+	})
+	if ctx.Err() != nil {
+		// interrupted, the files are about to go away
+		stopCtx, stopCancel := context.WithTimeout(context.Background(), timeout(c))
+		defer stopCancel()
+		_, err = media.Stop(stopCtx)
+	}
+	return exitError(err)
+}
+
+// selectSubtitles applies the subtitle flags to the tracks found: the
+// --subtitles file comes first and is the one enabled.
+func selectSubtitles(c *cli.Context, tracks []mediaserver.Track) error {
+	if c.Bool("no-subtitles") {
+		for i := range tracks {
+			tracks[i].Subtitles = nil
+		}
+	}
+	path := c.String("subtitles")
+	if path == "" {
+		return nil
+	}
+	if len(tracks) != 1 {
+		return usageError("subtitles can only be added to a single file")
+	}
+	format, ok := subtitle.FormatOf(path)
+	if !ok {
+		return usageError("%s is not an SRT, SSA/ASS or WebVTT file", path)
+	}
+	if _, err := os.Stat(path); err != nil {
+		return exitError(err)
+	}
+	sidecar := subtitle.Sidecar{
+		Path:   path,
+		Format: format,
+		Name:   strings.TrimSuffix(filepath.Base(path), filepath.Ext(path)),
+	}
+	tracks[0].Subtitles = append([]subtitle.Sidecar{sidecar}, tracks[0].Subtitles...)
+	return nil
+}
+
+// waitForPlayback waits until the player goes idle once it has started,
+// calling playing with the title of each track as it starts.
+func waitForPlayback(ctx context.Context, eventsCh <-chan events.Event, playing func(string)) error {
+	var tracker playbackTracker
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case event := <-eventsCh:
+			done, title, err := tracker.update(event)
+			if title != "" {
+				playing(title)
+			}
+			if done {
+				return err
+			}
+		}
+	}
+}
+
+// playbackTracker follows media status events to tell when a queue has
+// finished playing.
+type playbackTracker struct {
+	started bool
+	title   string
+}
+
+// update returns whether playback is over, and with which error, and the
+// title of a track that has just started.
+func (p *playbackTracker) update(event events.Event) (done bool, title string, err error) {
+	switch e := event.(type) {
+	case events.MediaStatusUpdated:
+		switch e.PlayerState {
+		case "PLAYING", "BUFFERING", "PAUSED":
+			p.started = true
+			if e.MetaData != nil && *e.MetaData != p.title {
+				p.title = *e.MetaData
+				title = p.title
+			}
+		case "IDLE":
+			if !p.started || e.IdleReason == "" {
+				return false, "", nil
+			}
+			if e.IdleReason == "ERROR" {
+				return true, "", fmt.Errorf("playback failed")
+			}
+			return true, "", nil
+		}
+	case events.AppStopped:
+		return p.started, "", nil
+	case events.Disconnected:
+		return true, "", fmt.Errorf("disconnected: %v", e.Reason)
+	}
+	return false, title, nil
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/urfave/cli"
+
+	"github.com/vkl/go-cast/events"
+	"github.com/vkl/go-cast/mediaserver"
+	"github.com/vkl/go-cast/subtitle"
+)
+
+func TestPlaybackTracker(t *testing.T) {
+	first, second := "Band : One", "Band : Two"
+	var tracker playbackTracker
+
+	// the idle status from before the queue was loaded
+	done, title, err := tracker.update(events.MediaStatusUpdated{PlayerState: "IDLE", IdleReason: "CANCELLED"})
+	assert.False(t, done)
+
+	done, title, _ = tracker.update(events.MediaStatusUpdated{PlayerState: "BUFFERING", MetaData: &first})
+	assert.False(t, done)
+	assert.Equal(t, first, title)
+	_, title, _ = tracker.update(events.MediaStatusUpdated{PlayerState: "PLAYING", MetaData: &first})
+	assert.Equal(t, "", title)
+	_, title, _ = tracker.update(events.MediaStatusUpdated{PlayerState: "PLAYING", MetaData: &second})
+	assert.Equal(t, second, title)
+
+	done, _, err = tracker.update(events.MediaStatusUpdated{PlayerState: "IDLE", IdleReason: "FINISHED"})
+	assert.True(t, done)
+	assert.NoError(t, err)
+
+	done, _, err = tracker.update(events.MediaStatusUpdated{PlayerState: "IDLE", IdleReason: "ERROR"})
+	assert.True(t, done)
+	assert.Error(t, err)
+
+	done, _, err = (&playbackTracker{}).update(events.Disconnected{Reason: errors.New("EOF")})
+	assert.True(t, done)
+	assert.Error(t, err)
+}
+
+func TestIsLocalPath(t *testing.T) {
+	assert.True(t, isLocalPath(t.TempDir()))
+	assert.False(t, isLocalPath("http://host/song.mp3"))
+	assert.False(t, isLocalPath("./does-not-exist.mp3"))
+	assert.False(t, isLocalPath(""))
+}
+
+func TestSelectSubtitles(t *testing.T) {
+	dir := t.TempDir()
+	explicit := filepath.Join(dir, "other.srt")
+	assert.NoError(t, os.WriteFile(explicit, nil, 0644))
+	sidecar := subtitle.Sidecar{Path: filepath.Join(dir, "movie.en.srt"), Format: subtitle.FormatSRT}
+
+	context := func(args ...string) *cli.Context {
+		set := flag.NewFlagSet("play", flag.ContinueOnError)
+		set.String("subtitles", "", "")
+		set.Bool("no-subtitles", false, "")
+		assert.NoError(t, set.Parse(args))
+		return cli.NewContext(nil, set, nil)
+	}
+
+	tracks := []mediaserver.Track{{Subtitles: []subtitle.Sidecar{sidecar}}}
+	assert.NoError(t, selectSubtitles(context("--subtitles", explicit), tracks))
+	assert.Equal(t, []string{explicit, sidecar.Path},
+		[]string{tracks[0].Subtitles[0].Path, tracks[0].Subtitles[1].Path})
+	assert.Equal(t, "other", tracks[0].Subtitles[0].Name)
+
+	assert.NoError(t, selectSubtitles(context("--no-subtitles"), tracks))
+	assert.Empty(t, tracks[0].Subtitles)
+
+	err := selectSubtitles(context("--subtitles", explicit), make([]mediaserver.Track, 2))
+	assert.Equal(t, exitUsage, exitCode(err))
+	err = selectSubtitles(context("--subtitles", filepath.Join(dir, "notes.txt")), tracks)
+	assert.Equal(t, exitUsage, exitCode(err))
+}
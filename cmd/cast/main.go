@@ -0,0 +1,593 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"os/signal"
+	"strconv"
+	"time"
+
+	"github.com/urfave/cli"
+	"golang.org/x/net/context"
+
+	"github.com/vkl/go-cast"
+	"github.com/vkl/go-cast/controllers"
+	"github.com/vkl/go-cast/discovery"
+	"github.com/vkl/go-cast/logger"
+	"github.com/vkl/go-cast/mqttbridge"
+)
+
+func main() {
+	app := cli.NewApp()
+	app.Name = "cast"
+	app.Usage = "Command line tool for the Chromecast"
+	app.Version = cast.Version
+	app.Flags = []cli.Flag{
+		cli.BoolFlag{
+			Name:  "debug, d",
+			Usage: "enable debug logging",
+		},
+		cli.StringFlag{
+			Name:  "host",
+			Usage: "chromecast hostname or IP",
+		},
+		cli.IntFlag{
+			Name:  "port",
+			Usage: "chromecast port",
+			Value: 8009,
+		},
+		cli.StringFlag{
+			Name:  "name",
+			Usage: "chromecast name, uuid or configured alias",
+		},
+		cli.DurationFlag{
+			Name:  "timeout",
+			Usage: "timeout for discovery and commands",
+			Value: 15 * time.Second,
+		},
+		cli.StringFlag{
+			Name:  "config",
+			Usage: "configuration file, by default $XDG_CONFIG_HOME/go-cast/config.yaml",
+		},
+		cli.StringFlag{
+			Name:  "output, o",
+			Usage: "output format: text, json or yaml",
+			Value: outputText,
+		},
+	}
+	app.Before = loadSettings
+	app.Commands = []cli.Command{
+		{
+			Name:   "discover",
+			Usage:  "discover chromecast devices",
+			Action: discoverCommand,
+		},
+		{
+			Name:   "status",
+			Usage:  "show the device status",
+			Action: statusCommand,
+		},
+		{
+			Name:  "media",
+			Usage: "media commands",
+			Subcommands: []cli.Command{
+				{
+					Name:      "play",
+					Usage:     "play a media url, a local file or directory, or resume playback",
+					ArgsUsage: "[url|path [content type]]",
+					Action:    mediaPlayCommand,
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:  "subtitles",
+							Usage: "SRT, SSA/ASS or WebVTT subtitles for a local video",
+						},
+						cli.DurationFlag{
+							Name:  "subtitle-offset",
+							Usage: "shift subtitles by this duration, such as -1.5s to show them earlier",
+						},
+						cli.BoolFlag{
+							Name:  "no-subtitles",
+							Usage: "don't load the subtitle files found next to a local video",
+						},
+					},
+				},
+				{
+					Name:   "status",
+					Usage:  "show the media status",
+					Action: mediaStatusCommand,
+				},
+				{
+					Name:   "pause",
+					Usage:  "pause playback",
+					Action: mediaPauseCommand,
+				},
+				{
+					Name:   "stop",
+					Usage:  "stop playback",
+					Action: mediaStopCommand,
+				},
+			},
+		},
+		{
+			Name:      "volume",
+			Usage:     "show or set the volume",
+			ArgsUsage: "[level 0-1]",
+			Action:    volumeCommand,
+		},
+		{
+			Name:   "quit",
+			Usage:  "close the current app",
+			Action: quitCommand,
+			Flags: []cli.Flag{
+				cli.BoolFlag{
+					Name:  "force",
+					Usage: "close the app even if another sender launched it",
+				},
+			},
+		},
+		{
+			Name:   "remote",
+			Usage:  "control devices interactively from the keyboard",
+			Action: remoteCommand,
+		},
+		{
+			Name:   "watch",
+			Usage:  "show the live status of the device until interrupted",
+			Action: watchCommand,
+		},
+		{
+			Name:   "serve",
+			Usage:  "control the devices on the network through an HTTP JSON API or MQTT",
+			Action: serveCommand,
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "listen",
+					Value: "127.0.0.1:8080",
+					Usage: "address to serve the API on, empty to serve none",
+				},
+				cli.StringFlag{
+					Name:  "mqtt-broker",
+					Usage: "MQTT broker to bridge the devices to, such as tcp://localhost:1883",
+				},
+				cli.StringFlag{
+					Name:  "mqtt-prefix",
+					Value: mqttbridge.DefaultPrefix,
+					Usage: "topic prefix of the devices",
+				},
+				cli.StringFlag{
+					Name:  "mqtt-client-id",
+					Value: "go-cast",
+					Usage: "MQTT client ID",
+				},
+				cli.StringFlag{
+					Name:   "mqtt-username",
+					EnvVar: "CAST_MQTT_USERNAME",
+				},
+				cli.StringFlag{
+					Name:   "mqtt-password",
+					EnvVar: "CAST_MQTT_PASSWORD",
+				},
+				cli.DurationFlag{
+					Name:  "discovery-interval",
+					Value: time.Minute,
+					Usage: "how often to look for devices",
+				},
+				cli.BoolTFlag{
+					Name:  "keep-connected",
+					Usage: "stay connected to every device to stream its events, use --keep-connected=false to connect on demand",
+				},
+			},
+		},
+	}
+	app.Run(os.Args)
+}
+
+// signalContext returns a context cancelled on Ctrl-C.
+func signalContext() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt)
+	go func() {
+		select {
+		case <-signals:
+			cancel()
+		case <-ctx.Done():
+		}
+		signal.Stop(signals)
+	}()
+	return ctx, cancel
+}
+
+// commandContext returns a context bounded by --timeout and Ctrl-C.
+func commandContext(c *cli.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := signalContext()
+	ctx, timeoutCancel := context.WithTimeout(ctx, timeout(c))
+	return ctx, func() {
+		timeoutCancel()
+		cancel()
+	}
+}
+
+func clientOptions(c *cli.Context) []cast.Option {
+	opts := []cast.Option{cast.WithDialTimeout(timeout(c))}
+	opts = append(opts, settings.ClientOptions()...)
+	// an explicit --timeout wins over the configured dial_timeout
+	if c.GlobalIsSet("timeout") {
+		opts = append(opts, cast.WithDialTimeout(c.GlobalDuration("timeout")))
+	}
+	if c.GlobalBool("debug") {
+		logger.Level.Set(slog.LevelDebug)
+		opts = append(opts, cast.WithLogger(logger.New(os.Stderr)))
+	}
+	return opts
+}
+
+// findClient returns a client for the device given by --host or --name,
+// or the configured default device. Devices without a host are found by
+// discovery.
+func findClient(ctx context.Context, c *cli.Context) (*cast.Client, error) {
+	device, ok := targetDevice(c)
+	if !ok {
+		return nil, usageError("either --host or --name is required, or a default device configured")
+	}
+	if device.Host != "" {
+		ips, err := net.LookupIP(device.Host)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve %s: %s", device.Host, err)
+		}
+		client := cast.NewClientWithOptions(ips[0], device.Port, clientOptions(c)...)
+		client.SetName(device.Host)
+		if device.Name != "" {
+			client.SetName(device.Name)
+		}
+		return client, nil
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	service := discovery.NewService(ctx)
+	service.SetClientOptions(clientOptions(c)...)
+	go service.Run(ctx, 2*time.Second)
+	for {
+		select {
+		case client := <-service.Found():
+			if device.Matches(client.Name(), client.Uuid()) {
+				return client, nil
+			}
+		case <-ctx.Done():
+			name := device.Name
+			if name == "" {
+				name = device.UUID
+			}
+			return nil, &notFoundError{name}
+		}
+	}
+}
+
+func connect(ctx context.Context, c *cli.Context) (*cast.Client, error) {
+	client, err := findClient(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+	// the connection outlives ctx, the dial is bounded by --timeout
+	if err := client.Connect(context.Background()); err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %w", client, err)
+	}
+	return client, nil
+}
+
+// attachMedia attaches to the running app and returns its media
+// controller, or nil if no app with a media namespace is running.
+func attachMedia(ctx context.Context, client *cast.Client) (*controllers.MediaController, error) {
+	session, err := client.AttachApp(ctx)
+	if err != nil || session == nil {
+		return nil, err
+	}
+	if !hasNamespace(session, controllers.NamespaceMedia) {
+		return nil, nil
+	}
+	return client.Media(ctx, *session.AppID)
+}
+
+func discoverCommand(c *cli.Context) error {
+	if _, err := outputFormat(c); err != nil {
+		return err
+	}
+	ctx, cancel := commandContext(c)
+	defer cancel()
+
+	service := discovery.NewService(ctx)
+	go service.Run(ctx, timeout(c))
+	devices := []cast.DeviceInfo{}
+	seen := map[string]bool{}
+	for {
+		select {
+		case client := <-service.Found():
+			if seen[client.Uuid()] {
+				continue
+			}
+			seen[client.Uuid()] = true
+			devices = append(devices, client.DeviceInfo())
+			if c.GlobalString("output") == outputText {
+				fmt.Printf("Found: %s:%d '%s' (%s) %s\n",
+					client.IP(), client.Port(), client.Name(), client.Device(), client.Status())
+			}
+		case <-ctx.Done():
+			return printOutput(c, devices, func() {})
+		}
+	}
+}
+
+// statusOutput is the schema of the status command's output.
+type statusOutput struct {
+	Device   cast.DeviceInfo             `json:"device"`
+	Receiver *controllers.ReceiverStatus `json:"receiver"`
+	Media    []*controllers.MediaStatus  `json:"media"`
+}
+
+func statusCommand(c *cli.Context) error {
+	if _, err := outputFormat(c); err != nil {
+		return err
+	}
+	ctx, cancel := commandContext(c)
+	defer cancel()
+	client, err := connect(ctx, c)
+	if err != nil {
+		return exitError(err)
+	}
+	defer client.Close()
+
+	receiver, err := client.Receiver()
+	if err != nil {
+		return exitError(err)
+	}
+	status, err := receiver.GetStatus(ctx)
+	if err != nil {
+		return exitError(err)
+	}
+	media, err := mediaStatus(ctx, client)
+	if err != nil {
+		return exitError(err)
+	}
+
+	output := statusOutput{Device: client.DeviceInfo(), Receiver: status, Media: media}
+	return printOutput(c, output, func() {
+		printVolume(status.Volume)
+		if len(status.Applications) == 0 {
+			fmt.Println("No application running")
+		}
+		for _, app := range status.Applications {
+			fmt.Printf("[%s] %s\n", stringValue(app.DisplayName), stringValue(app.StatusText))
+		}
+		printMediaStatus(media)
+	})
+}
+
+// mediaStatus returns the media status of the running app, empty if it
+// has no media session.
+func mediaStatus(ctx context.Context, client *cast.Client) ([]*controllers.MediaStatus, error) {
+	media, err := attachMedia(ctx, client)
+	if err != nil || media == nil {
+		return []*controllers.MediaStatus{}, err
+	}
+	response, err := media.GetStatus(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if response.Status == nil {
+		return []*controllers.MediaStatus{}, nil
+	}
+	return response.Status, nil
+}
+
+func printVolume(volume *controllers.Volume) {
+	if volume == nil || volume.Level == nil {
+		return
+	}
+	fmt.Printf("Volume: %.2f", *volume.Level)
+	if volume.Muted != nil && *volume.Muted {
+		fmt.Print(" (muted)")
+	}
+	fmt.Println()
+}
+
+func printMediaStatus(statuses []*controllers.MediaStatus) {
+	for _, s := range statuses {
+		fmt.Printf("Media: %s %s / %s\n", s.PlayerState,
+			formatDuration(s.CurrentTime), formatDuration(mediaDuration(s)))
+		if s.Media != nil {
+			fmt.Printf("  %s\n", s.Media.ContentId)
+		}
+	}
+}
+
+func mediaStatusCommand(c *cli.Context) error {
+	if _, err := outputFormat(c); err != nil {
+		return err
+	}
+	ctx, cancel := commandContext(c)
+	defer cancel()
+	client, err := connect(ctx, c)
+	if err != nil {
+		return exitError(err)
+	}
+	defer client.Close()
+
+	media, err := mediaStatus(ctx, client)
+	if err != nil {
+		return exitError(err)
+	}
+	return printOutput(c, media, func() {
+		if len(media) == 0 {
+			fmt.Println("No media is playing")
+		}
+		printMediaStatus(media)
+	})
+}
+
+func mediaPlayCommand(c *cli.Context) error {
+	if path := c.Args().First(); isLocalPath(path) {
+		return mediaPlayLocal(c, path)
+	}
+	if c.String("subtitles") != "" {
+		return usageError("subtitles can only be added to local files")
+	}
+	ctx, cancel := commandContext(c)
+	defer cancel()
+	client, err := connect(ctx, c)
+	if err != nil {
+		return exitError(err)
+	}
+	defer client.Close()
+
+	if !c.Args().Present() {
+		media, err := attachMedia(ctx, client)
+		if err != nil {
+			return exitError(err)
+		}
+		if media == nil {
+			return exitError(fmt.Errorf("no media is playing"))
+		}
+		if _, err := media.GetStatus(ctx); err != nil {
+			return exitError(err)
+		}
+		_, err = media.Play(ctx)
+		return exitError(err)
+	}
+
+	media, err := client.Media(ctx, cast.AppMedia)
+	if err != nil {
+		return exitError(err)
+	}
+	if err := applyDefaultVolume(ctx, c, client); err != nil {
+		return exitError(err)
+	}
+	url := c.Args().Get(0)
+	if contentType := c.Args().Get(1); contentType != "" {
+		item := controllers.MediaItem{
+			ContentId:   url,
+			StreamType:  controllers.StreamTypeBuffered,
+			ContentType: contentType,
+		}
+		_, err = media.LoadMedia(ctx, item, 0, true, map[string]interface{}{})
+	} else {
+		_, err = media.LoadMediaURL(ctx, url, nil)
+	}
+	return exitError(err)
+}
+
+func mediaPauseCommand(c *cli.Context) error {
+	return mediaCommand(c, func(ctx context.Context, media *controllers.MediaController) error {
+		_, err := media.Pause(ctx)
+		return err
+	})
+}
+
+func mediaStopCommand(c *cli.Context) error {
+	return mediaCommand(c, func(ctx context.Context, media *controllers.MediaController) error {
+		_, err := media.Stop(ctx)
+		return err
+	})
+}
+
+// mediaCommand runs fn against the media session of the running app.
+func mediaCommand(c *cli.Context, fn func(context.Context, *controllers.MediaController) error) error {
+	ctx, cancel := commandContext(c)
+	defer cancel()
+	client, err := connect(ctx, c)
+	if err != nil {
+		return exitError(err)
+	}
+	defer client.Close()
+
+	media, err := attachMedia(ctx, client)
+	if err != nil {
+		return exitError(err)
+	}
+	if media == nil {
+		return exitError(fmt.Errorf("no media is playing"))
+	}
+	// pick up the media session id
+	if _, err := media.GetStatus(ctx); err != nil {
+		return exitError(err)
+	}
+	return exitError(fn(ctx, media))
+}
+
+func volumeCommand(c *cli.Context) error {
+	if _, err := outputFormat(c); err != nil {
+		return err
+	}
+	var level float64
+	if c.Args().Present() {
+		var err error
+		level, err = strconv.ParseFloat(c.Args().First(), 64)
+		if err != nil || level < 0 || level > 1 {
+			return usageError("volume must be a number between 0 and 1")
+		}
+	}
+
+	ctx, cancel := commandContext(c)
+	defer cancel()
+	client, err := connect(ctx, c)
+	if err != nil {
+		return exitError(err)
+	}
+	defer client.Close()
+
+	receiver, err := client.Receiver()
+	if err != nil {
+		return exitError(err)
+	}
+	if c.Args().Present() {
+		if _, err := receiver.SetVolumeLevel(ctx, level); err != nil {
+			return exitError(err)
+		}
+	}
+	volume, err := receiver.GetVolume(ctx)
+	if err != nil {
+		return exitError(err)
+	}
+	return printOutput(c, volume, func() {
+		printVolume(volume)
+	})
+}
+
+func quitCommand(c *cli.Context) error {
+	ctx, cancel := commandContext(c)
+	defer cancel()
+	client, err := connect(ctx, c)
+	if err != nil {
+		return exitError(err)
+	}
+	defer client.Close()
+
+	receiver, err := client.Receiver()
+	if err != nil {
+		return exitError(err)
+	}
+	_, err = receiver.StopApp(ctx, c.Bool("force"))
+	if errors.Is(err, controllers.ErrNotOwnSession) {
+		err = fmt.Errorf("%w, give --force to close it anyway", err)
+	}
+	return exitError(err)
+}
+
+func hasNamespace(session *controllers.ApplicationSession, namespace string) bool {
+	for _, ns := range session.Namespaces {
+		if ns.Name == namespace {
+			return true
+		}
+	}
+	return false
+}
+
+func stringValue(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
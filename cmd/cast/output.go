@@ -0,0 +1,152 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"syscall"
+
+	"github.com/urfave/cli"
+	"golang.org/x/net/context"
+	"gopkg.in/yaml.v3"
+
+	"github.com/vkl/go-cast"
+	"github.com/vkl/go-cast/controllers"
+	castnet "github.com/vkl/go-cast/net"
+)
+
+// Output formats of the --output flag.
+const (
+	outputText = "text"
+	outputJSON = "json"
+	outputYAML = "yaml"
+)
+
+// Exit codes, by cause of the failure.
+const (
+	exitFailure      = 1
+	exitUsage        = 2
+	exitUnreachable  = 3
+	exitTimeout      = 4
+	exitUnsupported  = 5
+	exitRejected     = 6
+	exitDisconnected = 7
+)
+
+// notFoundError is returned when discovery doesn't find the device.
+type notFoundError struct {
+	name string
+}
+
+func (e *notFoundError) Error() string {
+	return fmt.Sprintf("device %q not found", e.name)
+}
+
+// exitCode maps err to the exit code of its cause.
+func exitCode(err error) int {
+	var (
+		exit        cli.ExitCoder
+		notFound    *notFoundError
+		opError     *net.OpError
+		unsupported *controllers.UnsupportedCommandError
+		format      *controllers.UnsupportedFormatError
+		state       *cast.StateError
+		response    *controllers.ResponseError
+		netError    net.Error
+	)
+	switch {
+	case errors.As(err, &exit):
+		return exit.ExitCode()
+	case errors.Is(err, context.DeadlineExceeded),
+		errors.As(err, &netError) && netError.Timeout():
+		return exitTimeout
+	case errors.Is(err, castnet.ErrConnectionClosed),
+		errors.Is(err, io.EOF),
+		errors.Is(err, syscall.ECONNRESET):
+		return exitDisconnected
+	case errors.As(err, &notFound), errors.As(err, &opError):
+		return exitUnreachable
+	case errors.As(err, &unsupported),
+		errors.As(err, &format),
+		errors.Is(err, controllers.ErrVolumeFixed),
+		errors.As(err, &state):
+		return exitUnsupported
+	case errors.As(err, &response):
+		return exitRejected
+	}
+	return exitFailure
+}
+
+func exitError(err error) error {
+	if err == nil {
+		return nil
+	}
+	return cli.NewExitError(err.Error(), exitCode(err))
+}
+
+func usageError(format string, args ...interface{}) error {
+	return cli.NewExitError(fmt.Sprintf(format, args...), exitUsage)
+}
+
+// outputFormat returns the validated --output format.
+func outputFormat(c *cli.Context) (string, error) {
+	switch format := c.GlobalString("output"); format {
+	case "", outputText:
+		return outputText, nil
+	case outputJSON, outputYAML:
+		return format, nil
+	default:
+		return "", usageError("unknown output format %q, use text, json or yaml", format)
+	}
+}
+
+// printOutput prints v in the --output format, calling text to print it
+// for humans.
+func printOutput(c *cli.Context, v interface{}, text func()) error {
+	format, err := outputFormat(c)
+	if err != nil {
+		return err
+	}
+	if format == outputText {
+		text()
+		return nil
+	}
+	return exitError(encodeOutput(os.Stdout, format, v))
+}
+
+func encodeOutput(w io.Writer, format string, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	if format == outputYAML {
+		if data, err = jsonToYAML(data); err != nil {
+			return err
+		}
+	} else {
+		data = append(data, '\n')
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+// jsonToYAML converts JSON to block style YAML, keeping the JSON field
+// names and their order so both formats share the same schema.
+func jsonToYAML(data []byte) ([]byte, error) {
+	var node yaml.Node
+	if err := yaml.Unmarshal(data, &node); err != nil {
+		return nil, err
+	}
+	var clearStyle func(*yaml.Node)
+	clearStyle = func(n *yaml.Node) {
+		n.Style = 0
+		for _, child := range n.Content {
+			clearStyle(child)
+		}
+	}
+	clearStyle(&node)
+	return yaml.Marshal(&node)
+}
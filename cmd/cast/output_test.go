@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+
+	"github.com/vkl/go-cast"
+	"github.com/vkl/go-cast/controllers"
+	castnet "github.com/vkl/go-cast/net"
+)
+
+func TestEncodeOutput(t *testing.T) {
+	level, muted := 0.5, false
+	output := statusOutput{
+		Device:   cast.DeviceInfo{Name: "Hifi", UUID: "0123", Port: 8009},
+		Receiver: &controllers.ReceiverStatus{Volume: &controllers.Volume{Level: &level, Muted: &muted}},
+		Media:    []*controllers.MediaStatus{},
+	}
+
+	out := &bytes.Buffer{}
+	assert.NoError(t, encodeOutput(out, outputYAML, output))
+	assert.Equal(t, `device:
+    name: Hifi
+    uuid: "0123"
+    model: ""
+    host: ""
+    port: 8009
+    status: ""
+receiver:
+    type: ""
+    applications: null
+    volume:
+        level: 0.5
+        muted: false
+media: []
+`, out.String())
+
+	out.Reset()
+	assert.NoError(t, encodeOutput(out, outputJSON, output.Device))
+	assert.Equal(t, `{
+  "name": "Hifi",
+  "uuid": "0123",
+  "model": "",
+  "host": "",
+  "port": 8009,
+  "status": ""
+}
+`, out.String())
+}
+
+func TestExitCode(t *testing.T) {
+	assert.Equal(t, exitTimeout, exitCode(fmt.Errorf("failed to send play command: %w", context.DeadlineExceeded)))
+	assert.Equal(t, exitDisconnected, exitCode(fmt.Errorf("failed to read packet: %w", io.EOF)))
+	assert.Equal(t, exitDisconnected, exitCode(castnet.ErrConnectionClosed))
+	assert.Equal(t, exitUnreachable, exitCode(&notFoundError{"Hifi"}))
+	assert.Equal(t, exitUnsupported, exitCode(&controllers.UnsupportedCommandError{Command: controllers.CommandSeek}))
+	assert.Equal(t, exitUnsupported, exitCode(&cast.StateError{Op: "use media", State: cast.StateDisconnected}))
+	assert.Equal(t, exitRejected, exitCode(&controllers.ResponseError{Op: "load", Type: controllers.ResponseLoadFailed}))
+	assert.Equal(t, exitUsage, exitCode(usageError("bad")))
+	assert.Equal(t, exitFailure, exitCode(fmt.Errorf("no media is playing")))
+}
@@ -0,0 +1,394 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/urfave/cli"
+	"golang.org/x/net/context"
+	"golang.org/x/term"
+
+	"github.com/vkl/go-cast"
+	"github.com/vkl/go-cast/controllers"
+	"github.com/vkl/go-cast/discovery"
+	"github.com/vkl/go-cast/events"
+)
+
+// seekStep is how far the left and right arrows seek, in seconds.
+const seekStep = 10
+
+type remoteAction int
+
+const (
+	actionNone remoteAction = iota
+	actionPlayPause
+	actionSeekBack
+	actionSeekForward
+	actionVolumeUp
+	actionVolumeDown
+	actionMute
+	actionQueueNext
+	actionQueuePrev
+	actionQuitApp
+	actionForceQuitApp
+	actionNextDevice
+	actionExit
+)
+
+const remoteHelp = "space play/pause  ←/→ seek  ↑/↓ volume  m mute  n/p next/prev  q/Q quit own/any app  tab device  esc exit"
+
+// keyAction maps a key press, as read from a terminal in raw mode, to the
+// action it triggers.
+func keyAction(key []byte) remoteAction {
+	switch string(key) {
+	case " ":
+		return actionPlayPause
+	case "\x1b[D":
+		return actionSeekBack
+	case "\x1b[C":
+		return actionSeekForward
+	case "\x1b[A":
+		return actionVolumeUp
+	case "\x1b[B":
+		return actionVolumeDown
+	case "m", "M":
+		return actionMute
+	case "n", "N":
+		return actionQueueNext
+	case "p", "P":
+		return actionQueuePrev
+	case "q":
+		return actionQuitApp
+	case "Q":
+		return actionForceQuitApp
+	case "\t":
+		return actionNextDevice
+	case "\x1b", "\x03", "\x04":
+		return actionExit
+	}
+	return actionNone
+}
+
+// readKeys sends each chunk read from r, one key press in raw mode, until
+// r fails.
+func readKeys(r io.Reader) <-chan []byte {
+	keys := make(chan []byte)
+	go func() {
+		defer close(keys)
+		buf := make([]byte, 16)
+		for {
+			n, err := r.Read(buf)
+			if err != nil {
+				return
+			}
+			key := make([]byte, n)
+			copy(key, buf[:n])
+			keys <- key
+		}
+	}()
+	return keys
+}
+
+// remote is the interactive remote control for one device at a time,
+// chosen among the discovered devices.
+type remote struct {
+	devices []*cast.Client
+	client  *cast.Client
+	events  <-chan events.Event
+	cancel  func()
+	media   *controllers.MediaController
+	view    watchView
+	message string
+}
+
+// addDevice records a discovered device and reports whether it is new.
+func (r *remote) addDevice(client *cast.Client) bool {
+	for _, device := range r.devices {
+		if device.Uuid() == client.Uuid() && device.IP().Equal(client.IP()) {
+			return false
+		}
+	}
+	r.devices = append(r.devices, client)
+	return true
+}
+
+// nextDevice returns the device after the current one.
+func (r *remote) nextDevice() *cast.Client {
+	if len(r.devices) == 0 {
+		return nil
+	}
+	for i, device := range r.devices {
+		if device == r.client {
+			return r.devices[(i+1)%len(r.devices)]
+		}
+	}
+	return r.devices[0]
+}
+
+func (r *remote) disconnect() {
+	if r.client == nil {
+		return
+	}
+	r.cancel()
+	r.client.Close()
+	r.client = nil
+	r.events = nil
+	r.media = nil
+	r.view = watchView{}
+}
+
+// switchTo connects to client, closing the connection to the previous
+// device.
+func (r *remote) switchTo(ctx context.Context, client *cast.Client) error {
+	r.disconnect()
+	if err := client.Connect(context.Background()); err != nil {
+		return fmt.Errorf("failed to connect to %s: %s", client, err)
+	}
+	r.client = client
+	r.events, r.cancel = client.Subscribe()
+	r.view = watchView{Device: client.Name()}
+	return r.refresh(ctx)
+}
+
+// refresh reloads the receiver status and attaches to the running app.
+func (r *remote) refresh(ctx context.Context) error {
+	receiver, err := r.client.Receiver()
+	if err != nil {
+		return err
+	}
+	status, err := receiver.GetStatus(ctx)
+	if err != nil {
+		return err
+	}
+	r.view.applyReceiverStatus(status)
+	r.media, err = attachMedia(ctx, r.client)
+	if err != nil || r.media == nil {
+		return err
+	}
+	mediaStatus, err := r.media.GetStatus(ctx)
+	if err != nil {
+		return err
+	}
+	for _, s := range mediaStatus.Status {
+		r.view.applyMediaStatus(s, time.Now())
+	}
+	return nil
+}
+
+// perform runs action against the current device.
+func (r *remote) perform(ctx context.Context, action remoteAction) error {
+	if r.client == nil {
+		return fmt.Errorf("no device connected")
+	}
+	receiver, err := r.client.Receiver()
+	if err != nil {
+		return err
+	}
+	switch action {
+	case actionVolumeUp, actionVolumeDown:
+		steps := 1
+		if action == actionVolumeDown {
+			steps = -1
+		}
+		_, err = receiver.StepVolume(ctx, steps)
+		return err
+	case actionMute:
+		_, err = receiver.ToggleMute(ctx)
+		return err
+	case actionQuitApp, actionForceQuitApp:
+		// the remote launches nothing itself, so running apps are mostly
+		// other senders' and need Q
+		_, err = receiver.StopApp(ctx, action == actionForceQuitApp)
+		if errors.Is(err, controllers.ErrNotOwnSession) {
+			err = fmt.Errorf("%w, press Q to quit it anyway", err)
+		}
+		return err
+	}
+
+	if r.media == nil {
+		return fmt.Errorf("no media is playing")
+	}
+	switch action {
+	case actionPlayPause:
+		if r.view.PlayerState == "PLAYING" || r.view.PlayerState == "BUFFERING" {
+			_, err = r.media.Pause(ctx)
+		} else {
+			_, err = r.media.Play(ctx)
+		}
+	case actionSeekBack, actionSeekForward:
+		offset := float64(seekStep)
+		if action == actionSeekBack {
+			offset = -offset
+		}
+		position := r.view.position(time.Now()) + offset
+		if position < 0 {
+			position = 0
+		}
+		_, err = r.media.Seek(ctx, position)
+	case actionQueueNext:
+		_, err = r.media.QueueNext(ctx)
+	case actionQueuePrev:
+		_, err = r.media.QueuePrev(ctx)
+	}
+	return err
+}
+
+// queueLines returns the titles of the queue items, marking the current one.
+func queueLines(status *controllers.MediaStatus) []string {
+	if status == nil {
+		return nil
+	}
+	lines := []string{}
+	for i, item := range status.Items {
+		marker := " "
+		if item.ItemID == status.CurrentItemID {
+			marker = ">"
+		}
+		title := ""
+		if item.Media != nil {
+			title = item.Media.MetaData.Title
+			if title == "" {
+				title = item.Media.ContentId
+			}
+		}
+		lines = append(lines, fmt.Sprintf("%s %2d. %s", marker, i+1, title))
+	}
+	return lines
+}
+
+func (r *remote) render(w io.Writer, now time.Time) {
+	names := []string{}
+	for _, device := range r.devices {
+		name := device.Name()
+		if device == r.client {
+			name = "[" + name + "]"
+		}
+		names = append(names, name)
+	}
+	fmt.Fprintf(w, "Devices: %s\n\n", strings.Join(names, "  "))
+	if r.client == nil {
+		fmt.Fprintln(w, "Waiting for devices...")
+	} else {
+		r.view.render(w, now)
+	}
+	if r.media != nil {
+		if lines := queueLines(r.media.Status()); len(lines) > 0 {
+			fmt.Fprintln(w, "\nQueue:")
+			for _, line := range lines {
+				fmt.Fprintln(w, line)
+			}
+		}
+	}
+	fmt.Fprintf(w, "\n%s\n", remoteHelp)
+	if r.message != "" {
+		fmt.Fprintf(w, "%s\n", r.message)
+	}
+}
+
+func (r *remote) draw() {
+	buf := &bytes.Buffer{}
+	r.render(buf, time.Now())
+	// raw mode doesn't translate newlines
+	out := strings.Replace(buf.String(), "\n", "\r\n", -1)
+	fmt.Print("\033[H\033[2J" + out)
+}
+
+func remoteCommand(c *cli.Context) error {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return usageError("the remote needs a terminal")
+	}
+	ctx, cancel := signalContext()
+	defer cancel()
+	commandTimeout := timeout(c)
+
+	r := &remote{}
+	defer r.disconnect()
+
+	service := discovery.NewService(ctx)
+	service.SetClientOptions(clientOptions(c)...)
+	go service.Run(ctx, 10*time.Second)
+
+	if _, ok := targetDevice(c); ok {
+		findCtx, findCancel := context.WithTimeout(ctx, commandTimeout)
+		client, err := findClient(findCtx, c)
+		if err == nil {
+			r.addDevice(client)
+			err = r.switchTo(findCtx, client)
+		}
+		findCancel()
+		if err != nil {
+			return exitError(err)
+		}
+	}
+
+	state, err := term.MakeRaw(fd)
+	if err != nil {
+		return exitError(err)
+	}
+	defer term.Restore(fd, state)
+
+	keys := readKeys(os.Stdin)
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	r.draw()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case client := <-service.Found():
+			if r.addDevice(client) && r.client == nil {
+				r.message = ""
+				commandCtx, commandCancel := context.WithTimeout(ctx, commandTimeout)
+				if err := r.switchTo(commandCtx, client); err != nil {
+					r.message = err.Error()
+				}
+				commandCancel()
+			}
+		case key, ok := <-keys:
+			if !ok {
+				return nil
+			}
+			action := keyAction(key)
+			if action == actionExit {
+				return nil
+			}
+			if action == actionNone {
+				continue
+			}
+			r.message = ""
+			commandCtx, commandCancel := context.WithTimeout(ctx, commandTimeout)
+			if action == actionNextDevice {
+				if next := r.nextDevice(); next != nil && next != r.client {
+					err = r.switchTo(commandCtx, next)
+				}
+			} else {
+				err = r.perform(commandCtx, action)
+			}
+			commandCancel()
+			if err != nil {
+				r.message = err.Error()
+			}
+		case event := <-r.events:
+			switch event.(type) {
+			case events.Disconnected:
+				r.message = fmt.Sprintf("%s disconnected", r.client.Name())
+				r.disconnect()
+			case events.AppStarted:
+				commandCtx, commandCancel := context.WithTimeout(ctx, commandTimeout)
+				if err := r.refresh(commandCtx); err != nil {
+					r.message = err.Error()
+				}
+				commandCancel()
+			}
+			r.view.apply(event, time.Now())
+		case <-ticker.C:
+		}
+		r.draw()
+	}
+}
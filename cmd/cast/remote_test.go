@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+
+	"github.com/vkl/go-cast"
+	"github.com/vkl/go-cast/controllers"
+	castnet "github.com/vkl/go-cast/net"
+)
+
+func TestKeyAction(t *testing.T) {
+	assert.Equal(t, actionPlayPause, keyAction([]byte(" ")))
+	assert.Equal(t, actionSeekBack, keyAction([]byte("\x1b[D")))
+	assert.Equal(t, actionVolumeUp, keyAction([]byte("\x1b[A")))
+	assert.Equal(t, actionQueueNext, keyAction([]byte("n")))
+	assert.Equal(t, actionQuitApp, keyAction([]byte("q")))
+	assert.Equal(t, actionForceQuitApp, keyAction([]byte("Q")))
+	assert.Equal(t, actionExit, keyAction([]byte("\x03")))
+	assert.Equal(t, actionNone, keyAction([]byte("x")))
+}
+
+func TestQueueLines(t *testing.T) {
+	status := &controllers.MediaStatus{CurrentItemID: 8, Items: []*controllers.QueueItem{
+		{ItemID: 7, Media: &controllers.MediaStatusMedia{ContentId: "http://host/1.mp3"}},
+		{ItemID: 8, Media: &controllers.MediaStatusMedia{MetaData: controllers.MediaMetadata{Title: "Second"}}},
+	}}
+	assert.Equal(t, []string{"   1. http://host/1.mp3", ">  2. Second"}, queueLines(status))
+	assert.Nil(t, queueLines(nil))
+}
+
+func TestRemoteDevices(t *testing.T) {
+	device := func(id, ip string) *cast.Client {
+		client := cast.NewClient(net.ParseIP(ip), 8009)
+		client.SetInfo(map[string]string{"id": id})
+		return client
+	}
+	r := &remote{}
+	assert.Nil(t, r.nextDevice())
+	first := device("a", "10.0.0.1")
+	second := device("b", "10.0.0.2")
+	assert.True(t, r.addDevice(first))
+	assert.True(t, r.addDevice(second))
+	assert.False(t, r.addDevice(device("a", "10.0.0.1")))
+
+	assert.Equal(t, first, r.nextDevice())
+	r.client = first
+	assert.Equal(t, second, r.nextDevice())
+	r.client = second
+	assert.Equal(t, first, r.nextDevice())
+}
+
+func TestRemoteQuitHint(t *testing.T) {
+	running := `{"type":"RECEIVER_STATUS","requestId":%d,"status":{"applications":[{"appId":"CC1AD845","displayName":"Default Media Receiver","statusText":"","sessionId":"session-1","namespaces":[]}],"volume":{"level":0.5,"muted":false}}}`
+	out := func(namespace, payload string) castnet.Record {
+		return castnet.Record{Direction: castnet.DirectionOutbound, SourceId: cast.DefaultSender, DestinationId: cast.DefaultReceiver, Namespace: namespace, Payload: payload}
+	}
+	in := func(namespace, payload string) castnet.Record {
+		return castnet.Record{Direction: castnet.DirectionInbound, SourceId: cast.DefaultReceiver, DestinationId: cast.DefaultSender, Namespace: namespace, Payload: payload}
+	}
+	const namespaceReceiver = "urn:x-cast:com.google.cast.receiver"
+	replay := castnet.NewReplay([]castnet.Record{
+		out(castnet.NamespaceConnection, `{"type":"CONNECT"}`),
+		out(namespaceReceiver, `{"type":"GET_STATUS","requestId":1}`),
+		in(namespaceReceiver, fmt.Sprintf(running, 1)),
+		out("urn:x-cast:test", ``),
+	})
+	client := cast.NewClientWithOptions(net.IPv4(127, 0, 0, 1), 8009, cast.WithSenderID(cast.DefaultSender))
+	assert.NoError(t, client.ConnectTransport(context.Background(), replay))
+	defer client.Close()
+
+	r := &remote{client: client}
+	err := r.perform(context.Background(), actionQuitApp)
+	assert.ErrorIs(t, err, controllers.ErrNotOwnSession)
+	assert.ErrorContains(t, err, "press Q")
+}
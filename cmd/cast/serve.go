@@ -0,0 +1,137 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/urfave/cli"
+
+	"github.com/vkl/go-cast"
+	"github.com/vkl/go-cast/daemon"
+	"github.com/vkl/go-cast/discovery"
+	"github.com/vkl/go-cast/logger"
+	"github.com/vkl/go-cast/mqttbridge"
+)
+
+// addConfiguredDevices adds the configured devices that have a host, which
+// discovery may not find, such as devices on another subnet.
+func addConfiguredDevices(c *cli.Context, manager *daemon.Manager) error {
+	aliases := make([]string, 0, len(settings.Devices))
+	for alias := range settings.Devices {
+		aliases = append(aliases, alias)
+	}
+	sort.Strings(aliases)
+	for _, alias := range aliases {
+		device := settings.Devices[alias]
+		if device.Host == "" {
+			continue
+		}
+		ips, err := net.LookupIP(device.Host)
+		if err != nil {
+			return fmt.Errorf("failed to resolve %s: %w", device.Host, err)
+		}
+		port := device.Port
+		if port == 0 {
+			port = c.GlobalInt("port")
+		}
+		client := cast.NewClientWithOptions(ips[0], port, clientOptions(c)...)
+		client.SetName(alias)
+		if device.Name != "" {
+			client.SetName(device.Name)
+		}
+		if device.UUID != "" {
+			client.SetInfo(map[string]string{"id": device.UUID})
+		}
+		manager.Add(client)
+	}
+	return nil
+}
+
+func serveCommand(c *cli.Context) error {
+	if c.String("listen") == "" && c.String("mqtt-broker") == "" {
+		return usageError("nothing to serve, give --listen or --mqtt-broker")
+	}
+	ctx, cancel := signalContext()
+	defer cancel()
+
+	manager := daemon.NewManager(ctx)
+	if c.GlobalBool("debug") {
+		manager.SetLogger(logger.New(os.Stderr))
+	}
+	manager.SetKeepConnected(c.BoolT("keep-connected"))
+	// devices answer every query, allow for a couple of missed ones
+	manager.SetExpiry(3 * c.Duration("discovery-interval"))
+	defer manager.Close()
+	if err := addConfiguredDevices(c, manager); err != nil {
+		return exitError(err)
+	}
+
+	service := discovery.NewService(ctx)
+	service.SetClientOptions(clientOptions(c)...)
+	go func() {
+		if err := service.Run(ctx, c.Duration("discovery-interval")); err != nil && ctx.Err() == nil {
+			fmt.Fprintf(os.Stderr, "discovery stopped: %s\n", err)
+		}
+	}()
+	go manager.Discover(ctx, service)
+
+	var runners []func() error
+	if address := c.String("listen"); address != "" {
+		handler := daemon.NewHandler(manager)
+		handler.SetTimeout(timeout(c))
+		listener, err := net.Listen("tcp", address)
+		if err != nil {
+			return exitError(err)
+		}
+		server := &http.Server{Handler: handler}
+		go func() {
+			<-ctx.Done()
+			server.Close()
+		}()
+		fmt.Printf("Serving the API on http://%s\n", listener.Addr())
+		runners = append(runners, func() error {
+			if err := server.Serve(listener); err != http.ErrServerClosed {
+				return err
+			}
+			return nil
+		})
+	}
+	if broker := c.String("mqtt-broker"); broker != "" {
+		opts := mqtt.NewClientOptions().
+			AddBroker(broker).
+			SetClientID(c.String("mqtt-client-id")).
+			SetUsername(c.String("mqtt-username")).
+			SetPassword(c.String("mqtt-password"))
+		bridge := mqttbridge.New(opts, manager, c.String("mqtt-prefix"))
+		bridge.SetTimeout(timeout(c))
+		if c.GlobalBool("debug") {
+			bridge.SetLogger(logger.New(os.Stderr))
+		}
+		fmt.Printf("Bridging devices to %s under %s/\n", broker, c.String("mqtt-prefix"))
+		runners = append(runners, func() error {
+			return bridge.Run(ctx)
+		})
+	}
+	fmt.Println("Press Ctrl-C to stop")
+
+	// the first to stop, with an error or on Ctrl-C, stops the others
+	errs := make(chan error, len(runners))
+	for _, run := range runners {
+		go func(run func() error) {
+			err := run()
+			cancel()
+			errs <- err
+		}(run)
+	}
+	var err error
+	for range runners {
+		if runErr := <-errs; runErr != nil && err == nil {
+			err = runErr
+		}
+	}
+	return exitError(err)
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"time"
+
+	"github.com/urfave/cli"
+	"golang.org/x/net/context"
+
+	"github.com/vkl/go-cast"
+	"github.com/vkl/go-cast/config"
+)
+
+// settings is the configuration file, loaded before any command runs.
+var settings = &config.Config{}
+
+func loadSettings(c *cli.Context) error {
+	var err error
+	if path := c.GlobalString("config"); path != "" {
+		settings, err = config.LoadFile(path)
+	} else {
+		settings, err = config.Load()
+	}
+	if err != nil {
+		return usageError("%s", err)
+	}
+	return nil
+}
+
+// timeout returns --timeout, or the configured timeout unless the flag is
+// given.
+func timeout(c *cli.Context) time.Duration {
+	if !c.GlobalIsSet("timeout") && settings.Timeout > 0 {
+		return settings.Timeout
+	}
+	return c.GlobalDuration("timeout")
+}
+
+// targetDevice returns the device given by --host or --name, which may be
+// an alias, falling back to the configured default device.
+func targetDevice(c *cli.Context) (config.Device, bool) {
+	if host := c.GlobalString("host"); host != "" {
+		return config.Device{Host: host, Port: c.GlobalInt("port")}, true
+	}
+	device, ok := settings.Resolve(c.GlobalString("name"))
+	if ok && device.Host != "" && device.Port == 0 {
+		device.Port = c.GlobalInt("port")
+	}
+	return device, ok
+}
+
+// applyDefaultVolume sets the configured volume of the target device
+// before playing media.
+func applyDefaultVolume(ctx context.Context, c *cli.Context, client *cast.Client) error {
+	device, ok := targetDevice(c)
+	if !ok || device.Volume == nil {
+		return nil
+	}
+	receiver, err := client.Receiver()
+	if err != nil {
+		return err
+	}
+	_, err = receiver.SetVolumeLevel(ctx, *device.Volume)
+	return err
+}
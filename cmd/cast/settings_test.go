@@ -0,0 +1,31 @@
+package main
+
+import (
+	"flag"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/urfave/cli"
+
+	"github.com/vkl/go-cast"
+	"github.com/vkl/go-cast/config"
+)
+
+func TestClientOptionsDialTimeout(t *testing.T) {
+	defer func(saved *config.Config) { settings = saved }(settings)
+	settings = &config.Config{DialTimeout: time.Second * 5}
+
+	dialTimeout := func(args ...string) time.Duration {
+		global := flag.NewFlagSet("cast", flag.ContinueOnError)
+		global.Duration("timeout", time.Second*15, "")
+		assert.NoError(t, global.Parse(args))
+		c := cli.NewContext(nil, flag.NewFlagSet("status", flag.ContinueOnError), cli.NewContext(nil, global, nil))
+		client := cast.NewClientWithOptions(net.IPv4(127, 0, 0, 1), 8009, clientOptions(c)...)
+		return client.Options().DialTimeout
+	}
+
+	assert.Equal(t, time.Second*5, dialTimeout())
+	assert.Equal(t, time.Second*3, dialTimeout("--timeout", "3s"))
+}
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/urfave/cli"
+	"golang.org/x/net/context"
+
+	"github.com/vkl/go-cast"
+	"github.com/vkl/go-cast/controllers"
+	"github.com/vkl/go-cast/events"
+)
+
+const progressWidth = 40
+
+// watchView is the state shown by the watch command, updated from the
+// client's events.
+type watchView struct {
+	Device      string
+	App         string
+	PlayerState string
+	Title       string
+	CurrentTime float64
+	Duration    float64
+	Live        bool
+	Level       float64
+	Muted       bool
+
+	// updated is when CurrentTime was reported, to advance the progress
+	// bar between status updates while playing.
+	updated time.Time
+}
+
+// apply updates the view from event and reports whether it changed.
+func (v *watchView) apply(event events.Event, now time.Time) bool {
+	switch e := event.(type) {
+	case events.StatusUpdated:
+		v.Level = e.Level
+		v.Muted = e.Muted
+	case events.AppStarted:
+		if e.AppID == cast.AppBackdrop {
+			return false
+		}
+		v.App = e.DisplayName
+	case events.AppStopped:
+		if e.DisplayName != v.App {
+			return false
+		}
+		v.App = ""
+		v.clearMedia()
+	case events.MediaStatusUpdated:
+		v.PlayerState = e.PlayerState
+		v.CurrentTime = e.CurrentTime
+		v.Duration = e.Duration
+		v.Live = e.IsLive
+		v.updated = now
+		if e.MetaData != nil {
+			v.Title = *e.MetaData
+		}
+		if e.PlayerState == "IDLE" {
+			v.clearMedia()
+		}
+	default:
+		return false
+	}
+	return true
+}
+
+func (v *watchView) applyReceiverStatus(status *controllers.ReceiverStatus) {
+	v.App = ""
+	for _, app := range status.Applications {
+		if app.AppID != nil && *app.AppID == cast.AppBackdrop {
+			continue
+		}
+		v.App = stringValue(app.DisplayName)
+	}
+	if status.Volume != nil {
+		if status.Volume.Level != nil {
+			v.Level = *status.Volume.Level
+		}
+		if status.Volume.Muted != nil {
+			v.Muted = *status.Volume.Muted
+		}
+	}
+}
+
+func (v *watchView) applyMediaStatus(status *controllers.MediaStatus, now time.Time) {
+	event := events.MediaStatusUpdated{
+		PlayerState: status.PlayerState,
+		CurrentTime: status.CurrentTime,
+		Duration:    mediaDuration(status),
+		IsLive:      status.IsLive(),
+	}
+	if status.Media != nil {
+		title := fmt.Sprintf("%s : %s", status.Media.MetaData.Artist, status.Media.MetaData.Title)
+		event.MetaData = &title
+	}
+	v.apply(event, now)
+}
+
+func (v *watchView) clearMedia() {
+	v.PlayerState = ""
+	v.Title = ""
+	v.CurrentTime = 0
+	v.Duration = 0
+	v.Live = false
+}
+
+// position returns the playback position at now.
+func (v *watchView) position(now time.Time) float64 {
+	position := v.CurrentTime
+	if v.PlayerState == "PLAYING" && !v.updated.IsZero() {
+		position += now.Sub(v.updated).Seconds()
+	}
+	if v.Duration > 0 && position > v.Duration {
+		position = v.Duration
+	}
+	return position
+}
+
+func (v *watchView) render(w io.Writer, now time.Time) {
+	fmt.Fprintf(w, "Device:  %s\n", v.Device)
+	app := v.App
+	if app == "" {
+		app = "-"
+	}
+	fmt.Fprintf(w, "App:     %s\n", app)
+	volume := fmt.Sprintf("%3.0f%%", v.Level*100)
+	if v.Muted {
+		volume += " (muted)"
+	}
+	fmt.Fprintf(w, "Volume:  %s\n", volume)
+	if v.PlayerState == "" {
+		fmt.Fprintln(w, "Player:  -")
+		return
+	}
+	fmt.Fprintf(w, "Player:  %s\n", v.PlayerState)
+	if v.Title != "" {
+		fmt.Fprintf(w, "Title:   %s\n", v.Title)
+	}
+	position := v.position(now)
+	if v.Live || v.Duration <= 0 {
+		fmt.Fprintf(w, "         %s  LIVE\n", formatDuration(position))
+		return
+	}
+	fmt.Fprintf(w, "         %s %s %s\n",
+		formatDuration(position), progressBar(position/v.Duration, progressWidth), formatDuration(v.Duration))
+}
+
+// progressBar draws fraction, clamped to [0, 1], as a bar width
+// characters wide.
+func progressBar(fraction float64, width int) string {
+	fraction = math.Max(0, math.Min(1, fraction))
+	filled := int(fraction * float64(width))
+	return "[" + strings.Repeat("#", filled) + strings.Repeat("-", width-filled) + "]"
+}
+
+// formatDuration formats seconds as m:ss, or h:mm:ss past the hour.
+func formatDuration(seconds float64) string {
+	d := time.Duration(seconds) * time.Second
+	h := int(d / time.Hour)
+	m := int(d/time.Minute) % 60
+	s := int(d/time.Second) % 60
+	if h > 0 {
+		return fmt.Sprintf("%d:%02d:%02d", h, m, s)
+	}
+	return fmt.Sprintf("%d:%02d", m, s)
+}
+
+func mediaDuration(status *controllers.MediaStatus) float64 {
+	if status.Media == nil {
+		return 0
+	}
+	return status.Media.Duration
+}
+
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// watchMedia attaches to the running app to receive its media status
+// pushes, and applies its current status.
+func watchMedia(ctx context.Context, client *cast.Client, view *watchView) error {
+	media, err := attachMedia(ctx, client)
+	if err != nil || media == nil {
+		return err
+	}
+	status, err := media.GetStatus(ctx)
+	if err != nil {
+		return err
+	}
+	for _, s := range status.Status {
+		view.applyMediaStatus(s, time.Now())
+	}
+	return nil
+}
+
+func watchCommand(c *cli.Context) error {
+	ctx, cancel := signalContext()
+	defer cancel()
+
+	findCtx, findCancel := context.WithTimeout(ctx, timeout(c))
+	client, err := connect(findCtx, c)
+	findCancel()
+	if err != nil {
+		return exitError(err)
+	}
+	defer client.Close()
+
+	eventsCh, unsubscribe := client.Subscribe()
+	defer unsubscribe()
+
+	view := &watchView{Device: client.Name()}
+	receiver, err := client.Receiver()
+	if err != nil {
+		return exitError(err)
+	}
+	status, err := receiver.GetStatus(ctx)
+	if err != nil {
+		return exitError(err)
+	}
+	view.applyReceiverStatus(status)
+	if err := watchMedia(ctx, client, view); err != nil {
+		return exitError(err)
+	}
+
+	terminal := isTerminal(os.Stdout)
+	draw := func() {
+		if terminal {
+			// home the cursor and clear the screen
+			fmt.Print("\033[H\033[2J")
+		}
+		view.render(os.Stdout, time.Now())
+		if !terminal {
+			fmt.Println()
+		}
+	}
+	draw()
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case event := <-eventsCh:
+			switch e := event.(type) {
+			case events.Disconnected:
+				return cli.NewExitError(fmt.Sprintf("disconnected: %v", e.Reason), exitDisconnected)
+			case events.AppStarted:
+				if e.AppID != cast.AppBackdrop {
+					if err := watchMedia(ctx, client, view); err != nil {
+						client.Logger().Warn("failed to attach app", "error", err)
+					}
+				}
+			}
+			if view.apply(event, time.Now()) {
+				draw()
+			}
+		case <-ticker.C:
+			if terminal && view.PlayerState == "PLAYING" {
+				draw()
+			}
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/vkl/go-cast"
+	"github.com/vkl/go-cast/events"
+)
+
+func TestWatchViewApply(t *testing.T) {
+	now := time.Now()
+	view := &watchView{Device: "Hifi"}
+	title := "Artist : Song"
+	assert.True(t, view.apply(events.StatusUpdated{Level: 0.5}, now))
+	assert.False(t, view.apply(events.AppStarted{AppID: cast.AppBackdrop, DisplayName: "Backdrop"}, now))
+	assert.True(t, view.apply(events.AppStarted{AppID: cast.AppMedia, DisplayName: "Default Media Receiver"}, now))
+	assert.True(t, view.apply(events.MediaStatusUpdated{
+		PlayerState: "PLAYING", CurrentTime: 30, Duration: 120, MetaData: &title}, now))
+	assert.False(t, view.apply(events.Connected{}, now))
+
+	assert.Equal(t, 40.0, view.position(now.Add(10*time.Second)))
+	assert.Equal(t, 120.0, view.position(now.Add(time.Hour)))
+
+	out := &bytes.Buffer{}
+	view.render(out, now)
+	assert.Equal(t, "Device:  Hifi\n"+
+		"App:     Default Media Receiver\n"+
+		"Volume:   50%\n"+
+		"Player:  PLAYING\n"+
+		"Title:   Artist : Song\n"+
+		"         0:30 [##########------------------------------] 2:00\n", out.String())
+
+	assert.True(t, view.apply(events.AppStopped{AppID: cast.AppMedia, DisplayName: "Default Media Receiver"}, now))
+	assert.Equal(t, "", view.App)
+	assert.Equal(t, "", view.PlayerState)
+}
+
+func TestFormatDuration(t *testing.T) {
+	assert.Equal(t, "0:00", formatDuration(0))
+	assert.Equal(t, "4:05", formatDuration(245.7))
+	assert.Equal(t, "1:01:01", formatDuration(3661))
+	assert.Equal(t, "[##--]", progressBar(0.5, 4))
+	assert.Equal(t, "[####]", progressBar(3, 4))
+}
@@ -0,0 +1,150 @@
+// Package config loads the go-cast configuration file, which defines
+// device aliases, a default device and default timeouts.
+//
+// The file is YAML, by default at $XDG_CONFIG_HOME/go-cast/config.yaml:
+//
+//	default: living
+//	timeout: 10s
+//	devices:
+//	  living:
+//	    name: Living Room speaker
+//	    volume: 0.4
+//	  kitchen:
+//	    host: 192.168.1.23
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/vkl/go-cast"
+)
+
+// Device identifies a device by its name, UUID or address. A host is
+// connected to directly, otherwise the device is found by discovery.
+type Device struct {
+	Name string `yaml:"name,omitempty"`
+	UUID string `yaml:"uuid,omitempty"`
+	Host string `yaml:"host,omitempty"`
+	Port int    `yaml:"port,omitempty"`
+	// Volume is the level set before playing media, if not nil.
+	Volume *float64 `yaml:"volume,omitempty"`
+}
+
+// Matches reports whether a discovered device with the given name and
+// UUID is this device.
+func (d Device) Matches(name, uuid string) bool {
+	return (d.UUID != "" && d.UUID == uuid) || (d.Name != "" && d.Name == name)
+}
+
+type Config struct {
+	// Default is the alias of the device used when none is given.
+	Default string `yaml:"default,omitempty"`
+	// Timeout bounds discovery and commands.
+	Timeout time.Duration `yaml:"timeout,omitempty"`
+	// DialTimeout bounds connecting to a device.
+	DialTimeout time.Duration     `yaml:"dial_timeout,omitempty"`
+	Devices     map[string]Device `yaml:"devices,omitempty"`
+}
+
+// Path returns the default location of the configuration file.
+func Path() (string, error) {
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		dir = filepath.Join(home, ".config")
+	}
+	return filepath.Join(dir, "go-cast", "config.yaml"), nil
+}
+
+// Load reads the configuration file at the default location. A missing
+// file yields an empty configuration.
+func Load() (*Config, error) {
+	path, err := Path()
+	if err != nil {
+		return nil, err
+	}
+	config, err := LoadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return &Config{}, nil
+	}
+	return config, err
+}
+
+// LoadFile reads the configuration file at path, which must exist.
+func LoadFile(path string) (*Config, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	config, err := Parse(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load %s: %w", path, err)
+	}
+	return config, nil
+}
+
+// Parse reads and validates a configuration.
+func Parse(r io.Reader) (*Config, error) {
+	config := &Config{}
+	if err := yaml.NewDecoder(r).Decode(config); err != nil && err != io.EOF {
+		return nil, err
+	}
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+func (c *Config) Validate() error {
+	if c.Default != "" {
+		if _, ok := c.Devices[c.Default]; !ok {
+			return fmt.Errorf("default device %q is not defined", c.Default)
+		}
+	}
+	for alias, device := range c.Devices {
+		if device.Name == "" && device.UUID == "" && device.Host == "" {
+			return fmt.Errorf("device %q needs a name, uuid or host", alias)
+		}
+		if device.Volume != nil && (*device.Volume < 0 || *device.Volume > 1) {
+			return fmt.Errorf("volume of device %q must be between 0 and 1", alias)
+		}
+	}
+	return nil
+}
+
+// Resolve returns the device for an alias, or a device named name if it
+// isn't one. An empty name resolves to the default device; ok is false if
+// there is none.
+func (c *Config) Resolve(name string) (device Device, ok bool) {
+	if name == "" {
+		name = c.Default
+		if name == "" {
+			return Device{}, false
+		}
+	}
+	if device, ok := c.Devices[name]; ok {
+		return device, true
+	}
+	return Device{Name: name, UUID: name}, true
+}
+
+// ClientOptions returns the client options the configuration sets.
+func (c *Config) ClientOptions() []cast.Option {
+	var opts []cast.Option
+	if c.DialTimeout > 0 {
+		opts = append(opts, cast.WithDialTimeout(c.DialTimeout))
+	}
+	return opts
+}
@@ -0,0 +1,87 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const sample = `
+default: living
+timeout: 10s
+dial_timeout: 3s
+devices:
+  living:
+    name: Living Room speaker
+    volume: 0.4
+  kitchen:
+    host: 192.168.1.23
+    port: 8010
+`
+
+func TestParse(t *testing.T) {
+	config, err := Parse(strings.NewReader(sample))
+	assert.NoError(t, err)
+	assert.Equal(t, 10*time.Second, config.Timeout)
+	assert.Equal(t, 3*time.Second, config.DialTimeout)
+	assert.Len(t, config.ClientOptions(), 1)
+
+	device, ok := config.Resolve("")
+	assert.True(t, ok)
+	assert.Equal(t, "Living Room speaker", device.Name)
+	assert.Equal(t, 0.4, *device.Volume)
+	assert.True(t, device.Matches("Living Room speaker", "abc"))
+
+	device, _ = config.Resolve("kitchen")
+	assert.Equal(t, "192.168.1.23", device.Host)
+	assert.Equal(t, 8010, device.Port)
+
+	// anything else is a device name or uuid
+	device, _ = config.Resolve("Bedroom")
+	assert.True(t, device.Matches("Bedroom", ""))
+	assert.True(t, device.Matches("", "Bedroom"))
+	assert.False(t, device.Matches("Kitchen", "abc"))
+}
+
+func TestParseInvalid(t *testing.T) {
+	_, err := Parse(strings.NewReader("default: office\n"))
+	assert.EqualError(t, err, `default device "office" is not defined`)
+
+	_, err = Parse(strings.NewReader("devices:\n  office:\n    port: 8009\n"))
+	assert.EqualError(t, err, `device "office" needs a name, uuid or host`)
+
+	_, err = Parse(strings.NewReader("devices:\n  office:\n    name: Office\n    volume: 2\n"))
+	assert.Error(t, err)
+
+	config, err := Parse(strings.NewReader(""))
+	assert.NoError(t, err)
+	_, ok := config.Resolve("")
+	assert.False(t, ok)
+}
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", dir)
+
+	path, err := Path()
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(dir, "go-cast", "config.yaml"), path)
+
+	// a missing file is an empty configuration
+	config, err := Load()
+	assert.NoError(t, err)
+	assert.Empty(t, config.Devices)
+	// unless it was asked for
+	_, err = LoadFile(path)
+	assert.ErrorIs(t, err, os.ErrNotExist)
+
+	assert.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+	assert.NoError(t, os.WriteFile(path, []byte(sample), 0644))
+	config, err = Load()
+	assert.NoError(t, err)
+	assert.Equal(t, "living", config.Default)
+}
@@ -3,20 +3,21 @@ package controllers
 import (
 	"encoding/json"
 	"fmt"
-	"log"
+	"sync"
 
 	"golang.org/x/net/context"
 
 	"github.com/vkl/go-cast/api"
 	"github.com/vkl/go-cast/events"
-	_ "github.com/vkl/go-cast/logger"
 	"github.com/vkl/go-cast/net"
 )
 
 type YouTubeMdxController struct {
 	channel          *net.Channel
 	eventsCh         chan events.Event
+	mu               sync.Mutex
 	mdxSessionStatus *MdxSessionStatus
+	statusReceived   chan struct{}
 }
 
 type MdxSessionStatus struct {
@@ -27,12 +28,15 @@ type MdxSessionStatus struct {
 	} `json:"data"`
 }
 
+const NamespaceYouTubeMdx = "urn:x-cast:com.google.youtube.mdx"
+
 var screenId = net.PayloadHeaders{Type: "getMdxSessionStatus"}
 
 func NewAppTubeController(conn *net.Connection, eventsCh chan events.Event, sourceId, destinationId string) *YouTubeMdxController {
 	controller := &YouTubeMdxController{
-		channel:  conn.NewChannel(sourceId, destinationId, "urn:x-cast:com.google.youtube.mdx"),
-		eventsCh: eventsCh,
+		channel:        conn.NewChannel(sourceId, destinationId, NamespaceYouTubeMdx),
+		eventsCh:       eventsCh,
+		statusReceived: make(chan struct{}),
 	}
 
 	controller.channel.OnMessage("mdxSessionStatus", controller.onSessionStatus)
@@ -43,7 +47,7 @@ func NewAppTubeController(conn *net.Connection, eventsCh chan events.Event, sour
 func (y *YouTubeMdxController) RequestMdxSessionStatus(ctx context.Context) error {
 	err := y.channel.Send(screenId)
 	if err != nil {
-		return fmt.Errorf("failed to get mdx session status: %s", err)
+		return fmt.Errorf("failed to get mdx session status: %w", err)
 	}
 	return nil
 }
@@ -52,12 +56,46 @@ func (y *YouTubeMdxController) onSessionStatus(message *api.CastMessage) {
 	response := &MdxSessionStatus{}
 	err := json.Unmarshal([]byte(*message.PayloadUtf8), response)
 	if err != nil {
-		log.Printf("Failed to unmarshal status message:%s - %s", err, *message.PayloadUtf8)
+		y.channel.Logger().Warn("failed to unmarshal status message", "error", err, "payload", *message.PayloadUtf8)
 		return
 	}
+	y.mu.Lock()
+	if y.mdxSessionStatus == nil {
+		close(y.statusReceived)
+	}
 	y.mdxSessionStatus = response
+	y.mu.Unlock()
 }
 
 func (y *YouTubeMdxController) MdxSesionStatus() *MdxSessionStatus {
+	y.mu.Lock()
+	defer y.mu.Unlock()
 	return y.mdxSessionStatus
 }
+
+// ScreenId requests the MDX session status if it hasn't been received yet
+// and waits for the screen id of the YouTube receiver.
+func (y *YouTubeMdxController) ScreenId(ctx context.Context) (string, error) {
+	if status := y.MdxSesionStatus(); status != nil {
+		return status.Data.ScreenId, nil
+	}
+	if err := y.RequestMdxSessionStatus(ctx); err != nil {
+		return "", err
+	}
+	select {
+	case <-y.statusReceived:
+		return y.MdxSesionStatus().Data.ScreenId, nil
+	case <-ctx.Done():
+		return "", fmt.Errorf("failed to get mdx session status: %s", ctx.Err())
+	}
+}
+
+// Lounge returns a YouTube lounge session for the receiver's screen, to
+// manage its playlist over the YouTube lounge API.
+func (y *YouTubeMdxController) Lounge(ctx context.Context, client HTTPClient) (*YouTubeLounge, error) {
+	screenId, err := y.ScreenId(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return NewYouTubeLounge(client, YouTubeBaseURL, screenId), nil
+}
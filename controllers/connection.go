@@ -1,7 +1,7 @@
 package controllers
 
 import (
-	"log"
+	"fmt"
 
 	"github.com/vkl/go-cast/api"
 	"github.com/vkl/go-cast/events"
@@ -15,11 +15,11 @@ type ConnectionController struct {
 }
 
 var connect = net.PayloadHeaders{Type: "CONNECT"}
-var close = net.PayloadHeaders{Type: "CLOSE"}
+var commandClose = net.PayloadHeaders{Type: "CLOSE"}
 
 func NewConnectionController(conn *net.Connection, eventsCh chan events.Event, sourceId, destinationId string) *ConnectionController {
 	controller := &ConnectionController{
-		channel:  conn.NewChannel(sourceId, destinationId, "urn:x-cast:com.google.cast.tp.connection"),
+		channel:  conn.NewChannel(sourceId, destinationId, net.NamespaceConnection),
 		eventsCh: eventsCh,
 	}
 
@@ -32,7 +32,7 @@ func (c *ConnectionController) sendEvent(event events.Event) {
 	select {
 	case c.eventsCh <- event:
 	default:
-		log.Printf("Dropped event: %#v", event)
+		c.channel.Logger().Warn("dropped event", "event", fmt.Sprintf("%#v", event))
 	}
 }
 
@@ -41,7 +41,7 @@ func (c *ConnectionController) Start(ctx context.Context) error {
 }
 
 func (c *ConnectionController) Close() error {
-	return c.channel.Send(close)
+	return c.channel.Send(commandClose)
 }
 
 func (c *ConnectionController) onClose(message *api.CastMessage) {
@@ -1,6 +1,19 @@
 package controllers
 
-import "testing"
+import (
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+
+	"github.com/vkl/go-cast/api"
+	"github.com/vkl/go-cast/net"
+)
+
+const namespaceReceiver = "urn:x-cast:com.google.cast.receiver"
 
 func TestInterfaces(t *testing.T) {
 	// assert controllers implement interfaces
@@ -8,4 +21,65 @@ func TestInterfaces(t *testing.T) {
 	var _ Controller = (*HeartbeatController)(nil)
 	var _ Controller = (*ReceiverController)(nil)
 	var _ Controller = (*MediaController)(nil)
+	var _ Controller = (*URLController)(nil)
+	var _ Controller = (*DashCastController)(nil)
+}
+
+func out(namespace, payload string) net.Record {
+	return net.Record{Direction: net.DirectionOutbound, SourceId: "sender-0", DestinationId: "receiver-0", Namespace: namespace, Payload: payload}
+}
+
+func in(namespace, payload string) net.Record {
+	return net.Record{Direction: net.DirectionInbound, SourceId: "receiver-0", DestinationId: "sender-0", Namespace: namespace, Payload: payload}
+}
+
+// sentTap keeps the payloads sent on each namespace.
+type sentTap struct {
+	mu   sync.Mutex
+	sent map[string][]map[string]interface{}
+}
+
+func (s *sentTap) Inbound(*api.CastMessage) {}
+
+func (s *sentTap) Outbound(message *api.CastMessage) {
+	var payload map[string]interface{}
+	json.Unmarshal([]byte(message.GetPayloadUtf8()), &payload)
+	s.mu.Lock()
+	s.sent[message.GetNamespace()] = append(s.sent[message.GetNamespace()], payload)
+	s.mu.Unlock()
+}
+
+// Sent waits for count payloads of the given type, or of any type if it is
+// empty, to be sent on namespace and returns them. The tap sees a message
+// once written, which may be after its reply arrived.
+func (s *sentTap) Sent(t *testing.T, namespace, messageType string, count int) []map[string]interface{} {
+	var sent []map[string]interface{}
+	assert.Eventually(t, func() bool {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		sent = nil
+		for _, payload := range s.sent[namespace] {
+			if messageType == "" || payload["type"] == messageType {
+				sent = append(sent, payload)
+			}
+		}
+		return len(sent) >= count
+	}, time.Second, time.Millisecond*10)
+	return sent
+}
+
+// replay returns a connection playing records back, held open once they
+// are played until the test ends, and the tap of what it sends.
+func replay(t *testing.T, records ...net.Record) (*net.Connection, *sentTap) {
+	records = append(records, out("urn:x-cast:test", ``))
+	conn := net.NewConnection()
+	tap := &sentTap{sent: map[string][]map[string]interface{}{}}
+	conn.SetTap(tap)
+	conn.ConnectTransport(context.Background(), net.NewReplay(records))
+	t.Cleanup(func() { conn.Close() })
+	return conn, tap
+}
+
+func receiverStatus(requestId, level string) string {
+	return `{"type":"RECEIVER_STATUS","requestId":` + requestId + `,"status":{"applications":[],"volume":{"level":` + level + `,"muted":false}}}`
 }
@@ -0,0 +1,58 @@
+package controllers
+
+import (
+	"fmt"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/vkl/go-cast/events"
+	"github.com/vkl/go-cast/net"
+)
+
+// NamespaceDashCast is the namespace of the DashCast receiver, which shows
+// arbitrary web pages such as dashboards.
+const NamespaceDashCast = "urn:x-cast:com.madmod.dashcast"
+
+// DashCastLoadCommand asks DashCast to show a page. DashCast messages carry
+// no type and get no reply.
+type DashCastLoadCommand struct {
+	URL string `json:"url"`
+	// Force loads the page in a frame even if it forbids framing, by
+	// navigating the receiver away from DashCast.
+	Force bool `json:"force"`
+	// Reload refreshes the page every ReloadTime milliseconds.
+	Reload     bool `json:"reload"`
+	ReloadTime int  `json:"reload_time"`
+}
+
+type DashCastController struct {
+	channel  *net.Channel
+	eventsCh chan events.Event
+}
+
+func NewDashCastController(conn *net.Connection, eventsCh chan events.Event, sourceId, destinationId string) *DashCastController {
+	return &DashCastController{
+		channel:  conn.NewChannel(sourceId, destinationId, NamespaceDashCast),
+		eventsCh: eventsCh,
+	}
+}
+
+func (c *DashCastController) Start(ctx context.Context) error {
+	// noop
+	return nil
+}
+
+// LoadURL shows url, reloading it every reload if that is non-zero.
+func (c *DashCastController) LoadURL(ctx context.Context, url string, force bool, reload time.Duration) error {
+	err := c.channel.Send(&DashCastLoadCommand{
+		URL:        url,
+		Force:      force,
+		Reload:     reload > 0,
+		ReloadTime: int(reload / time.Millisecond),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to send load command: %w", err)
+	}
+	return nil
+}
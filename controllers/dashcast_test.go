@@ -0,0 +1,26 @@
+package controllers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+
+	"github.com/vkl/go-cast/events"
+)
+
+func TestDashCastLoadURL(t *testing.T) {
+	conn, tap := replay(t,
+		out(NamespaceDashCast, `{"url":"http://grafana/d/1"}`),
+		out(NamespaceDashCast, `{"url":"http://grafana/d/2"}`),
+	)
+	dashcast := NewDashCastController(conn, make(chan events.Event, 16), "sender-0", "receiver-0")
+
+	assert.NoError(t, dashcast.LoadURL(context.Background(), "http://grafana/d/1", true, time.Minute))
+	assert.NoError(t, dashcast.LoadURL(context.Background(), "http://grafana/d/2", false, 0))
+	assert.Equal(t, []map[string]interface{}{
+		{"url": "http://grafana/d/1", "force": true, "reload": true, "reload_time": 60000.0},
+		{"url": "http://grafana/d/2", "force": false, "reload": false, "reload_time": 0.0},
+	}, tap.Sent(t, NamespaceDashCast, "", 2))
+}
@@ -0,0 +1,63 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/vkl/go-cast/api"
+)
+
+// Response types the device answers a rejected request with.
+const (
+	ResponseLoadFailed         = "LOAD_FAILED"
+	ResponseLoadCancelled      = "LOAD_CANCELLED"
+	ResponseInvalidRequest     = "INVALID_REQUEST"
+	ResponseInvalidPlayerState = "INVALID_PLAYER_STATE"
+	ResponseLaunchError        = "LAUNCH_ERROR"
+)
+
+var errorResponses = map[string]bool{
+	ResponseLoadFailed:         true,
+	ResponseLoadCancelled:      true,
+	ResponseInvalidRequest:     true,
+	ResponseInvalidPlayerState: true,
+	ResponseLaunchError:        true,
+}
+
+// IsErrorResponse reports whether responseType is the type of a response
+// rejecting a request.
+func IsErrorResponse(responseType string) bool {
+	return errorResponses[responseType]
+}
+
+// ResponseError is returned when the device rejects a request. Type is the
+// response type, one of the Response* constants.
+type ResponseError struct {
+	Op     string
+	Type   string
+	Reason string
+}
+
+func (e *ResponseError) Error() string {
+	if e.Reason != "" {
+		return fmt.Sprintf("%s failed: %s (%s)", e.Op, e.Type, e.Reason)
+	}
+	return fmt.Sprintf("%s failed: %s", e.Op, e.Type)
+}
+
+// checkResponse returns a *ResponseError naming op if message is an error
+// response.
+func checkResponse(op string, message *api.CastMessage) error {
+	response := &struct {
+		Type   string `json:"type"`
+		Reason string `json:"reason"`
+	}{}
+	err := json.Unmarshal([]byte(*message.PayloadUtf8), response)
+	if err != nil {
+		return fmt.Errorf("failed to unmarshal response: %s - %s", err, *message.PayloadUtf8)
+	}
+	if errorResponses[response.Type] {
+		return &ResponseError{Op: op, Type: response.Type, Reason: response.Reason}
+	}
+	return nil
+}
@@ -2,34 +2,71 @@ package controllers
 
 import (
 	"errors"
-	"log"
-	"sync/atomic"
+	"fmt"
+	"sync"
 	"time"
 
 	"golang.org/x/net/context"
 
 	"github.com/vkl/go-cast/api"
 	"github.com/vkl/go-cast/events"
-	_ "github.com/vkl/go-cast/logger"
 	"github.com/vkl/go-cast/net"
 )
 
-const interval = time.Second * 5
-const maxBacklog = 3
+// HeartbeatConfig controls how often the device is pinged and how the link
+// is judged.
+type HeartbeatConfig struct {
+	// Interval between pings.
+	Interval time.Duration
+	// MaxBacklog is the number of consecutive unanswered pings tolerated
+	// before the device is considered gone.
+	MaxBacklog int
+	// LatencyThreshold is the round-trip time above which a LinkDegraded
+	// event is emitted. Zero disables the check.
+	LatencyThreshold time.Duration
+}
+
+var DefaultHeartbeatConfig = HeartbeatConfig{
+	Interval:         time.Second * 5,
+	MaxBacklog:       3,
+	LatencyThreshold: time.Second,
+}
+
+// rttWindow is the number of round-trip samples LinkStats are computed over.
+const rttWindow = 10
+
+// LinkStats summarises the recent PING→PONG round-trip times.
+type LinkStats struct {
+	Samples int
+	Last    time.Duration
+	Mean    time.Duration
+	// Jitter is the mean difference between consecutive samples.
+	Jitter time.Duration
+}
 
 type HeartbeatController struct {
-	pongs    int64
+	config   HeartbeatConfig
 	ticker   *time.Ticker
+	conn     *net.Connection
 	channel  *net.Channel
 	eventsCh chan events.Event
+
+	mu       sync.Mutex
+	sent     []time.Time
+	rtts     []time.Duration
+	degraded bool
 }
 
+const NamespaceHeartbeat = "urn:x-cast:com.google.cast.tp.heartbeat"
+
 var ping = net.PayloadHeaders{Type: "PING"}
 var pong = net.PayloadHeaders{Type: "PONG"}
 
 func NewHeartbeatController(conn *net.Connection, eventsCh chan events.Event, sourceId, destinationId string) *HeartbeatController {
 	controller := &HeartbeatController{
-		channel:  conn.NewChannel(sourceId, destinationId, "urn:x-cast:com.google.cast.tp.heartbeat"),
+		config:   DefaultHeartbeatConfig,
+		conn:     conn,
+		channel:  conn.NewChannel(sourceId, destinationId, NamespaceHeartbeat),
 		eventsCh: eventsCh,
 	}
 
@@ -39,10 +76,41 @@ func NewHeartbeatController(conn *net.Connection, eventsCh chan events.Event, so
 	return controller
 }
 
+// WithDefaults returns the configuration with the unset Interval and
+// MaxBacklog taken from DefaultHeartbeatConfig. An unset LatencyThreshold
+// stays disabled.
+func (c HeartbeatConfig) WithDefaults() HeartbeatConfig {
+	if c.Interval == 0 {
+		c.Interval = DefaultHeartbeatConfig.Interval
+	}
+	if c.MaxBacklog == 0 {
+		c.MaxBacklog = DefaultHeartbeatConfig.MaxBacklog
+	}
+	return c
+}
+
+// Validate returns an error if a field of the configuration is negative.
+func (c HeartbeatConfig) Validate() error {
+	if c.Interval < 0 || c.MaxBacklog < 0 || c.LatencyThreshold < 0 {
+		return fmt.Errorf("invalid heartbeat config: negative interval, backlog or threshold")
+	}
+	return nil
+}
+
+// SetConfig changes the heartbeat configuration, with unset fields taken
+// from the defaults. It takes effect on the next Start.
+func (c *HeartbeatController) SetConfig(config HeartbeatConfig) error {
+	if err := config.Validate(); err != nil {
+		return err
+	}
+	c.config = config.WithDefaults()
+	return nil
+}
+
 func (c *HeartbeatController) onPing(_ *api.CastMessage) {
 	err := c.channel.Send(pong)
 	if err != nil {
-		log.Printf("Error sending pong: %s", err)
+		c.channel.Logger().Warn("error sending pong", "error", err)
 	}
 }
 
@@ -50,12 +118,72 @@ func (c *HeartbeatController) sendEvent(event events.Event) {
 	select {
 	case c.eventsCh <- event:
 	default:
-		log.Printf("Dropped event: %#v", event)
+		c.channel.Logger().Warn("dropped event", "event", fmt.Sprintf("%#v", event))
 	}
 }
 
 func (c *HeartbeatController) onPong(_ *api.CastMessage) {
-	atomic.StoreInt64(&c.pongs, 0)
+	c.mu.Lock()
+	if len(c.sent) == 0 {
+		c.mu.Unlock()
+		return
+	}
+	// a pong answers the latest ping, and shows the link is up however
+	// many earlier pongs were lost
+	rtt := time.Since(c.sent[len(c.sent)-1])
+	c.sent = nil
+	c.rtts = append(c.rtts, rtt)
+	if len(c.rtts) > rttWindow {
+		c.rtts = c.rtts[1:]
+	}
+	stats := computeLinkStats(c.rtts)
+
+	threshold := c.config.LatencyThreshold
+	wasDegraded := c.degraded
+	degraded := threshold > 0 && rtt > threshold
+	c.degraded = degraded
+	c.mu.Unlock()
+	c.channel.Metrics().HeartbeatRTT(rtt)
+
+	if degraded && !wasDegraded {
+		c.channel.Logger().Warn("link degraded", "rtt", rtt, "jitter", stats.Jitter)
+		c.sendEvent(events.LinkDegraded{
+			RTT:       rtt,
+			Jitter:    stats.Jitter,
+			Threshold: threshold,
+		})
+	}
+}
+
+// Stats returns round-trip statistics over the most recent pongs.
+func (c *HeartbeatController) Stats() LinkStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return computeLinkStats(c.rtts)
+}
+
+func computeLinkStats(rtts []time.Duration) LinkStats {
+	stats := LinkStats{Samples: len(rtts)}
+	if len(rtts) == 0 {
+		return stats
+	}
+	var sum, diffs time.Duration
+	for i, rtt := range rtts {
+		sum += rtt
+		if i > 0 {
+			diff := rtt - rtts[i-1]
+			if diff < 0 {
+				diff = -diff
+			}
+			diffs += diff
+		}
+	}
+	stats.Last = rtts[len(rtts)-1]
+	stats.Mean = sum / time.Duration(len(rtts))
+	if len(rtts) > 1 {
+		stats.Jitter = diffs / time.Duration(len(rtts)-1)
+	}
+	return stats
 }
 
 func (c *HeartbeatController) Start(ctx context.Context) error {
@@ -63,34 +191,43 @@ func (c *HeartbeatController) Start(ctx context.Context) error {
 		c.Stop()
 	}
 
-	c.ticker = time.NewTicker(interval)
-	go func() {
+	c.mu.Lock()
+	c.sent = nil
+	c.mu.Unlock()
+
+	c.ticker = time.NewTicker(c.config.Interval)
+	go func(ticker *time.Ticker) {
 	LOOP:
 		for {
 			select {
-			case <-c.ticker.C:
-				if atomic.LoadInt64(&c.pongs) >= maxBacklog {
-					log.Printf("Missed %d pongs", c.pongs)
-					c.sendEvent(events.Disconnected{
-						Reason: errors.New("ping timeout"),
-					})
+			case <-ticker.C:
+				c.mu.Lock()
+				backlog := len(c.sent)
+				c.mu.Unlock()
+				if backlog >= c.config.MaxBacklog {
+					c.channel.Logger().Warn("missed pongs", "count", backlog)
+					// the client learns of the loss from the connection,
+					// which an event could be dropped on the way to
+					c.conn.Fail(errors.New("ping timeout"))
 					break LOOP
 				}
+				c.mu.Lock()
+				c.sent = append(c.sent, time.Now())
+				c.mu.Unlock()
 				err := c.channel.Send(ping)
-				atomic.AddInt64(&c.pongs, 1)
 				if err != nil {
-					log.Printf("Error sending ping: %s", err)
-					c.sendEvent(events.Disconnected{Reason: err})
+					c.channel.Logger().Warn("error sending ping", "error", err)
+					c.conn.Fail(fmt.Errorf("failed to send ping: %w", err))
 					break LOOP
 				}
 			case <-ctx.Done():
-				log.Println("Heartbeat stopped")
+				c.channel.Logger().Debug("heartbeat stopped")
 				break LOOP
 			}
 		}
-	}()
+	}(c.ticker)
 
-	log.Println("Heartbeat started")
+	c.channel.Logger().Debug("heartbeat started")
 	return nil
 }
 
@@ -0,0 +1,87 @@
+package controllers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+
+	"github.com/vkl/go-cast/events"
+	"github.com/vkl/go-cast/net"
+)
+
+func TestComputeLinkStats(t *testing.T) {
+	assert.Equal(t, LinkStats{}, computeLinkStats(nil))
+
+	ms := time.Millisecond
+	stats := computeLinkStats([]time.Duration{10 * ms, 20 * ms, 15 * ms})
+	assert.Equal(t, 3, stats.Samples)
+	assert.Equal(t, 15*ms, stats.Last)
+	assert.Equal(t, 15*ms, stats.Mean)
+	assert.Equal(t, 7500*time.Microsecond, stats.Jitter)
+}
+
+func TestHeartbeatConfig(t *testing.T) {
+	config := HeartbeatConfig{LatencyThreshold: time.Millisecond * 500}.WithDefaults()
+	assert.Equal(t, DefaultHeartbeatConfig.Interval, config.Interval)
+	assert.Equal(t, DefaultHeartbeatConfig.MaxBacklog, config.MaxBacklog)
+	assert.Equal(t, time.Millisecond*500, config.LatencyThreshold)
+
+	controller := &HeartbeatController{}
+	assert.NoError(t, controller.SetConfig(HeartbeatConfig{}))
+	assert.Equal(t, DefaultHeartbeatConfig.Interval, controller.config.Interval)
+	assert.Error(t, controller.SetConfig(HeartbeatConfig{Interval: -time.Second}))
+	assert.Error(t, controller.SetConfig(HeartbeatConfig{MaxBacklog: -1}))
+}
+
+func TestHeartbeatLostPongs(t *testing.T) {
+	pingPong := []net.Record{
+		out(NamespaceHeartbeat, `{"type":"PING"}`),
+		in(NamespaceHeartbeat, `{"type":"PONG"}`),
+	}
+	var records []net.Record
+	for i := 0; i < 3; i++ {
+		// a ping whose pong is lost
+		records = append(records, out(NamespaceHeartbeat, `{"type":"PING"}`))
+		records = append(records, pingPong...)
+	}
+	records = append(records, pingPong...)
+	conn, tap := replay(t, records...)
+
+	interval := time.Millisecond * 30
+	heartbeat := NewHeartbeatController(conn, make(chan events.Event, 16), "sender-0", "receiver-0")
+	assert.NoError(t, heartbeat.SetConfig(HeartbeatConfig{Interval: interval, MaxBacklog: 3}))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	assert.NoError(t, heartbeat.Start(ctx))
+
+	// the ping after the recorded ones
+	tap.Sent(t, NamespaceHeartbeat, "PING", 8)
+	select {
+	case <-conn.Done():
+		t.Fatalf("connection terminated: %v", conn.Err())
+	default:
+	}
+	stats := heartbeat.Stats()
+	assert.Equal(t, 4, stats.Samples)
+	assert.Less(t, stats.Mean, interval/2)
+}
+
+func TestHeartbeatTimeout(t *testing.T) {
+	conn, _ := replay(t)
+	eventsCh := make(chan events.Event)
+	heartbeat := NewHeartbeatController(conn, eventsCh, "sender-0", "receiver-0")
+	assert.NoError(t, heartbeat.SetConfig(HeartbeatConfig{Interval: time.Millisecond * 10, MaxBacklog: 2}))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	assert.NoError(t, heartbeat.Start(ctx))
+
+	// torn down even with nobody reading events
+	select {
+	case <-conn.Done():
+		assert.EqualError(t, conn.Err(), "ping timeout")
+	case <-time.After(time.Second):
+		t.Fatal("connection not terminated")
+	}
+}
@@ -0,0 +1,262 @@
+package controllers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"golang.org/x/net/context"
+)
+
+// HTTPClient is the part of *http.Client used by the YouTube lounge, so a
+// local stand-in server or a fake can be substituted.
+type HTTPClient interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+const YouTubeBaseURL = "https://www.youtube.com"
+
+const (
+	loungeTokenPath = "/api/lounge/pairing/get_lounge_token_batch"
+	loungeBindPath  = "/api/lounge/bc/bind"
+	loungeTokenHdr  = "X-YouTube-LoungeId-Token"
+)
+
+// Lounge playlist actions.
+const (
+	loungeSetPlaylist   = "setPlaylist"
+	loungeAddVideo      = "addVideo"
+	loungeInsertVideo   = "insertVideo"
+	loungeRemoveVideo   = "removeVideo"
+	loungeClearPlaylist = "clearPlaylist"
+)
+
+var (
+	loungeSIDPattern        = regexp.MustCompile(`"c","(.*?)","`)
+	loungeGSessionIdPattern = regexp.MustCompile(`"S","(.*?)"]`)
+)
+
+// ErrLoungeSessionExpired is returned when the lounge rejects a session
+// that could not be re-established.
+var ErrLoungeSessionExpired = errors.New("youtube lounge session expired")
+
+// YouTubeLounge drives the playlist of a YouTube receiver through the
+// YouTube lounge API, identified by the receiver's screen id. The lounge
+// token and bind session are obtained on first use.
+type YouTubeLounge struct {
+	client   HTTPClient
+	baseURL  string
+	screenId string
+	deviceId string
+	name     string
+
+	mu          sync.Mutex
+	loungeToken string
+	sid         string
+	gsessionId  string
+	rid         int
+	ofs         int
+}
+
+type loungeTokenResponse struct {
+	Screens []struct {
+		ScreenId    string `json:"screenId"`
+		LoungeToken string `json:"loungeToken"`
+	} `json:"screens"`
+}
+
+func NewYouTubeLounge(client HTTPClient, baseURL, screenId string) *YouTubeLounge {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return &YouTubeLounge{
+		client:   client,
+		baseURL:  strings.TrimRight(baseURL, "/"),
+		screenId: screenId,
+		deviceId: hex.EncodeToString(b),
+		name:     "go-cast",
+	}
+}
+
+func (l *YouTubeLounge) ScreenId() string {
+	return l.screenId
+}
+
+// SetPlaylist replaces the playlist and plays videoId. listId, if not
+// empty, is a YouTube playlist to continue with.
+func (l *YouTubeLounge) SetPlaylist(ctx context.Context, videoId, listId string) error {
+	return l.action(ctx, loungeSetPlaylist, url.Values{
+		"videoId":      {videoId},
+		"listId":       {listId},
+		"currentTime":  {"0"},
+		"currentIndex": {"-1"},
+		"audioOnly":    {"false"},
+	})
+}
+
+// AddVideo appends a video to the end of the playlist.
+func (l *YouTubeLounge) AddVideo(ctx context.Context, videoId string) error {
+	return l.action(ctx, loungeAddVideo, url.Values{"videoId": {videoId}})
+}
+
+// PlayNext inserts a video after the one currently playing.
+func (l *YouTubeLounge) PlayNext(ctx context.Context, videoId string) error {
+	return l.action(ctx, loungeInsertVideo, url.Values{"videoId": {videoId}})
+}
+
+func (l *YouTubeLounge) RemoveVideo(ctx context.Context, videoId string) error {
+	return l.action(ctx, loungeRemoveVideo, url.Values{"videoId": {videoId}})
+}
+
+func (l *YouTubeLounge) ClearPlaylist(ctx context.Context) error {
+	return l.action(ctx, loungeClearPlaylist, url.Values{})
+}
+
+// Bind obtains a lounge token for the screen and binds a new session.
+func (l *YouTubeLounge) Bind(ctx context.Context) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.bind(ctx)
+}
+
+func (l *YouTubeLounge) bind(ctx context.Context) error {
+	if err := l.getLoungeToken(ctx); err != nil {
+		return err
+	}
+
+	l.rid = 0
+	l.ofs = 0
+	params := l.params()
+	params.Set("device", "REMOTE_CONTROL")
+	params.Set("id", l.deviceId)
+	params.Set("name", l.name)
+	params.Set("mdx-version", "3")
+	params.Set("pairing_type", "cast")
+	params.Set("app", "android-phone-13.14.55")
+
+	body, status, err := l.post(ctx, loungeBindPath+"?"+params.Encode(), url.Values{"count": {"0"}})
+	if err != nil {
+		return fmt.Errorf("failed to bind lounge session: %w", err)
+	}
+	if status != http.StatusOK {
+		return fmt.Errorf("failed to bind lounge session: %s", http.StatusText(status))
+	}
+
+	sid := loungeSIDPattern.FindStringSubmatch(body)
+	gsessionId := loungeGSessionIdPattern.FindStringSubmatch(body)
+	if sid == nil || gsessionId == nil {
+		return errors.New("failed to bind lounge session: no session in response")
+	}
+	l.sid = sid[1]
+	l.gsessionId = gsessionId[1]
+	return nil
+}
+
+func (l *YouTubeLounge) getLoungeToken(ctx context.Context) error {
+	body, status, err := l.post(ctx, loungeTokenPath, url.Values{"screen_ids": {l.screenId}})
+	if err != nil {
+		return fmt.Errorf("failed to get lounge token: %w", err)
+	}
+	if status != http.StatusOK {
+		return fmt.Errorf("failed to get lounge token: %s", http.StatusText(status))
+	}
+
+	response := &loungeTokenResponse{}
+	if err := json.Unmarshal([]byte(body), response); err != nil {
+		return fmt.Errorf("failed to unmarshal lounge token: %s - %s", err, body)
+	}
+	for _, screen := range response.Screens {
+		if screen.ScreenId == l.screenId {
+			l.loungeToken = screen.LoungeToken
+			return nil
+		}
+	}
+	return fmt.Errorf("failed to get lounge token: screen %s not found", l.screenId)
+}
+
+// action sends a single playlist command, binding a session first if
+// needed and once more if the lounge reports the session as expired.
+func (l *YouTubeLounge) action(ctx context.Context, name string, args url.Values) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.sid == "" {
+		if err := l.bind(ctx); err != nil {
+			return err
+		}
+	}
+
+	for attempt := 0; attempt < 2; attempt++ {
+		l.rid++
+		params := l.params()
+		params.Set("SID", l.sid)
+		params.Set("gsessionid", l.gsessionId)
+
+		form := url.Values{
+			"count":    {"1"},
+			"ofs":      {strconv.Itoa(l.ofs)},
+			"req0__sc": {name},
+		}
+		for key, values := range args {
+			form["req0_"+key] = values
+		}
+
+		_, status, err := l.post(ctx, loungeBindPath+"?"+params.Encode(), form)
+		if err != nil {
+			return fmt.Errorf("failed to send %s: %s", name, err)
+		}
+		switch status {
+		case http.StatusOK:
+			l.ofs++
+			return nil
+		case http.StatusBadRequest, http.StatusNotFound, http.StatusGone:
+			if err := l.bind(ctx); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("failed to send %s: %s", name, http.StatusText(status))
+		}
+	}
+	return ErrLoungeSessionExpired
+}
+
+func (l *YouTubeLounge) params() url.Values {
+	return url.Values{
+		"RID":           {strconv.Itoa(l.rid)},
+		"VER":           {"8"},
+		"CVER":          {"1"},
+		"loungeIdToken": {l.loungeToken},
+	}
+}
+
+func (l *YouTubeLounge) post(ctx context.Context, path string, form url.Values) (string, int, error) {
+	req, err := http.NewRequest(http.MethodPost, l.baseURL+path, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", 0, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Origin", YouTubeBaseURL)
+	if l.loungeToken != "" {
+		req.Header.Set(loungeTokenHdr, l.loungeToken)
+	}
+
+	resp, err := l.client.Do(req)
+	if err != nil {
+		return "", 0, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", 0, err
+	}
+	return string(body), resp.StatusCode, nil
+}
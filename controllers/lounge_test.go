@@ -0,0 +1,71 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+)
+
+// loungeServer is a local stand-in for the YouTube lounge API.
+type loungeServer struct {
+	mu       sync.Mutex
+	binds    int
+	actions  []string
+	videoIds []string
+	expire   bool
+}
+
+func (s *loungeServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r.ParseForm()
+
+	switch r.URL.Path {
+	case loungeTokenPath:
+		fmt.Fprintf(w, `{"screens":[{"screenId":%q,"loungeToken":"token-1","expiration":0}]}`, r.PostForm.Get("screen_ids"))
+	case loungeBindPath:
+		if r.URL.Query().Get("loungeIdToken") != "token-1" || r.Header.Get(loungeTokenHdr) != "token-1" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Query().Get("SID") == "" {
+			s.binds++
+			fmt.Fprintf(w, "80\n[[0,[\"c\",\"sid-%d\",\"\",8]]\n,[1,[\"S\",\"gsession-1\"]]\n]", s.binds)
+			return
+		}
+		if s.expire {
+			s.expire = false
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		s.actions = append(s.actions, r.PostForm.Get("req0__sc"))
+		s.videoIds = append(s.videoIds, r.PostForm.Get("req0_videoId"))
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func TestYouTubeLounge(t *testing.T) {
+	stub := &loungeServer{}
+	server := httptest.NewServer(stub)
+	defer server.Close()
+
+	ctx := context.Background()
+	lounge := NewYouTubeLounge(server.Client(), server.URL, "screen-1")
+	assert.NoError(t, lounge.SetPlaylist(ctx, "video-1", ""))
+	assert.NoError(t, lounge.AddVideo(ctx, "video-2"))
+	assert.NoError(t, lounge.PlayNext(ctx, "video-3"))
+
+	stub.expire = true
+	assert.NoError(t, lounge.RemoveVideo(ctx, "video-2"))
+	assert.NoError(t, lounge.ClearPlaylist(ctx))
+
+	assert.Equal(t, 2, stub.binds)
+	assert.Equal(t, []string{"setPlaylist", "addVideo", "insertVideo", "removeVideo", "clearPlaylist"}, stub.actions)
+	assert.Equal(t, []string{"video-1", "video-2", "video-3", "video-2", ""}, stub.videoIds)
+}
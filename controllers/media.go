@@ -2,15 +2,13 @@ package controllers
 
 import (
 	"encoding/json"
-	"errors"
 	"fmt"
-	"log"
+	"sync"
 
 	"golang.org/x/net/context"
 
 	"github.com/vkl/go-cast/api"
 	"github.com/vkl/go-cast/events"
-	_ "github.com/vkl/go-cast/logger"
 	"github.com/vkl/go-cast/net"
 )
 
@@ -35,8 +33,9 @@ type MediaMetadata struct {
 	MetadataType MetadataType `json:"metadataType"`
 	Artist       string       `json:"artist"`
 	Title        string       `json:"title"`
+	AlbumName    string       `json:"albumName,omitempty"`
 	PosterUrl    string       `json:"posterUrl"`
-	Images       []MediaImage
+	Images       []MediaImage `json:"images,omitempty"`
 }
 
 type LoadMediaCommand struct {
@@ -45,13 +44,16 @@ type LoadMediaCommand struct {
 	CurrentTime int         `json:"currentTime"`
 	Autoplay    bool        `json:"autoplay"`
 	CustomData  interface{} `json:"customData"`
+	// ActiveTrackIds are the tracks of the media to enable.
+	ActiveTrackIds []int `json:"activeTrackIds,omitempty"`
 }
 
 type MediaItemQueue struct {
-	Media       MediaItem `json:"media"`
-	Autoplay    bool      `json:"autoplay"`
-	StartTime   int       `json:"startTime"`
-	PreloadTime int       `json:"preloadTime"`
+	Media          MediaItem `json:"media"`
+	Autoplay       bool      `json:"autoplay"`
+	StartTime      int       `json:"startTime"`
+	PreloadTime    int       `json:"preloadTime"`
+	ActiveTrackIds []int     `json:"activeTrackIds,omitempty"`
 }
 
 type QueueMediaCommand struct {
@@ -63,43 +65,176 @@ type QueueMediaCommand struct {
 	CustomData     interface{}      `json:"customData"`
 }
 
+// Stream types of a MediaItem.
+const (
+	StreamTypeBuffered = "BUFFERED"
+	StreamTypeLive     = "LIVE"
+	StreamTypeNone     = "NONE"
+)
+
+// Content types of adaptive streams.
+const (
+	ContentTypeHLS  = "application/x-mpegurl"
+	ContentTypeDASH = "application/dash+xml"
+)
+
+// HLS audio segment formats, for MediaItem.HlsSegmentFormat.
+const (
+	HlsSegmentFormatAAC   = "aac"
+	HlsSegmentFormatAC3   = "ac3"
+	HlsSegmentFormatMP3   = "mp3"
+	HlsSegmentFormatTS    = "ts"
+	HlsSegmentFormatTSAAC = "ts_aac"
+	HlsSegmentFormatEAC3  = "e_ac3"
+	HlsSegmentFormatFMP4  = "fmp4"
+)
+
+// HLS video segment formats, for MediaItem.HlsVideoSegmentFormat.
+const (
+	HlsVideoSegmentFormatMPEG2TS = "mpeg2_ts"
+	HlsVideoSegmentFormatFMP4    = "fmp4"
+)
+
+type QueueLoadCommand struct {
+	net.PayloadHeaders
+	Items      []MediaItemQueue `json:"items"`
+	StartIndex int              `json:"startIndex"`
+	RepeatMode string           `json:"repeatMode"`
+	CustomData interface{}      `json:"customData"`
+}
+
+// Queue repeat modes.
+const (
+	RepeatOff        = "REPEAT_OFF"
+	RepeatAll        = "REPEAT_ALL"
+	RepeatSingle     = "REPEAT_SINGLE"
+	RepeatAllShuffle = "REPEAT_ALL_AND_SHUFFLE"
+)
+
 type MediaItem struct {
 	ContentId   string        `json:"contentId"`
 	StreamType  string        `json:"streamType"`
 	ContentType string        `json:"contentType"`
 	MetaData    MediaMetadata `json:"metadata"`
+	// Duration in seconds, if known. Leave zero for live streams.
+	Duration float64 `json:"duration,omitempty"`
+	// StartAbsoluteTime is the wall-clock start of a live stream, in
+	// seconds since the Unix epoch.
+	StartAbsoluteTime     float64 `json:"startAbsoluteTime,omitempty"`
+	HlsSegmentFormat      string  `json:"hlsSegmentFormat,omitempty"`
+	HlsVideoSegmentFormat string  `json:"hlsVideoSegmentFormat,omitempty"`
+	// Tracks are the side-loaded text tracks of the media, such as
+	// subtitles served as WebVTT.
+	Tracks []MediaTrack `json:"tracks,omitempty"`
+}
+
+func streamType(live bool) string {
+	if live {
+		return StreamTypeLive
+	}
+	return StreamTypeBuffered
+}
+
+// NewHLSMediaItem describes an HLS stream. The segment formats are hints
+// for receivers that cannot detect them; either may be empty.
+func NewHLSMediaItem(url string, live bool, segmentFormat, videoSegmentFormat string) MediaItem {
+	return MediaItem{
+		ContentId:             url,
+		StreamType:            streamType(live),
+		ContentType:           ContentTypeHLS,
+		HlsSegmentFormat:      segmentFormat,
+		HlsVideoSegmentFormat: videoSegmentFormat,
+	}
+}
+
+// NewDASHMediaItem describes a DASH stream.
+func NewDASHMediaItem(url string, live bool) MediaItem {
+	return MediaItem{
+		ContentId:   url,
+		StreamType:  streamType(live),
+		ContentType: ContentTypeDASH,
+	}
+}
+
+func (m MediaItem) IsLive() bool {
+	return m.StreamType == StreamTypeLive
 }
 
 type MediaStatusMedia struct {
-	ContentId   string        `json:"contentId"`
-	StreamType  string        `json:"streamType"`
-	ContentType string        `json:"contentType"`
-	Duration    float64       `json:"duration"`
-	MetaData    MediaMetadata `json:"metadata"`
+	ContentId         string        `json:"contentId"`
+	StreamType        string        `json:"streamType"`
+	ContentType       string        `json:"contentType"`
+	Duration          float64       `json:"duration"`
+	StartAbsoluteTime float64       `json:"startAbsoluteTime,omitempty"`
+	MetaData          MediaMetadata `json:"metadata"`
 }
 
-const NamespaceMedia = "urn:x-cast:com.google.cast.media"
+// LiveSeekableRange is the window of a live stream that can be seeked
+// within, in seconds.
+type LiveSeekableRange struct {
+	Start float64 `json:"start"`
+	End   float64 `json:"end"`
+	// IsMovingWindow is set when the start of the range advances with the
+	// live edge.
+	IsMovingWindow bool `json:"isMovingWindow"`
+	// IsLiveDone is set once the live stream has ended.
+	IsLiveDone bool `json:"isLiveDone"`
+}
 
-var getMediaStatus = net.PayloadHeaders{Type: "GET_STATUS"}
+const NamespaceMedia = "urn:x-cast:com.google.cast.media"
 
 var commandMediaPlay = net.PayloadHeaders{Type: "PLAY"}
 var commandMediaPause = net.PayloadHeaders{Type: "PAUSE"}
 var commandMediaStop = net.PayloadHeaders{Type: "STOP"}
 var commandMediaLoad = net.PayloadHeaders{Type: "LOAD"}
+var commandMediaQueueLoad = net.PayloadHeaders{Type: "QUEUE_LOAD"}
 var commandMediaQueueInsert = net.PayloadHeaders{Type: "QUEUE_INSERT"}
 var commandMediaQueueNext = net.PayloadHeaders{Type: "QUEUE_NEXT"}
 var commandMediaQueuePrev = net.PayloadHeaders{Type: "QUEUE_PREV"}
+var commandMediaQueueUpdate = net.PayloadHeaders{Type: "QUEUE_UPDATE"}
+var commandMediaSeek = net.PayloadHeaders{Type: "SEEK"}
+var commandMediaSetVolume = net.PayloadHeaders{Type: "SET_VOLUME"}
+var commandMediaSetPlaybackRate = net.PayloadHeaders{Type: "SET_PLAYBACK_RATE"}
 
 type MediaCommand struct {
 	net.PayloadHeaders
 	MediaSessionID int `json:"mediaSessionId"`
 }
 
+type SeekCommand struct {
+	net.PayloadHeaders
+	MediaSessionID int     `json:"mediaSessionId"`
+	CurrentTime    float64 `json:"currentTime"`
+}
+
+type StreamVolumeCommand struct {
+	net.PayloadHeaders
+	MediaSessionID int    `json:"mediaSessionId"`
+	Volume         Volume `json:"volume"`
+}
+
+type PlaybackRateCommand struct {
+	net.PayloadHeaders
+	MediaSessionID int     `json:"mediaSessionId"`
+	PlaybackRate   float64 `json:"playbackRate"`
+}
+
+type QueueUpdateCommand struct {
+	net.PayloadHeaders
+	MediaSessionID int    `json:"mediaSessionId"`
+	RepeatMode     string `json:"repeatMode,omitempty"`
+	Shuffle        bool   `json:"shuffle,omitempty"`
+}
+
 type MediaController struct {
 	channel        *net.Channel
 	eventsCh       chan events.Event
 	DestinationID  string
 	MediaSessionID int
+
+	mu        sync.Mutex
+	supported *MediaCommands
+	status    *MediaStatus
 }
 
 func NewMediaController(
@@ -128,22 +263,29 @@ func (c *MediaController) sendEvent(event events.Event) {
 	select {
 	case c.eventsCh <- event:
 	default:
-		log.Printf("Dropped event: %#v", event)
+		c.channel.Logger().Warn("dropped event", "event", fmt.Sprintf("%#v", event))
 	}
 }
 
 func (c *MediaController) onStatus(message *api.CastMessage) {
 	response, err := c.parseStatus(message)
 	if err != nil {
-		log.Printf("Error parsing status: %s", err)
+		c.channel.Logger().Warn("error parsing status", "error", err)
+		return
 	}
 
 	for _, status := range response.Status {
+		c.channel.Metrics().PlayerState(status.PlayerState)
 		event := events.MediaStatusUpdated{
 			PlayerState: (*status).PlayerState,
+			IdleReason:  status.IdleReason,
 			CurrentTime: (*status).CurrentTime,
+			IsLive:      status.IsLive(),
+
+			SupportedCommands: status.SupportedMediaCommands.Names(),
 		}
 		if status.Media != nil {
+			event.Duration = status.Media.Duration
 			event.MetaData = new(string)
 			*(event.MetaData) = fmt.Sprintf(
 				"%s : %s", status.Media.MetaData.Artist, status.Media.MetaData.Title)
@@ -163,11 +305,59 @@ func (c *MediaController) parseStatus(message *api.CastMessage) (*MediaStatusRes
 
 	for _, status := range response.Status {
 		c.MediaSessionID = status.MediaSessionID
+		c.setSupportedCommands(status.SupportedMediaCommands)
+		c.setStatus(status)
 	}
 
 	return response, nil
 }
 
+// setStatus records the latest status. Receivers only send the queue items
+// when they change, so they are carried over within a media session.
+func (c *MediaController) setStatus(status *MediaStatus) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(status.Items) == 0 && c.status != nil && c.status.MediaSessionID == status.MediaSessionID {
+		status.Items = c.status.Items
+	}
+	c.status = status
+}
+
+// Status returns the last media status received, or nil.
+func (c *MediaController) Status() *MediaStatus {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.status
+}
+
+func (c *MediaController) setSupportedCommands(commands MediaCommands) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.supported = &commands
+}
+
+// SupportedCommands returns the commands the current app accepts, as of
+// the last media status. ok is false until a status has been received.
+func (c *MediaController) SupportedCommands() (commands MediaCommands, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.supported == nil {
+		return 0, false
+	}
+	return *c.supported, true
+}
+
+// require returns an *UnsupportedCommandError when the last media status
+// says the app doesn't accept command. Without a status nothing is refused
+// and the device gets to decide.
+func (c *MediaController) require(command MediaCommands) error {
+	supported, ok := c.SupportedCommands()
+	if !ok || supported.Has(command) {
+		return nil
+	}
+	return &UnsupportedCommandError{Command: command, Supported: supported}
+}
+
 type MediaStatusResponse struct {
 	net.PayloadHeaders
 	Status []*MediaStatus `json:"status,omitempty"`
@@ -179,12 +369,55 @@ type MediaStatus struct {
 	PlaybackRate           float64                `json:"playbackRate"`
 	PlayerState            string                 `json:"playerState"`
 	CurrentTime            float64                `json:"currentTime"`
-	SupportedMediaCommands int                    `json:"supportedMediaCommands"`
+	SupportedMediaCommands MediaCommands          `json:"supportedMediaCommands"`
 	Volume                 *Volume                `json:"volume,omitempty"`
 	Media                  *MediaStatusMedia      `json:"media"`
 	CustomData             map[string]interface{} `json:"customData"`
 	RepeatMode             string                 `json:"repeatMode"`
 	IdleReason             string                 `json:"idleReason"`
+	LiveSeekableRange      *LiveSeekableRange     `json:"liveSeekableRange,omitempty"`
+	CurrentItemID          int                    `json:"currentItemId,omitempty"`
+	Items                  []*QueueItem           `json:"items,omitempty"`
+}
+
+// QueueItem is an entry of the media queue.
+type QueueItem struct {
+	ItemID    int               `json:"itemId"`
+	Media     *MediaStatusMedia `json:"media,omitempty"`
+	Autoplay  bool              `json:"autoplay"`
+	StartTime float64           `json:"startTime"`
+}
+
+// CurrentItem returns the queue item being played, or nil.
+func (s *MediaStatus) CurrentItem() *QueueItem {
+	for _, item := range s.Items {
+		if item.ItemID == s.CurrentItemID {
+			return item
+		}
+	}
+	return nil
+}
+
+// IsLive reports whether the current media is a live stream that hasn't
+// ended.
+func (s *MediaStatus) IsLive() bool {
+	if s.LiveSeekableRange != nil {
+		return !s.LiveSeekableRange.IsLiveDone
+	}
+	return s.Media != nil && s.Media.StreamType == StreamTypeLive
+}
+
+// request sends a media command, failing with a *ResponseError if the
+// device rejects it.
+func (c *MediaController) request(ctx context.Context, op string, payload net.Payload) (*api.CastMessage, error) {
+	message, err := c.channel.Request(ctx, payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send %s command: %w", op, err)
+	}
+	if err := checkResponse(op, message); err != nil {
+		return nil, err
+	}
+	return message, nil
 }
 
 func (c *MediaController) Start(ctx context.Context) error {
@@ -193,44 +426,97 @@ func (c *MediaController) Start(ctx context.Context) error {
 }
 
 func (c *MediaController) GetStatus(ctx context.Context) (*MediaStatusResponse, error) {
-	message, err := c.channel.Request(ctx, &getMediaStatus)
+	message, err := c.channel.Request(ctx, &net.PayloadHeaders{Type: "GET_STATUS"})
 	if err != nil {
-		return nil, fmt.Errorf("failed to get receiver status: %s", err)
+		return nil, fmt.Errorf("failed to get receiver status: %w", err)
 	}
 
 	return c.parseStatus(message)
 }
 
 func (c *MediaController) Play(ctx context.Context) (*api.CastMessage, error) {
-	message, err := c.channel.Request(ctx, &MediaCommand{commandMediaPlay, c.MediaSessionID})
-	if err != nil {
-		return nil, fmt.Errorf("failed to send play command: %s", err)
-	}
-	return message, nil
+	return c.request(ctx, "play", &MediaCommand{commandMediaPlay, c.MediaSessionID})
 }
 
 func (c *MediaController) QueueNext(ctx context.Context) (*api.CastMessage, error) {
-	message, err := c.channel.Request(ctx, &MediaCommand{commandMediaQueueNext, c.MediaSessionID})
-	if err != nil {
-		return nil, fmt.Errorf("failed to send queue next command: %s", err)
+	if err := c.require(CommandQueueNext); err != nil {
+		return nil, err
 	}
-	return message, nil
+	return c.request(ctx, "queue next", &MediaCommand{commandMediaQueueNext, c.MediaSessionID})
 }
 
 func (c *MediaController) QueuePrev(ctx context.Context) (*api.CastMessage, error) {
-	message, err := c.channel.Request(ctx, &MediaCommand{commandMediaQueuePrev, c.MediaSessionID})
-	if err != nil {
-		return nil, fmt.Errorf("failed to send queue prev command: %s", err)
+	if err := c.require(CommandQueuePrev); err != nil {
+		return nil, err
 	}
-	return message, nil
+	return c.request(ctx, "queue prev", &MediaCommand{commandMediaQueuePrev, c.MediaSessionID})
 }
 
 func (c *MediaController) Pause(ctx context.Context) (*api.CastMessage, error) {
-	message, err := c.channel.Request(ctx, &MediaCommand{commandMediaPause, c.MediaSessionID})
-	if err != nil {
-		return nil, fmt.Errorf("failed to send pause command: %s", err)
+	if err := c.require(CommandPause); err != nil {
+		return nil, err
 	}
-	return message, nil
+	return c.request(ctx, "pause", &MediaCommand{commandMediaPause, c.MediaSessionID})
+}
+
+// Seek moves playback to position, in seconds.
+func (c *MediaController) Seek(ctx context.Context, position float64) (*api.CastMessage, error) {
+	if err := c.require(CommandSeek); err != nil {
+		return nil, err
+	}
+	return c.request(ctx, "seek", &SeekCommand{commandMediaSeek, c.MediaSessionID, position})
+}
+
+// SetStreamVolume sets the volume of the media stream, as opposed to the
+// device volume set through the receiver.
+func (c *MediaController) SetStreamVolume(ctx context.Context, level float64) (*api.CastMessage, error) {
+	if err := c.require(CommandStreamVolume); err != nil {
+		return nil, err
+	}
+	command := &StreamVolumeCommand{commandMediaSetVolume, c.MediaSessionID, Volume{Level: &level}}
+	return c.request(ctx, "stream volume", command)
+}
+
+// SetStreamMuted mutes or unmutes the media stream.
+func (c *MediaController) SetStreamMuted(ctx context.Context, muted bool) (*api.CastMessage, error) {
+	if err := c.require(CommandStreamMute); err != nil {
+		return nil, err
+	}
+	command := &StreamVolumeCommand{commandMediaSetVolume, c.MediaSessionID, Volume{Muted: &muted}}
+	return c.request(ctx, "stream mute", command)
+}
+
+func (c *MediaController) SetPlaybackRate(ctx context.Context, rate float64) (*api.CastMessage, error) {
+	if err := c.require(CommandPlaybackRate); err != nil {
+		return nil, err
+	}
+	return c.request(ctx, "playback rate", &PlaybackRateCommand{commandMediaSetPlaybackRate, c.MediaSessionID, rate})
+}
+
+// QueueShuffle shuffles the items of the queue.
+func (c *MediaController) QueueShuffle(ctx context.Context) (*api.CastMessage, error) {
+	if err := c.require(CommandQueueShuffle); err != nil {
+		return nil, err
+	}
+	command := &QueueUpdateCommand{PayloadHeaders: commandMediaQueueUpdate, MediaSessionID: c.MediaSessionID, Shuffle: true}
+	return c.request(ctx, "queue shuffle", command)
+}
+
+// SetRepeatMode changes the repeat mode of the queue to one of the Repeat*
+// constants.
+func (c *MediaController) SetRepeatMode(ctx context.Context, mode string) (*api.CastMessage, error) {
+	switch mode {
+	case RepeatAll, RepeatAllShuffle:
+		if err := c.require(CommandQueueRepeatAll); err != nil {
+			return nil, err
+		}
+	case RepeatSingle:
+		if err := c.require(CommandQueueRepeatOne); err != nil {
+			return nil, err
+		}
+	}
+	command := &QueueUpdateCommand{PayloadHeaders: commandMediaQueueUpdate, MediaSessionID: c.MediaSessionID, RepeatMode: mode}
+	return c.request(ctx, "repeat mode", command)
 }
 
 func (c *MediaController) Stop(ctx context.Context) (*api.CastMessage, error) {
@@ -238,11 +524,7 @@ func (c *MediaController) Stop(ctx context.Context) (*api.CastMessage, error) {
 		// no current session to stop
 		return nil, nil
 	}
-	message, err := c.channel.Request(ctx, &MediaCommand{commandMediaStop, c.MediaSessionID})
-	if err != nil {
-		return nil, fmt.Errorf("failed to send stop command: %s", err)
-	}
-	return message, nil
+	return c.request(ctx, "stop", &MediaCommand{commandMediaStop, c.MediaSessionID})
 }
 
 func (c *MediaController) LoadMedia(
@@ -259,17 +541,34 @@ func (c *MediaController) LoadMedia(
 		Autoplay:       autoplay,
 		CustomData:     customData,
 	}
-	message, err := c.channel.Request(ctx, command)
-	if err != nil {
-		return nil, fmt.Errorf("failed to send load command: %s", err)
+	return c.request(ctx, "load", command)
+}
+
+// QueueLoad replaces the queue with items and starts playing the one at
+// startIndex.
+func (c *MediaController) QueueLoad(
+	ctx context.Context,
+	mediaItems []MediaItemQueue,
+	startIndex int,
+	repeatMode string,
+	customData interface{}) (*api.CastMessage, error) {
+	if repeatMode == "" {
+		repeatMode = RepeatOff
 	}
-	response := &net.PayloadHeaders{}
-	err = json.Unmarshal([]byte(*message.PayloadUtf8), response)
+	command := &QueueLoadCommand{
+		PayloadHeaders: commandMediaQueueLoad,
+		Items:          mediaItems,
+		StartIndex:     startIndex,
+		RepeatMode:     repeatMode,
+		CustomData:     customData,
+	}
+	message, err := c.request(ctx, "queue load", command)
 	if err != nil {
 		return nil, err
 	}
-	if response.Type == "LOAD_FAILED" {
-		return nil, errors.New("load media failed")
+	// pick up the new media session before further queue commands
+	if _, err := c.parseStatus(message); err != nil {
+		return nil, err
 	}
 
 	return message, nil
@@ -293,18 +592,5 @@ func (c *MediaController) QueueInsert(
 		Autoplay:       autoplay,
 		CustomData:     customData,
 	}
-	message, err := c.channel.Request(ctx, command)
-	if err != nil {
-		return nil, fmt.Errorf("failed to send queue insert command: %s", err)
-	}
-	response := &net.PayloadHeaders{}
-	err = json.Unmarshal([]byte(*message.PayloadUtf8), response)
-	if err != nil {
-		return nil, err
-	}
-	if response.Type == "LOAD_FAILED" {
-		return nil, errors.New("queue insert media failed")
-	}
-
-	return message, nil
+	return c.request(ctx, "queue insert", command)
 }
@@ -0,0 +1,95 @@
+package controllers
+
+import (
+	"fmt"
+	"strings"
+)
+
+// MediaCommands is the supportedMediaCommands bitmask of a MediaStatus,
+// telling which commands the current app accepts.
+type MediaCommands int
+
+const (
+	CommandPause MediaCommands = 1 << iota
+	CommandSeek
+	CommandStreamVolume
+	CommandStreamMute
+	CommandSkipForward
+	CommandSkipBackward
+	CommandQueueNext
+	CommandQueuePrev
+	CommandQueueShuffle
+	CommandSkipAd
+	CommandQueueRepeatAll
+	CommandQueueRepeatOne
+	CommandEditTracks
+	CommandPlaybackRate
+
+	// CommandQueueRepeat is set when both repeat modes are supported.
+	CommandQueueRepeat = CommandQueueRepeatAll | CommandQueueRepeatOne
+)
+
+var mediaCommandNames = []struct {
+	command MediaCommands
+	name    string
+}{
+	{CommandPause, "pause"},
+	{CommandSeek, "seek"},
+	{CommandStreamVolume, "stream_volume"},
+	{CommandStreamMute, "stream_mute"},
+	{CommandSkipForward, "skip_forward"},
+	{CommandSkipBackward, "skip_backward"},
+	{CommandQueueNext, "queue_next"},
+	{CommandQueuePrev, "queue_prev"},
+	{CommandQueueShuffle, "queue_shuffle"},
+	{CommandSkipAd, "skip_ad"},
+	{CommandQueueRepeatAll, "queue_repeat_all"},
+	{CommandQueueRepeatOne, "queue_repeat_one"},
+	{CommandEditTracks, "edit_tracks"},
+	{CommandPlaybackRate, "playback_rate"},
+}
+
+// Has reports whether every command in c is supported.
+func (m MediaCommands) Has(c MediaCommands) bool {
+	return m&c == c
+}
+
+// Names returns the names of the supported commands, in bit order.
+func (m MediaCommands) Names() []string {
+	names := []string{}
+	for _, entry := range mediaCommandNames {
+		if m.Has(entry.command) {
+			names = append(names, entry.name)
+		}
+	}
+	return names
+}
+
+func (m MediaCommands) String() string {
+	var names []string
+	rest := m
+	for _, entry := range mediaCommandNames {
+		if m.Has(entry.command) {
+			names = append(names, entry.name)
+			rest &^= entry.command
+		}
+	}
+	if rest != 0 {
+		names = append(names, fmt.Sprintf("0x%x", int(rest)))
+	}
+	if len(names) == 0 {
+		return "none"
+	}
+	return strings.Join(names, "|")
+}
+
+// UnsupportedCommandError is returned by MediaController when the current
+// app doesn't support a command, without sending it to the device.
+type UnsupportedCommandError struct {
+	Command   MediaCommands
+	Supported MediaCommands
+}
+
+func (e *UnsupportedCommandError) Error() string {
+	return fmt.Sprintf("media command %s is not supported by the current app", e.Command)
+}
@@ -0,0 +1,113 @@
+package controllers
+
+import (
+	"encoding/json"
+	"testing"
+
+	"golang.org/x/net/context"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/vkl/go-cast/api"
+)
+
+func TestLiveMediaItem(t *testing.T) {
+	item := NewHLSMediaItem("http://radio/live.m3u8", true, HlsSegmentFormatAAC, "")
+	assert.True(t, item.IsLive())
+
+	data, err := json.Marshal(item)
+	assert.NoError(t, err)
+	var fields map[string]interface{}
+	assert.NoError(t, json.Unmarshal(data, &fields))
+	assert.Equal(t, "LIVE", fields["streamType"])
+	assert.Equal(t, "aac", fields["hlsSegmentFormat"])
+	assert.NotContains(t, fields, "hlsVideoSegmentFormat")
+	assert.NotContains(t, fields, "duration")
+
+	assert.False(t, NewDASHMediaItem("http://cdn/movie.mpd", false).IsLive())
+}
+
+func TestMediaStatusIsLive(t *testing.T) {
+	status := &MediaStatus{}
+	assert.NoError(t, json.Unmarshal([]byte(`{"mediaSessionId":1,"playerState":"PLAYING",
+		"media":{"contentId":"x","streamType":"LIVE"},
+		"liveSeekableRange":{"start":10,"end":130,"isMovingWindow":true,"isLiveDone":false}}`), status))
+	assert.True(t, status.IsLive())
+	assert.Equal(t, 130.0, status.LiveSeekableRange.End)
+
+	status.LiveSeekableRange.IsLiveDone = true
+	assert.False(t, status.IsLive())
+}
+
+func TestMediaCommands(t *testing.T) {
+	status := &MediaStatus{}
+	assert.NoError(t, json.Unmarshal([]byte(`{"mediaSessionId":1,"supportedMediaCommands":11279}`), status))
+	commands := status.SupportedMediaCommands
+	assert.True(t, commands.Has(CommandPause|CommandSeek))
+	assert.True(t, commands.Has(CommandQueueRepeat))
+	assert.False(t, commands.Has(CommandQueueShuffle))
+	assert.Equal(t, []string{"pause", "seek", "stream_volume", "stream_mute",
+		"queue_repeat_all", "queue_repeat_one", "playback_rate"}, commands.Names())
+	assert.Equal(t, "none", MediaCommands(0).String())
+	assert.Equal(t, "pause|0x8000", MediaCommands(1|1<<15).String())
+}
+
+func TestMediaControllerRefusesUnsupportedCommands(t *testing.T) {
+	controller := &MediaController{}
+	// nothing is refused before the first status
+	assert.NoError(t, controller.require(CommandQueueNext))
+
+	controller.setSupportedCommands(CommandPause | CommandSeek)
+	_, err := controller.QueueNext(context.Background())
+	assert.IsType(t, &UnsupportedCommandError{}, err)
+	assert.Equal(t, CommandQueueNext, err.(*UnsupportedCommandError).Command)
+	_, err = controller.SetRepeatMode(context.Background(), RepeatSingle)
+	assert.Error(t, err)
+	assert.NoError(t, controller.require(CommandSeek))
+}
+
+func TestMediaStatusQueue(t *testing.T) {
+	controller := &MediaController{}
+	controller.setStatus(&MediaStatus{MediaSessionID: 1, CurrentItemID: 2, Items: []*QueueItem{
+		{ItemID: 1, Media: &MediaStatusMedia{ContentId: "a.mp3"}},
+		{ItemID: 2, Media: &MediaStatusMedia{ContentId: "b.mp3"}},
+	}})
+	// items are carried over while the session lasts
+	controller.setStatus(&MediaStatus{MediaSessionID: 1, CurrentItemID: 1})
+	status := controller.Status()
+	assert.Len(t, status.Items, 2)
+	assert.Equal(t, "a.mp3", status.CurrentItem().Media.ContentId)
+
+	controller.setStatus(&MediaStatus{MediaSessionID: 2})
+	assert.Nil(t, controller.Status().CurrentItem())
+}
+
+func TestCheckResponse(t *testing.T) {
+	payload := `{"type":"INVALID_REQUEST","requestId":3,"reason":"INVALID_MEDIA_SESSION_ID"}`
+	err := checkResponse("seek", &api.CastMessage{PayloadUtf8: &payload})
+	assert.Equal(t, &ResponseError{Op: "seek", Type: ResponseInvalidRequest, Reason: "INVALID_MEDIA_SESSION_ID"}, err)
+	assert.EqualError(t, err, "seek failed: INVALID_REQUEST (INVALID_MEDIA_SESSION_ID)")
+
+	payload = `{"type":"MEDIA_STATUS","requestId":3,"status":[]}`
+	assert.NoError(t, checkResponse("seek", &api.CastMessage{PayloadUtf8: &payload}))
+}
+
+func TestMediaItemTextTracks(t *testing.T) {
+	item := MediaItem{ContentId: "http://host/movie.mp4", Tracks: []MediaTrack{
+		NewTextTrack(1, "http://host/movie.en.vtt", "English", "en"),
+	}}
+	data, err := json.Marshal(LoadMediaCommand{Media: item, ActiveTrackIds: []int{1}})
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), `"tracks":[{"trackId":1,"type":"TEXT","subtype":"SUBTITLES",`+
+		`"trackContentId":"http://host/movie.en.vtt","trackContentType":"text/vtt","name":"English","language":"en"}]`)
+	assert.Contains(t, string(data), `"activeTrackIds":[1]`)
+
+	data, err = json.Marshal(MediaItem{ContentId: "a.mp3"})
+	assert.NoError(t, err)
+	assert.NotContains(t, string(data), "tracks")
+
+	controller := &MediaController{}
+	controller.setSupportedCommands(CommandPause)
+	_, err = controller.SetActiveTracks(context.Background(), nil)
+	assert.IsType(t, &UnsupportedCommandError{}, err)
+}
@@ -0,0 +1,66 @@
+package controllers
+
+import (
+	"golang.org/x/net/context"
+
+	"github.com/vkl/go-cast/api"
+	"github.com/vkl/go-cast/net"
+)
+
+// Track types and text track subtypes of a MediaTrack.
+const (
+	TrackTypeText  = "TEXT"
+	TrackTypeAudio = "AUDIO"
+	TrackTypeVideo = "VIDEO"
+
+	TextTrackSubtitles    = "SUBTITLES"
+	TextTrackCaptions     = "CAPTIONS"
+	TextTrackDescriptions = "DESCRIPTIONS"
+	TextTrackChapters     = "CHAPTERS"
+	TextTrackMetadata     = "METADATA"
+)
+
+// MediaTrack is a track of a MediaItem. Text tracks are loaded by the
+// receiver from TrackContentId, which must allow cross-origin requests.
+type MediaTrack struct {
+	TrackId          int    `json:"trackId"`
+	Type             string `json:"type"`
+	Subtype          string `json:"subtype,omitempty"`
+	TrackContentId   string `json:"trackContentId,omitempty"`
+	TrackContentType string `json:"trackContentType,omitempty"`
+	Name             string `json:"name,omitempty"`
+	Language         string `json:"language,omitempty"`
+}
+
+// NewTextTrack returns a WebVTT subtitle track served at url.
+func NewTextTrack(id int, url, name, language string) MediaTrack {
+	return MediaTrack{
+		TrackId:          id,
+		Type:             TrackTypeText,
+		Subtype:          TextTrackSubtitles,
+		TrackContentId:   url,
+		TrackContentType: "text/vtt",
+		Name:             name,
+		Language:         language,
+	}
+}
+
+var commandMediaEditTracksInfo = net.PayloadHeaders{Type: "EDIT_TRACKS_INFO"}
+
+type EditTracksInfoCommand struct {
+	net.PayloadHeaders
+	MediaSessionID int   `json:"mediaSessionId"`
+	ActiveTrackIds []int `json:"activeTrackIds"`
+}
+
+// SetActiveTracks enables the tracks with the given ids and disables the
+// others, such as to switch subtitles on or off.
+func (c *MediaController) SetActiveTracks(ctx context.Context, ids []int) (*api.CastMessage, error) {
+	if err := c.require(CommandEditTracks); err != nil {
+		return nil, err
+	}
+	if ids == nil {
+		ids = []int{}
+	}
+	return c.request(ctx, "edit tracks", &EditTracksInfoCommand{commandMediaEditTracksInfo, c.MediaSessionID, ids})
+}
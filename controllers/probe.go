@@ -0,0 +1,261 @@
+package controllers
+
+import (
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	"golang.org/x/net/context"
+
+	"github.com/vkl/go-cast/api"
+)
+
+const (
+	ContentTypeSmoothStreaming = "application/vnd.ms-sstr+xml"
+	contentTypeOctetStream     = "application/octet-stream"
+)
+
+// probeSize is the number of bytes fetched to sniff a content type.
+const probeSize = 512
+
+// contentTypesByExtension maps file extensions to content types, including
+// formats the Default Media Receiver cannot play so they can be rejected
+// with a clear error.
+var contentTypesByExtension = map[string]string{
+	".aac":  "audio/aac",
+	".flac": "audio/flac",
+	".m4a":  "audio/mp4",
+	".mp3":  "audio/mpeg",
+	".oga":  "audio/ogg",
+	".ogg":  "audio/ogg",
+	".opus": "audio/ogg",
+	".wav":  "audio/wav",
+	".weba": "audio/webm",
+	".wma":  "audio/x-ms-wma",
+	".m4v":  "video/mp4",
+	".mp4":  "video/mp4",
+	".ts":   "video/mp2t",
+	".webm": "video/webm",
+	".avi":  "video/x-msvideo",
+	".flv":  "video/x-flv",
+	".mkv":  "video/x-matroska",
+	".mov":  "video/quicktime",
+	".wmv":  "video/x-ms-wmv",
+	".m3u8": ContentTypeHLS,
+	".mpd":  ContentTypeDASH,
+	".ism":  ContentTypeSmoothStreaming,
+	".bmp":  "image/bmp",
+	".gif":  "image/gif",
+	".jpeg": "image/jpeg",
+	".jpg":  "image/jpeg",
+	".png":  "image/png",
+	".webp": "image/webp",
+}
+
+// contentTypeAliases normalises alternative names of the same format.
+var contentTypeAliases = map[string]string{
+	"application/vnd.apple.mpegurl": ContentTypeHLS,
+	"audio/mpegurl":                 ContentTypeHLS,
+	"audio/x-mpegurl":               ContentTypeHLS,
+	"audio/mp3":                     "audio/mpeg",
+	"audio/x-flac":                  "audio/flac",
+	"audio/x-wav":                   "audio/wav",
+	"audio/wave":                    "audio/wav",
+	"audio/x-m4a":                   "audio/mp4",
+	"application/ogg":               "audio/ogg",
+}
+
+// supportedContentTypes are the formats the Default Media Receiver plays.
+var supportedContentTypes = map[string]bool{
+	"audio/aac":                true,
+	"audio/flac":               true,
+	"audio/mp4":                true,
+	"audio/mpeg":               true,
+	"audio/ogg":                true,
+	"audio/wav":                true,
+	"audio/webm":               true,
+	"video/mp4":                true,
+	"video/mp2t":               true,
+	"video/webm":               true,
+	ContentTypeHLS:             true,
+	ContentTypeDASH:            true,
+	ContentTypeSmoothStreaming: true,
+	"image/bmp":                true,
+	"image/gif":                true,
+	"image/jpeg":               true,
+	"image/png":                true,
+	"image/webp":               true,
+}
+
+// UnsupportedFormatError is returned when media is in a format the Default
+// Media Receiver cannot play.
+type UnsupportedFormatError struct {
+	URL         string
+	ContentType string
+}
+
+func (e *UnsupportedFormatError) Error() string {
+	if e.ContentType == "" {
+		return fmt.Sprintf("cannot determine the content type of %s", e.URL)
+	}
+	return fmt.Sprintf("%s is %s, which the Default Media Receiver cannot play", e.URL, e.ContentType)
+}
+
+// ContentProbe works out how to load a media URL: its content type, from
+// the extension or by probing the server, a stream type and a metadata
+// type.
+type ContentProbe struct {
+	// Client is used for HEAD and range requests. Defaults to
+	// http.DefaultClient.
+	Client *http.Client
+	// AlwaysProbe queries the server even if the extension is known.
+	AlwaysProbe bool
+}
+
+// Probe returns a MediaItem for mediaURL, or an UnsupportedFormatError.
+func (p *ContentProbe) Probe(ctx context.Context, mediaURL string) (MediaItem, error) {
+	item := MediaItem{
+		ContentId:  mediaURL,
+		StreamType: StreamTypeBuffered,
+	}
+
+	u, err := url.Parse(mediaURL)
+	if err != nil {
+		return item, err
+	}
+	contentType := contentTypesByExtension[strings.ToLower(path.Ext(u.Path))]
+	live := false
+	if (contentType == "" || p.AlwaysProbe) && (u.Scheme == "http" || u.Scheme == "https") {
+		probed, isLive, err := p.probe(ctx, mediaURL)
+		if err != nil && contentType == "" {
+			return item, fmt.Errorf("failed to probe %s: %s", mediaURL, err)
+		}
+		if probed != "" {
+			contentType = probed
+		}
+		live = isLive
+	}
+
+	contentType = normaliseContentType(contentType)
+	if !supportedContentTypes[contentType] {
+		return item, &UnsupportedFormatError{URL: mediaURL, ContentType: contentType}
+	}
+
+	item.ContentType = contentType
+	if live {
+		item.StreamType = StreamTypeLive
+	}
+	item.MetaData = MediaMetadata{
+		MetadataType: metadataTypeOf(contentType),
+		Title:        path.Base(u.Path),
+	}
+	return item, nil
+}
+
+// probe asks the server for the content type, with a HEAD request and, if
+// that is inconclusive, by sniffing the first bytes. It also reports
+// whether the resource looks like an endless stream, such as internet
+// radio.
+func (p *ContentProbe) probe(ctx context.Context, mediaURL string) (string, bool, error) {
+	client := p.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	req, err := http.NewRequest(http.MethodHead, mediaURL, nil)
+	if err != nil {
+		return "", false, err
+	}
+	resp, err := client.Do(req.WithContext(ctx))
+	if err == nil {
+		resp.Body.Close()
+		if resp.StatusCode == http.StatusOK {
+			contentType := normaliseContentType(resp.Header.Get("Content-Type"))
+			if contentType != "" && contentType != contentTypeOctetStream {
+				return contentType, isStream(resp, contentType), nil
+			}
+		}
+	}
+
+	req, err = http.NewRequest(http.MethodGet, mediaURL, nil)
+	if err != nil {
+		return "", false, err
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=0-%d", probeSize-1))
+	resp, err = client.Do(req.WithContext(ctx))
+	if err != nil {
+		return "", false, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusPartialContent {
+		return "", false, fmt.Errorf("%s", resp.Status)
+	}
+
+	contentType := normaliseContentType(resp.Header.Get("Content-Type"))
+	if contentType == "" || contentType == contentTypeOctetStream {
+		head, _ := io.ReadAll(io.LimitReader(resp.Body, probeSize))
+		contentType = normaliseContentType(http.DetectContentType(head))
+	}
+	return contentType, isStream(resp, contentType), nil
+}
+
+// isStream guesses that audio without a length, or served by an Icecast
+// or Shoutcast server, is a live stream.
+func isStream(resp *http.Response, contentType string) bool {
+	if resp.Header.Get("Icy-Name") != "" || resp.Header.Get("Icy-Metaint") != "" {
+		return true
+	}
+	return strings.HasPrefix(contentType, "audio/") &&
+		resp.ContentLength < 0 && resp.Header.Get("Content-Range") == ""
+}
+
+// ContentTypeOf returns the content type of a file from its extension,
+// and whether the Default Media Receiver can play it.
+func ContentTypeOf(name string) (contentType string, supported bool) {
+	contentType = normaliseContentType(contentTypesByExtension[strings.ToLower(path.Ext(name))])
+	return contentType, supportedContentTypes[contentType]
+}
+
+func normaliseContentType(contentType string) string {
+	if contentType == "" {
+		return ""
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return strings.ToLower(contentType)
+	}
+	if alias, ok := contentTypeAliases[mediaType]; ok {
+		return alias
+	}
+	return mediaType
+}
+
+func metadataTypeOf(contentType string) MetadataType {
+	switch {
+	case strings.HasPrefix(contentType, "audio/"):
+		return MUSIC_TRACK
+	case strings.HasPrefix(contentType, "image/"):
+		return PHOTO
+	case strings.HasPrefix(contentType, "video/"):
+		return MOVIE
+	}
+	return GENERIC
+}
+
+// LoadMediaURL loads mediaURL, working out its content type and stream
+// type with probe. It fails before contacting the device if the format
+// cannot be played.
+func (c *MediaController) LoadMediaURL(ctx context.Context, mediaURL string, probe *ContentProbe) (*api.CastMessage, error) {
+	if probe == nil {
+		probe = &ContentProbe{}
+	}
+	item, err := probe.Probe(ctx, mediaURL)
+	if err != nil {
+		return nil, err
+	}
+	return c.LoadMedia(ctx, item, 0, true, map[string]interface{}{})
+}
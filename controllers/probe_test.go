@@ -0,0 +1,67 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+)
+
+func TestContentProbe(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/radio", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "audio/mpeg")
+		w.Header().Set("Icy-Name", "Test FM")
+	})
+	mux.HandleFunc("/download", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodHead {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.WriteHeader(http.StatusPartialContent)
+		w.Write([]byte("\x89PNG\x0D\x0A\x1A\x0A"))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	ctx := context.Background()
+	probe := &ContentProbe{Client: server.Client()}
+
+	item, err := probe.Probe(ctx, "http://example.invalid/music/track.FLAC")
+	assert.NoError(t, err)
+	assert.Equal(t, "audio/flac", item.ContentType)
+	assert.Equal(t, StreamTypeBuffered, item.StreamType)
+	assert.Equal(t, MUSIC_TRACK, item.MetaData.MetadataType)
+
+	item, err = probe.Probe(ctx, server.URL+"/radio")
+	assert.NoError(t, err)
+	assert.Equal(t, "audio/mpeg", item.ContentType)
+	assert.Equal(t, StreamTypeLive, item.StreamType)
+
+	item, err = probe.Probe(ctx, server.URL+"/download")
+	assert.NoError(t, err)
+	assert.Equal(t, "image/png", item.ContentType)
+	assert.Equal(t, PHOTO, item.MetaData.MetadataType)
+
+	_, err = probe.Probe(ctx, "http://example.invalid/movie.avi")
+	var unsupported *UnsupportedFormatError
+	assert.True(t, errors.As(err, &unsupported))
+	assert.Equal(t, "video/x-msvideo", unsupported.ContentType)
+}
+
+func TestContentTypeOf(t *testing.T) {
+	contentType, supported := ContentTypeOf("/music/01 Song.FLAC")
+	assert.Equal(t, "audio/flac", contentType)
+	assert.True(t, supported)
+
+	contentType, supported = ContentTypeOf("movie.mkv")
+	assert.Equal(t, "video/x-matroska", contentType)
+	assert.False(t, supported)
+
+	_, supported = ContentTypeOf("cover.txt")
+	assert.False(t, supported)
+}
@@ -2,14 +2,14 @@ package controllers
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"sync"
 
 	"golang.org/x/net/context"
 
 	"github.com/vkl/go-cast/api"
 	"github.com/vkl/go-cast/events"
-	_ "github.com/vkl/go-cast/logger"
 	"github.com/vkl/go-cast/net"
 )
 
@@ -29,6 +29,18 @@ type LaunchRequest struct {
 	AppId string `json:"appId"`
 }
 
+type AppAvailabilityRequest struct {
+	net.PayloadHeaders
+	AppId []string `json:"appId"`
+}
+
+type AppAvailabilityResponse struct {
+	net.PayloadHeaders
+	Availability map[string]string `json:"availability"`
+}
+
+const AppAvailable = "APP_AVAILABLE"
+
 func (s *ReceiverStatus) GetSessionByNamespace(namespace string) *ApplicationSession {
 	for _, app := range s.Applications {
 		for _, ns := range app.Namespaces {
@@ -56,6 +68,18 @@ type ApplicationSession struct {
 	SessionID   *string      `json:"sessionId,omitempty"`
 	StatusText  *string      `json:"statusText,omitempty"`
 	TransportId *string      `json:"transportId,omitempty"`
+	// IsIdleScreen is set on the app shown while the device is idle.
+	IsIdleScreen *bool `json:"isIdleScreen,omitempty"`
+}
+
+// backdropAppID is the idle screen of devices that don't flag it with
+// isIdleScreen.
+const backdropAppID = "E8C28D3C"
+
+// idle reports whether the app is the idle screen rather than one a sender
+// started.
+func (a *ApplicationSession) idle() bool {
+	return (a.IsIdleScreen != nil && *a.IsIdleScreen) || (a.AppID != nil && *a.AppID == backdropAppID)
 }
 
 type Namespace struct {
@@ -63,24 +87,44 @@ type Namespace struct {
 }
 
 type Volume struct {
-	Level *float64 `json:"level,omitempty"`
-	Muted *bool    `json:"muted,omitempty"`
+	Level        *float64 `json:"level,omitempty"`
+	Muted        *bool    `json:"muted,omitempty"`
+	ControlType  *string  `json:"controlType,omitempty"`
+	StepInterval *float64 `json:"stepInterval,omitempty"`
 }
 
 type ReceiverController struct {
 	channel  *net.Channel
 	eventsCh chan events.Event
 	status   *ReceiverStatus
+
+	mu       sync.Mutex
+	launched map[string]bool
 }
 
-var getStatus = net.PayloadHeaders{Type: "GET_STATUS"}
+type StopRequest struct {
+	net.PayloadHeaders
+	SessionID string `json:"sessionId,omitempty"`
+}
+
+// ErrNotOwnSession is returned when stopping a session this controller
+// did not launch without forcing it.
+var ErrNotOwnSession = errors.New("session was not launched by this sender")
+
+// ErrNoApp is returned when stopping the running app while none is.
+var ErrNoApp = errors.New("no app is running")
+
+// Commands are copied into each request, as Request sets the request ID
+// of its payload and requests to several devices run concurrently.
 var commandLaunch = net.PayloadHeaders{Type: "LAUNCH"}
 var commandStop = net.PayloadHeaders{Type: "STOP"}
+var commandAppAvailability = net.PayloadHeaders{Type: "GET_APP_AVAILABILITY"}
 
 func NewReceiverController(conn *net.Connection, eventsCh chan events.Event, sourceId, destinationId string) *ReceiverController {
 	controller := &ReceiverController{
 		channel:  conn.NewChannel(sourceId, destinationId, "urn:x-cast:com.google.cast.receiver"),
 		eventsCh: eventsCh,
+		launched: make(map[string]bool),
 	}
 
 	controller.channel.OnMessage("RECEIVER_STATUS", controller.onStatus)
@@ -92,7 +136,7 @@ func (r *ReceiverController) sendEvent(event events.Event) {
 	select {
 	case r.eventsCh <- event:
 	default:
-		log.Printf("Dropped event: %#v", event)
+		r.channel.Logger().Warn("dropped event", "event", fmt.Sprintf("%#v", event))
 	}
 }
 
@@ -100,14 +144,14 @@ func (r *ReceiverController) onStatus(message *api.CastMessage) {
 	response := &StatusResponse{}
 	err := json.Unmarshal([]byte(*message.PayloadUtf8), response)
 	if err != nil {
-		log.Printf("Failed to unmarshal status message:%s - %s", err, *message.PayloadUtf8)
+		r.channel.Logger().Warn("failed to unmarshal status message", "error", err, "payload", *message.PayloadUtf8)
 		return
 	}
 
 	previous := map[string]*ApplicationSession{}
 	if r.status != nil {
 		for _, app := range r.status.Applications {
-			previous[*app.AppID] = app
+			previous[sessionKey(app)] = app
 		}
 	}
 
@@ -117,6 +161,7 @@ func (r *ReceiverController) onStatus(message *api.CastMessage) {
 	for _, app := range response.Status.Applications {
 		displayName += *app.DisplayName
 	}
+	r.channel.Metrics().Volume(*vol.Level, *vol.Muted)
 	r.sendEvent(events.StatusUpdated{
 		Level:       *vol.Level,
 		Muted:       *vol.Muted,
@@ -124,13 +169,14 @@ func (r *ReceiverController) onStatus(message *api.CastMessage) {
 	})
 
 	for _, app := range response.Status.Applications {
-		if _, ok := previous[*app.AppID]; ok {
+		if _, ok := previous[sessionKey(app)]; ok {
 			// Already running
-			delete(previous, *app.AppID)
+			delete(previous, sessionKey(app))
 			continue
 		}
 		event := events.AppStarted{
 			AppID:       *app.AppID,
+			SessionID:   stringValue(app.SessionID),
 			DisplayName: *app.DisplayName,
 			StatusText:  *app.StatusText,
 		}
@@ -141,9 +187,13 @@ func (r *ReceiverController) onStatus(message *api.CastMessage) {
 	for _, app := range previous {
 		event := events.AppStopped{
 			AppID:       *app.AppID,
+			SessionID:   stringValue(app.SessionID),
 			DisplayName: *app.DisplayName,
 			StatusText:  *app.StatusText,
 		}
+		r.mu.Lock()
+		delete(r.launched, event.SessionID)
+		r.mu.Unlock()
 		r.sendEvent(event)
 	}
 }
@@ -154,9 +204,9 @@ func (r *ReceiverController) Start(ctx context.Context) error {
 }
 
 func (r *ReceiverController) GetStatus(ctx context.Context) (*ReceiverStatus, error) {
-	message, err := r.channel.Request(ctx, &getStatus)
+	message, err := r.channel.Request(ctx, &net.PayloadHeaders{Type: "GET_STATUS"})
 	if err != nil {
-		return nil, fmt.Errorf("failed to get receiver status: %s", err)
+		return nil, fmt.Errorf("failed to get receiver status: %w", err)
 	}
 
 	response := &StatusResponse{}
@@ -189,7 +239,10 @@ func (r *ReceiverController) LaunchApp(ctx context.Context, appId string) (*Rece
 		AppId:          appId,
 	})
 	if err != nil {
-		return nil, fmt.Errorf("failed sending request: %s", err)
+		return nil, fmt.Errorf("failed sending request: %w", err)
+	}
+	if err := checkResponse("launch app "+appId, message); err != nil {
+		return nil, err
 	}
 
 	response := &StatusResponse{}
@@ -197,25 +250,146 @@ func (r *ReceiverController) LaunchApp(ctx context.Context, appId string) (*Rece
 	if err != nil {
 		return nil, fmt.Errorf("failed to unmarshal status message: %s - %s", err, *message.PayloadUtf8)
 	}
+	if response.Status == nil {
+		return nil, fmt.Errorf("failed to launch app %s: %s", appId, response.Type)
+	}
+
+	if session := response.Status.GetSessionByAppId(appId); session != nil && session.SessionID != nil {
+		r.mu.Lock()
+		r.launched[*session.SessionID] = true
+		r.mu.Unlock()
+	}
 
 	return response.Status, nil
 }
 
+// GetAppAvailability asks the device which of the given apps it supports.
+func (r *ReceiverController) GetAppAvailability(ctx context.Context, appIds ...string) (map[string]bool, error) {
+	message, err := r.channel.Request(ctx, &AppAvailabilityRequest{
+		PayloadHeaders: commandAppAvailability,
+		AppId:          appIds,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get app availability: %w", err)
+	}
+
+	response := &AppAvailabilityResponse{}
+	err = json.Unmarshal([]byte(*message.PayloadUtf8), response)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal availability message: %s - %s", err, *message.PayloadUtf8)
+	}
+
+	availability := make(map[string]bool, len(appIds))
+	for _, appId := range appIds {
+		availability[appId] = response.Availability[appId] == AppAvailable
+	}
+	return availability, nil
+}
+
+// QuitApp stops whichever application is running on the device, even one
+// started by another sender. Prefer StopSession on shared devices.
 func (r *ReceiverController) QuitApp(ctx context.Context) (*api.CastMessage, error) {
-	return r.channel.Request(ctx, &commandStop)
+	return r.channel.Request(ctx, &net.PayloadHeaders{Type: "STOP"})
+}
+
+// Launched reports whether the session was launched by this controller.
+func (r *ReceiverController) Launched(sessionID string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.launched[sessionID]
+}
+
+// StopApp stops the session of the running application with StopSession,
+// refusing one launched by another sender unless force is set. A session
+// this controller launched is preferred, and the idle screen is not an app
+// to stop.
+func (r *ReceiverController) StopApp(ctx context.Context, force bool) (*ReceiverStatus, error) {
+	status, err := r.GetStatus(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var running *ApplicationSession
+	for _, app := range status.Applications {
+		if app.SessionID == nil || app.idle() {
+			continue
+		}
+		if r.Launched(*app.SessionID) {
+			running = app
+			break
+		}
+		if running == nil {
+			running = app
+		}
+	}
+	if running == nil {
+		return nil, ErrNoApp
+	}
+	return r.StopSession(ctx, *running.SessionID, force)
+}
+
+// StopSession stops a single application session. Sessions not launched by
+// this controller are refused with ErrNotOwnSession unless force is set.
+func (r *ReceiverController) StopSession(ctx context.Context, sessionID string, force bool) (*ReceiverStatus, error) {
+	if sessionID == "" {
+		return nil, errors.New("no session id given")
+	}
+	if !force && !r.Launched(sessionID) {
+		return nil, ErrNotOwnSession
+	}
+
+	message, err := r.channel.Request(ctx, &StopRequest{
+		PayloadHeaders: commandStop,
+		SessionID:      sessionID,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to stop session %s: %w", sessionID, err)
+	}
+
+	op := "stop session " + sessionID
+	if err := checkResponse(op, message); err != nil {
+		return nil, err
+	}
+	response := &StatusResponse{}
+	err = json.Unmarshal([]byte(*message.PayloadUtf8), response)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal status message: %s - %s", err, *message.PayloadUtf8)
+	}
+	if response.Status == nil {
+		return nil, &ResponseError{Op: op, Type: response.Type}
+	}
+
+	r.mu.Lock()
+	delete(r.launched, sessionID)
+	r.mu.Unlock()
+
+	return response.Status, nil
+}
+
+func sessionKey(app *ApplicationSession) string {
+	if app.SessionID != nil {
+		return *app.SessionID
+	}
+	return *app.AppID
+}
+
+func stringValue(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
 }
 
 func (r *ReceiverController) IsPlaying(ctx context.Context) bool {
 	status, err := r.GetStatus(ctx)
 	if err != nil {
-		log.Println(err)
+		r.channel.Logger().Warn("failed to get status", "error", err)
 		return false
 	}
 	if len(status.Applications) == 0 {
 		return false
 	}
 	for _, app := range status.Applications {
-		log.Println("status", *app.StatusText)
+		r.channel.Logger().Debug("application status", "appId", *app.AppID, "statusText", *app.StatusText)
 		if *app.StatusText == "Ready To Cast" {
 			return false
 		}
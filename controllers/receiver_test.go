@@ -0,0 +1,86 @@
+package controllers
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+
+	"github.com/vkl/go-cast/events"
+	"github.com/vkl/go-cast/net"
+)
+
+func TestStopSessionRefusesForeignSession(t *testing.T) {
+	receiver := NewReceiverController(net.NewConnection(), make(chan events.Event, 1), "sender-0", "receiver-0")
+
+	_, err := receiver.StopSession(context.Background(), "not-ours", false)
+	assert.Equal(t, ErrNotOwnSession, err)
+	assert.False(t, receiver.Launched("not-ours"))
+}
+
+func TestStopApp(t *testing.T) {
+	running := `{"type":"RECEIVER_STATUS","requestId":1,"status":{"applications":[{"appId":"CC1AD845","displayName":"Default Media Receiver","statusText":"","sessionId":"session-1","namespaces":[]}],"volume":{"level":0.5,"muted":false}}}`
+	conn, tap := replay(t,
+		out(namespaceReceiver, `{"type":"GET_STATUS","requestId":1}`),
+		in(namespaceReceiver, running),
+		out(namespaceReceiver, `{"type":"STOP","requestId":2}`),
+		in(namespaceReceiver, receiverStatus("2", "0.5")),
+	)
+	eventsCh := make(chan events.Event, 16)
+	receiver := NewReceiverController(conn, eventsCh, "sender-0", "receiver-0")
+
+	// another sender launched the running app
+	_, err := receiver.StopApp(context.Background(), true)
+	assert.NoError(t, err)
+	stops := tap.Sent(t, namespaceReceiver, "STOP", 1)
+	if assert.Len(t, stops, 1) {
+		assert.Equal(t, "session-1", stops[0]["sessionId"])
+	}
+
+	var stopped events.AppStopped
+	for event := range eventsCh {
+		if event, ok := event.(events.AppStopped); ok {
+			stopped = event
+			break
+		}
+	}
+	assert.Equal(t, "session-1", stopped.SessionID)
+	assert.Equal(t, "CC1AD845", stopped.AppID)
+}
+
+func TestStopAppSkipsIdleScreen(t *testing.T) {
+	idle := `{"type":"RECEIVER_STATUS","requestId":1,"status":{"applications":[{"appId":"E8C28D3C","displayName":"Backdrop","statusText":"","sessionId":"backdrop-1","isIdleScreen":true,"namespaces":[]}],"volume":{"level":0.5,"muted":false}}}`
+	conn, _ := replay(t,
+		out(namespaceReceiver, `{"type":"GET_STATUS","requestId":1}`),
+		in(namespaceReceiver, idle),
+	)
+	receiver := NewReceiverController(conn, make(chan events.Event, 16), "sender-0", "receiver-0")
+
+	_, err := receiver.StopApp(context.Background(), true)
+	assert.Equal(t, ErrNoApp, err)
+}
+
+func TestStopAppPrefersOwnSession(t *testing.T) {
+	running := `{"type":"RECEIVER_STATUS","requestId":1,"status":{"applications":[` +
+		`{"appId":"CC1AD845","displayName":"Default Media Receiver","statusText":"","sessionId":"session-1","namespaces":[]},` +
+		`{"appId":"5C3F0A3C","displayName":"DashCast","statusText":"","sessionId":"session-2","namespaces":[]}],` +
+		`"volume":{"level":0.5,"muted":false}}}`
+	conn, tap := replay(t,
+		out(namespaceReceiver, `{"type":"GET_STATUS","requestId":1}`),
+		in(namespaceReceiver, running),
+		out(namespaceReceiver, `{"type":"STOP","requestId":2}`),
+		in(namespaceReceiver, `{"type":"INVALID_REQUEST","requestId":2,"reason":"INVALID_SESSION_ID"}`),
+	)
+	receiver := NewReceiverController(conn, make(chan events.Event, 16), "sender-0", "receiver-0")
+	receiver.launched["session-2"] = true
+
+	_, err := receiver.StopApp(context.Background(), false)
+	var responseErr *ResponseError
+	if assert.ErrorAs(t, err, &responseErr) {
+		assert.Equal(t, ResponseInvalidRequest, responseErr.Type)
+	}
+	stops := tap.Sent(t, namespaceReceiver, "STOP", 1)
+	if assert.Len(t, stops, 1) {
+		assert.Equal(t, "session-2", stops[0]["sessionId"])
+	}
+}
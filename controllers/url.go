@@ -2,30 +2,48 @@ package controllers
 
 import (
 	"encoding/json"
-	"errors"
 	"fmt"
-	"log"
+	"sync"
 	"time"
 
 	"golang.org/x/net/context"
 
 	"github.com/vkl/go-cast/api"
 	"github.com/vkl/go-cast/events"
-	_ "github.com/vkl/go-cast/logger"
 	"github.com/vkl/go-cast/net"
 )
 
 type URLController struct {
-	interval      time.Duration
 	channel       *net.Channel
 	eventsCh      chan events.Event
 	DestinationID string
 	URLSessionID  int
+
+	mu         sync.Mutex
+	stopReload chan struct{}
 }
 
-const NamespaceURL = "urn:x-cast:com.url.cast"
+// URLMode selects how the receiver shows a page.
+type URLMode string
+
+const (
+	// URLModeLocation navigates the receiver to the page.
+	URLModeLocation URLMode = "loc"
+	// URLModeIframe shows the page in an iframe, keeping the receiver
+	// page loaded.
+	URLModeIframe URLMode = "iframe"
+)
 
-var getURLStatus = net.PayloadHeaders{Type: "GET_STATUS"}
+// URLLoadOptions configures LoadURLWithOptions.
+type URLLoadOptions struct {
+	Mode URLMode
+	// ReloadInterval, if non-zero, reloads the page periodically until the
+	// context of the load is done, StopReload is called or another page is
+	// loaded.
+	ReloadInterval time.Duration
+}
+
+const NamespaceURL = "urn:x-cast:com.url.cast"
 
 var commandURLLoad = net.PayloadHeaders{Type: "LOAD"}
 
@@ -63,14 +81,15 @@ func (c *URLController) sendEvent(event events.Event) {
 	select {
 	case c.eventsCh <- event:
 	default:
-		log.Printf("Dropped event: %#v", event)
+		c.channel.Logger().Warn("dropped event", "event", fmt.Sprintf("%#v", event))
 	}
 }
 
 func (c *URLController) onStatus(message *api.CastMessage) {
 	response, err := c.parseStatus(message)
 	if err != nil {
-		log.Printf("Error parsing status: %s", err)
+		c.channel.Logger().Warn("error parsing status", "error", err)
+		return
 	}
 
 	for _, status := range response.Status {
@@ -119,32 +138,90 @@ func (c *URLController) Start(ctx context.Context) error {
 }
 
 func (c *URLController) GetStatus(ctx context.Context) (*URLStatusResponse, error) {
-	message, err := c.channel.Request(ctx, &getURLStatus)
+	message, err := c.channel.Request(ctx, &net.PayloadHeaders{Type: "GET_STATUS"})
 	if err != nil {
-		return nil, fmt.Errorf("failed to get receiver status: %s", err)
+		return nil, fmt.Errorf("failed to get receiver status: %w", err)
 	}
 
 	return c.parseStatus(message)
 }
 
 func (c *URLController) LoadURL(ctx context.Context, url string) (*api.CastMessage, error) {
+	return c.LoadURLWithOptions(ctx, url, URLLoadOptions{Mode: URLModeLocation})
+}
+
+func (c *URLController) LoadURLWithOptions(ctx context.Context, url string, options URLLoadOptions) (*api.CastMessage, error) {
+	c.StopReload()
+	if options.Mode == "" {
+		options.Mode = URLModeLocation
+	}
+
+	message, err := c.load(ctx, url, options.Mode)
+	if err != nil {
+		return nil, err
+	}
+
+	if options.ReloadInterval > 0 {
+		c.mu.Lock()
+		// a load that raced this one may have started its own loop
+		c.stopReloadLocked()
+		c.stopReload = make(chan struct{})
+		go c.reloadLoop(ctx, url, options, c.stopReload)
+		c.mu.Unlock()
+	}
+	return message, nil
+}
+
+// StopReload stops the periodic reload of the current page, if any.
+func (c *URLController) StopReload() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.stopReloadLocked()
+}
+
+func (c *URLController) stopReloadLocked() {
+	if c.stopReload != nil {
+		close(c.stopReload)
+		c.stopReload = nil
+	}
+}
+
+func (c *URLController) reloadLoop(ctx context.Context, url string, options URLLoadOptions, stop chan struct{}) {
+	ticker := time.NewTicker(options.ReloadInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			reloadCtx, cancel := context.WithTimeout(ctx, options.ReloadInterval)
+			_, err := c.load(reloadCtx, url, options.Mode)
+			cancel()
+			if ctx.Err() != nil {
+				return
+			}
+			if err != nil {
+				c.channel.Logger().Warn("reload failed, stopping", "url", url, "error", err)
+				return
+			}
+		case <-stop:
+			return
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (c *URLController) load(ctx context.Context, url string, mode URLMode) (*api.CastMessage, error) {
 	message, err := c.channel.Request(ctx, &LoadURLCommand{
 		PayloadHeaders: commandURLLoad,
 		URL:            url,
-		Type:           "loc",
+		Type:           string(mode),
 	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to send load command: %s", err)
+		return nil, fmt.Errorf("failed to send load command: %w", err)
 	}
-
-	response := &net.PayloadHeaders{}
-	err = json.Unmarshal([]byte(*message.PayloadUtf8), response)
-	if err != nil {
+	if err := checkResponse("load URL", message); err != nil {
 		return nil, err
 	}
-	if response.Type == "LOAD_FAILED" {
-		return nil, errors.New("load URL failed")
-	}
 
 	return message, nil
 }
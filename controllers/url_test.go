@@ -0,0 +1,85 @@
+package controllers
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+
+	"github.com/vkl/go-cast/events"
+)
+
+func urlStatus(requestId string) string {
+	return `{"type":"URL_STATUS","requestId":` + requestId + `,"status":[]}`
+}
+
+func TestURLLoadModes(t *testing.T) {
+	conn, tap := replay(t,
+		out(NamespaceURL, `{"type":"loc","requestId":1}`),
+		in(NamespaceURL, urlStatus("1")),
+		out(NamespaceURL, `{"type":"iframe","requestId":2}`),
+		in(NamespaceURL, urlStatus("2")),
+	)
+	url := NewURLController(conn, make(chan events.Event, 16), "sender-0", "receiver-0")
+
+	_, err := url.LoadURL(context.Background(), "http://example.com/a")
+	assert.NoError(t, err)
+	_, err = url.LoadURLWithOptions(context.Background(), "http://example.com/b", URLLoadOptions{Mode: URLModeIframe})
+	assert.NoError(t, err)
+
+	sent := tap.Sent(t, NamespaceURL, "", 2)
+	assert.Equal(t, "loc", sent[0]["type"])
+	assert.Equal(t, "http://example.com/a", sent[0]["url"])
+	assert.Equal(t, "iframe", sent[1]["type"])
+	assert.Equal(t, "http://example.com/b", sent[1]["url"])
+}
+
+func TestURLReloadStopsWithContext(t *testing.T) {
+	conn, tap := replay(t,
+		out(NamespaceURL, `{"type":"loc","requestId":1}`),
+		in(NamespaceURL, urlStatus("1")),
+		out(NamespaceURL, `{"type":"loc","requestId":2}`),
+		in(NamespaceURL, urlStatus("2")),
+		out(NamespaceURL, `{"type":"loc","requestId":3}`),
+		in(NamespaceURL, urlStatus("3")),
+	)
+	url := NewURLController(conn, make(chan events.Event, 16), "sender-0", "receiver-0")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	_, err := url.LoadURLWithOptions(ctx, "http://example.com/", URLLoadOptions{ReloadInterval: time.Millisecond * 100})
+	assert.NoError(t, err)
+	// the first reload
+	tap.Sent(t, NamespaceURL, "loc", 2)
+	cancel()
+
+	time.Sleep(time.Millisecond * 250)
+	assert.Len(t, tap.Sent(t, NamespaceURL, "loc", 2), 2)
+}
+
+func TestURLConcurrentReloads(t *testing.T) {
+	conn, tap := replay(t,
+		out(NamespaceURL, `{"type":"loc","requestId":1}`),
+		in(NamespaceURL, urlStatus("1")),
+		out(NamespaceURL, `{"type":"loc","requestId":2}`),
+		in(NamespaceURL, urlStatus("2")),
+	)
+	url := NewURLController(conn, make(chan events.Event, 16), "sender-0", "receiver-0")
+
+	var wg sync.WaitGroup
+	for _, page := range []string{"http://example.com/a", "http://example.com/b"} {
+		wg.Add(1)
+		go func(page string) {
+			defer wg.Done()
+			_, err := url.LoadURLWithOptions(context.Background(), page, URLLoadOptions{ReloadInterval: time.Millisecond * 100})
+			assert.NoError(t, err)
+		}(page)
+	}
+	wg.Wait()
+	// stops the loop of whichever load came last, and no other is left
+	url.StopReload()
+
+	time.Sleep(time.Millisecond * 250)
+	assert.Len(t, tap.Sent(t, NamespaceURL, "loc", 2), 2)
+}
@@ -0,0 +1,139 @@
+package controllers
+
+import (
+	"errors"
+	"math"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/vkl/go-cast/api"
+)
+
+// Volume control types reported by the device. Only a fixed volume can't
+// be changed. Attenuation, where the device scales its own output, and
+// master, where it drives the volume of the TV or speaker it is part of,
+// take levels and steps the same way, so they are treated alike.
+const (
+	VolumeControlAttenuation = "attenuation"
+	VolumeControlFixed       = "fixed"
+	VolumeControlMaster      = "master"
+)
+
+// defaultVolumeStep is used when the device doesn't report a stepInterval.
+const defaultVolumeStep = 0.05
+
+// fadeTick is the interval between volume updates during a fade.
+const fadeTick = time.Millisecond * 200
+
+var ErrVolumeFixed = errors.New("device volume is fixed")
+
+// IsFixed reports whether the device doesn't allow its volume to be changed.
+func (v *Volume) IsFixed() bool {
+	return v.ControlType != nil && *v.ControlType == VolumeControlFixed
+}
+
+// Step returns the device's volume step, or a default if it reports none.
+func (v *Volume) Step() float64 {
+	if v.StepInterval == nil || *v.StepInterval <= 0 {
+		return defaultVolumeStep
+	}
+	return *v.StepInterval
+}
+
+func clampLevel(level float64) float64 {
+	return math.Max(0, math.Min(1, level))
+}
+
+func (r *ReceiverController) SetVolumeLevel(ctx context.Context, level float64) (*api.CastMessage, error) {
+	level = clampLevel(level)
+	return r.SetVolume(ctx, &Volume{Level: &level})
+}
+
+func (r *ReceiverController) SetMuted(ctx context.Context, muted bool) (*api.CastMessage, error) {
+	return r.SetVolume(ctx, &Volume{Muted: &muted})
+}
+
+// ToggleMute flips the mute state and returns the new state.
+func (r *ReceiverController) ToggleMute(ctx context.Context) (bool, error) {
+	volume, err := r.GetVolume(ctx)
+	if err != nil {
+		return false, err
+	}
+	muted := volume.Muted == nil || !*volume.Muted
+	_, err = r.SetMuted(ctx, muted)
+	return muted, err
+}
+
+// StepVolume changes the volume by steps multiples of the device's
+// stepInterval, negative to turn it down, and returns the new level.
+func (r *ReceiverController) StepVolume(ctx context.Context, steps int) (float64, error) {
+	volume, err := r.GetVolume(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if volume.IsFixed() {
+		return 0, ErrVolumeFixed
+	}
+	level := 0.0
+	if volume.Level != nil {
+		level = *volume.Level
+	}
+	level = stepLevel(level, volume.Step(), steps)
+	_, err = r.SetVolumeLevel(ctx, level)
+	return level, err
+}
+
+// stepLevel moves level by steps increments of step, snapping to the
+// device's grid and clamping to [0, 1].
+func stepLevel(level, step float64, steps int) float64 {
+	return clampLevel(math.Round(level/step+float64(steps)) * step)
+}
+
+// FadeVolume ramps the volume from one level to another over duration,
+// calling progress, if not nil, with each level set. Cancelling ctx stops
+// the fade at the current level.
+func (r *ReceiverController) FadeVolume(ctx context.Context, from, to float64, duration time.Duration, progress func(level float64)) error {
+	volume, err := r.GetVolume(ctx)
+	if err != nil {
+		return err
+	}
+	if volume.IsFixed() {
+		return ErrVolumeFixed
+	}
+
+	if duration <= 0 {
+		if _, err := r.SetVolumeLevel(ctx, to); err != nil {
+			return err
+		}
+		if progress != nil {
+			progress(clampLevel(to))
+		}
+		return nil
+	}
+
+	steps := int(duration / fadeTick)
+	if steps < 1 {
+		steps = 1
+	}
+	ticker := time.NewTicker(duration / time.Duration(steps))
+	defer ticker.Stop()
+
+	for i := 0; i <= steps; i++ {
+		if i > 0 {
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		level := clampLevel(from + (to-from)*float64(i)/float64(steps))
+		if _, err := r.SetVolumeLevel(ctx, level); err != nil {
+			return err
+		}
+		if progress != nil {
+			progress(level)
+		}
+	}
+	return nil
+}
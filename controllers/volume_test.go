@@ -0,0 +1,98 @@
+package controllers
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+
+	"github.com/vkl/go-cast/events"
+)
+
+func TestStepLevel(t *testing.T) {
+	assert.InDelta(t, 0.55, stepLevel(0.5, 0.05, 1), 1e-9)
+	assert.InDelta(t, 0.4, stepLevel(0.5, 0.05, -2), 1e-9)
+	// snaps to the device grid
+	assert.InDelta(t, 0.3, stepLevel(0.27, 0.1, 0), 1e-9)
+	assert.Equal(t, 1.0, stepLevel(0.98, 0.05, 3))
+	assert.Equal(t, 0.0, stepLevel(0.02, 0.05, -3))
+}
+
+func TestVolumeControlType(t *testing.T) {
+	fixed := VolumeControlFixed
+	master := VolumeControlMaster
+	assert.True(t, (&Volume{ControlType: &fixed}).IsFixed())
+	assert.False(t, (&Volume{ControlType: &master}).IsFixed())
+	assert.False(t, (&Volume{}).IsFixed())
+	assert.Equal(t, defaultVolumeStep, (&Volume{}).Step())
+}
+
+func TestFadeVolume(t *testing.T) {
+	conn, tap := replay(t,
+		out(namespaceReceiver, `{"type":"GET_STATUS","requestId":1}`),
+		in(namespaceReceiver, receiverStatus("1", "0.2")),
+		out(namespaceReceiver, `{"type":"SET_VOLUME","requestId":2}`),
+		in(namespaceReceiver, receiverStatus("2", "0.2")),
+		out(namespaceReceiver, `{"type":"SET_VOLUME","requestId":3}`),
+		in(namespaceReceiver, receiverStatus("3", "0.4")),
+		out(namespaceReceiver, `{"type":"SET_VOLUME","requestId":4}`),
+		in(namespaceReceiver, receiverStatus("4", "0.6")),
+	)
+	receiver := NewReceiverController(conn, make(chan events.Event, 16), "sender-0", "receiver-0")
+
+	var progress []float64
+	err := receiver.FadeVolume(context.Background(), 0.2, 0.6, 2*fadeTick, func(level float64) {
+		progress = append(progress, level)
+	})
+	assert.NoError(t, err)
+	assert.InDeltaSlice(t, []float64{0.2, 0.4, 0.6}, progress, 1e-9)
+	var levels []float64
+	for _, payload := range tap.Sent(t, namespaceReceiver, "SET_VOLUME", 3) {
+		levels = append(levels, payload["volume"].(map[string]interface{})["level"].(float64))
+	}
+	assert.InDeltaSlice(t, []float64{0.2, 0.4, 0.6}, levels, 1e-9)
+}
+
+func TestFadeVolumeWithoutDuration(t *testing.T) {
+	conn, tap := replay(t,
+		out(namespaceReceiver, `{"type":"GET_STATUS","requestId":1}`),
+		in(namespaceReceiver, receiverStatus("1", "0.2")),
+		out(namespaceReceiver, `{"type":"SET_VOLUME","requestId":2}`),
+		in(namespaceReceiver, receiverStatus("2", "0.6")),
+	)
+	receiver := NewReceiverController(conn, make(chan events.Event, 16), "sender-0", "receiver-0")
+
+	assert.NoError(t, receiver.FadeVolume(context.Background(), 0.2, 0.6, 0, nil))
+	sent := tap.Sent(t, namespaceReceiver, "SET_VOLUME", 1)
+	if assert.Len(t, sent, 1) {
+		assert.Equal(t, 0.6, sent[0]["volume"].(map[string]interface{})["level"])
+	}
+}
+
+func TestStepVolumeControlTypes(t *testing.T) {
+	status := func(requestId, controlType string) string {
+		return `{"type":"RECEIVER_STATUS","requestId":` + requestId + `,"status":{"applications":[],` +
+			`"volume":{"level":0.5,"muted":false,"controlType":"` + controlType + `","stepInterval":0.1}}}`
+	}
+	conn, tap := replay(t,
+		out(namespaceReceiver, `{"type":"GET_STATUS","requestId":1}`),
+		in(namespaceReceiver, status("1", VolumeControlMaster)),
+		out(namespaceReceiver, `{"type":"SET_VOLUME","requestId":2}`),
+		in(namespaceReceiver, status("2", VolumeControlMaster)),
+		out(namespaceReceiver, `{"type":"GET_STATUS","requestId":3}`),
+		in(namespaceReceiver, status("3", VolumeControlFixed)),
+	)
+	receiver := NewReceiverController(conn, make(chan events.Event, 16), "sender-0", "receiver-0")
+
+	// a master volume steps like an attenuated one
+	level, err := receiver.StepVolume(context.Background(), 1)
+	assert.NoError(t, err)
+	assert.InDelta(t, 0.6, level, 1e-9)
+	sent := tap.Sent(t, namespaceReceiver, "SET_VOLUME", 1)
+	if assert.Len(t, sent, 1) {
+		assert.InDelta(t, 0.6, sent[0]["volume"].(map[string]interface{})["level"], 1e-9)
+	}
+
+	_, err = receiver.StepVolume(context.Background(), 1)
+	assert.Equal(t, ErrVolumeFixed, err)
+}
@@ -0,0 +1,560 @@
+package daemon
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"strings"
+	"syscall"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/vkl/go-cast"
+	"github.com/vkl/go-cast/api"
+	"github.com/vkl/go-cast/controllers"
+	castnet "github.com/vkl/go-cast/net"
+	"github.com/vkl/go-cast/playlist"
+)
+
+// DefaultTimeout bounds each request to a device.
+const DefaultTimeout = time.Second * 15
+
+var errNoMedia = errors.New("no media session")
+
+// errorStatus maps err to the HTTP status of its cause.
+func errorStatus(err error) int {
+	var (
+		unsupported *controllers.UnsupportedCommandError
+		format      *controllers.UnsupportedFormatError
+		state       *cast.StateError
+		response    *controllers.ResponseError
+		opError     *net.OpError
+		netError    net.Error
+		invalid     *badRequestError
+	)
+	switch {
+	case errors.As(err, &invalid):
+		return http.StatusBadRequest
+	case errors.Is(err, context.DeadlineExceeded),
+		errors.As(err, &netError) && netError.Timeout():
+		return http.StatusGatewayTimeout
+	case errors.Is(err, errNoMedia),
+		errors.Is(err, controllers.ErrNoApp),
+		errors.Is(err, controllers.ErrNotOwnSession),
+		errors.As(err, &state):
+		return http.StatusConflict
+	case errors.As(err, &unsupported),
+		errors.As(err, &format),
+		errors.Is(err, controllers.ErrVolumeFixed):
+		return http.StatusUnprocessableEntity
+	case errors.As(err, &response),
+		errors.As(err, &opError),
+		errors.Is(err, castnet.ErrConnectionClosed),
+		errors.Is(err, io.EOF),
+		errors.Is(err, syscall.ECONNRESET):
+		return http.StatusBadGateway
+	}
+	return http.StatusInternalServerError
+}
+
+// DeviceEntry is a device in the device list.
+type DeviceEntry struct {
+	cast.DeviceInfo
+	State string `json:"state"`
+}
+
+// DeviceStatus is the status of a device and of the media it plays.
+type DeviceStatus struct {
+	Device   cast.DeviceInfo             `json:"device"`
+	State    string                      `json:"state"`
+	Receiver *controllers.ReceiverStatus `json:"receiver"`
+	Media    *controllers.MediaStatus    `json:"media"`
+}
+
+// LoadRequest is the body of a load request, and an item of a queue
+// request. The content type is probed from the URL unless given.
+type LoadRequest struct {
+	URL         string  `json:"url"`
+	ContentType string  `json:"contentType,omitempty"`
+	Title       string  `json:"title,omitempty"`
+	Autoplay    *bool   `json:"autoplay,omitempty"`
+	CurrentTime float64 `json:"currentTime,omitempty"`
+	AppID       string  `json:"appId,omitempty"`
+}
+
+type LaunchRequest struct {
+	AppID string `json:"appId"`
+}
+
+// QuitRequest stops the running app. Apps launched by other senders are
+// only stopped with Force.
+type QuitRequest struct {
+	Force bool `json:"force"`
+}
+
+// SeekRequest moves playback to Position, in seconds.
+type SeekRequest struct {
+	Position *float64 `json:"position"`
+}
+
+type RepeatRequest struct {
+	Mode string `json:"mode"`
+}
+
+type QueueRequest struct {
+	Items      []LoadRequest `json:"items"`
+	RepeatMode string        `json:"repeatMode,omitempty"`
+	AppID      string        `json:"appId,omitempty"`
+}
+
+type VolumeRequest struct {
+	Level *float64 `json:"level,omitempty"`
+	Muted *bool    `json:"muted,omitempty"`
+	// Step changes the level by this many of the device's volume steps.
+	Step int `json:"step,omitempty"`
+}
+
+// Handler serves the HTTP JSON API:
+//
+//	GET  /devices                      known devices
+//	GET  /devices/{id}                 receiver and media status
+//	POST /devices/{id}/launch          {"appId": "CC1AD845"}
+//	POST /devices/{id}/quit
+//	POST /devices/{id}/load            LoadRequest
+//	POST /devices/{id}/play, pause, stop
+//	POST /devices/{id}/seek            {"position": 42.5}
+//	GET  /devices/{id}/volume
+//	POST /devices/{id}/volume          VolumeRequest
+//	POST /devices/{id}/queue           QueueRequest
+//	POST /devices/{id}/queue/insert    QueueRequest
+//	POST /devices/{id}/queue/next, prev, shuffle
+//	POST /devices/{id}/queue/repeat    {"mode": "REPEAT_ALL"}
+//	GET  /devices/{id}/events          events of the device
+//	GET  /events                       events of all devices
+//
+// Devices are named by UUID or name. Errors are returned as
+// {"error": "..."}. Events are streamed as server-sent events, or over a
+// WebSocket when the request upgrades to one.
+type Handler struct {
+	manager *Manager
+	timeout time.Duration
+	probe   *controllers.ContentProbe
+}
+
+func NewHandler(manager *Manager) *Handler {
+	return &Handler{
+		manager: manager,
+		timeout: DefaultTimeout,
+		probe:   &controllers.ContentProbe{},
+	}
+}
+
+// SetTimeout bounds each request to a device.
+func (h *Handler) SetTimeout(timeout time.Duration) {
+	h.timeout = timeout
+}
+
+func isJSON(r *http.Request) bool {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return err == nil && mediaType == "application/json"
+}
+
+// deviceAction handles an action on a device, decoding the request body
+// into body if it isn't nil.
+type deviceAction struct {
+	body func() interface{}
+	run  func(ctx context.Context, client *cast.Client, body interface{}) (interface{}, error)
+}
+
+// actions are keyed by method and path below the device.
+func (h *Handler) actions() map[string]deviceAction {
+	return map[string]deviceAction{
+		"GET ":               {run: h.status},
+		"POST launch":        {body: func() interface{} { return &LaunchRequest{} }, run: h.launch},
+		"POST quit":          {body: func() interface{} { return &QuitRequest{} }, run: h.quit},
+		"POST load":          {body: func() interface{} { return &LoadRequest{} }, run: h.load},
+		"POST play":          {run: mediaAction((*controllers.MediaController).Play)},
+		"POST pause":         {run: mediaAction((*controllers.MediaController).Pause)},
+		"POST stop":          {run: mediaAction((*controllers.MediaController).Stop)},
+		"POST seek":          {body: func() interface{} { return &SeekRequest{} }, run: h.seek},
+		"GET volume":         {run: h.volume},
+		"POST volume":        {body: func() interface{} { return &VolumeRequest{} }, run: h.setVolume},
+		"POST queue":         {body: func() interface{} { return &QueueRequest{} }, run: h.queue},
+		"POST queue/insert":  {body: func() interface{} { return &QueueRequest{} }, run: h.queueInsert},
+		"POST queue/next":    {run: mediaAction((*controllers.MediaController).QueueNext)},
+		"POST queue/prev":    {run: mediaAction((*controllers.MediaController).QueuePrev)},
+		"POST queue/shuffle": {run: mediaAction((*controllers.MediaController).QueueShuffle)},
+		"POST queue/repeat":  {body: func() interface{} { return &RepeatRequest{} }, run: h.repeat},
+	}
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	parts := strings.SplitN(strings.Trim(r.URL.Path, "/"), "/", 3)
+	if parts[0] == "events" && len(parts) == 1 && r.Method == http.MethodGet {
+		h.streamEvents(w, r, "")
+		return
+	}
+	if parts[0] == "metrics" && len(parts) == 1 && r.Method == http.MethodGet {
+		h.manager.Metrics().Handler().ServeHTTP(w, r)
+		return
+	}
+	if parts[0] != "devices" {
+		writeError(w, http.StatusNotFound, fmt.Errorf("no such endpoint %s", r.URL.Path))
+		return
+	}
+	if len(parts) == 1 {
+		if r.Method != http.MethodGet {
+			writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+			return
+		}
+		h.listDevices(w)
+		return
+	}
+
+	device, ok := h.manager.Device(parts[1])
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Errorf("device %q not found", parts[1]))
+		return
+	}
+	name := ""
+	if len(parts) == 3 {
+		name = parts[2]
+	}
+	if name == "events" && r.Method == http.MethodGet {
+		h.streamEvents(w, r, device.ID())
+		return
+	}
+	actions := h.actions()
+	action, ok := actions[r.Method+" "+name]
+	if !ok {
+		for key := range actions {
+			if strings.HasSuffix(key, " "+name) {
+				writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+				return
+			}
+		}
+		writeError(w, http.StatusNotFound, fmt.Errorf("no such endpoint %s", r.URL.Path))
+		return
+	}
+
+	// browsers let any site POST forms to the daemon, but neither with a
+	// JSON body nor with an Origin of the daemon's host
+	if r.Method != http.MethodGet && !sameOrigin(r) {
+		writeError(w, http.StatusForbidden, fmt.Errorf("origin %s not allowed", r.Header.Get("Origin")))
+		return
+	}
+	var body interface{}
+	if action.body != nil {
+		if r.ContentLength != 0 && !isJSON(r) {
+			writeError(w, http.StatusUnsupportedMediaType, fmt.Errorf("request body must be application/json"))
+			return
+		}
+		body = action.body()
+		if err := json.NewDecoder(r.Body).Decode(body); err != nil && err != io.EOF {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid request body: %w", err))
+			return
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), h.timeout)
+	defer cancel()
+	var result interface{}
+	err := device.Do(func(client *cast.Client) error {
+		var err error
+		result, err = action.run(ctx, client, body)
+		return err
+	})
+	switch {
+	case err != nil:
+		writeError(w, errorStatus(err), err)
+	case result == nil:
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeJSON(w, http.StatusOK, result)
+	}
+}
+
+func (h *Handler) listDevices(w http.ResponseWriter) {
+	entries := []DeviceEntry{}
+	for _, device := range h.manager.Devices() {
+		entries = append(entries, DeviceEntry{DeviceInfo: device.Info(), State: device.State().String()})
+	}
+	writeJSON(w, http.StatusOK, entries)
+}
+
+// badRequestError is a request the API can't act on, as opposed to one
+// the device failed.
+type badRequestError struct {
+	message string
+}
+
+func (e *badRequestError) Error() string {
+	return e.message
+}
+
+func badRequest(format string, args ...interface{}) error {
+	return &badRequestError{fmt.Sprintf(format, args...)}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+// RunningMedia returns the media controller of the running app, or an
+// error if it has no media namespace.
+func RunningMedia(ctx context.Context, client *cast.Client) (*controllers.MediaController, error) {
+	receiver, err := client.Receiver()
+	if err != nil {
+		return nil, err
+	}
+	status, err := receiver.GetStatus(ctx)
+	if err != nil {
+		return nil, err
+	}
+	session := status.GetSessionByNamespace(controllers.NamespaceMedia)
+	if session == nil || session.AppID == nil {
+		return nil, errNoMedia
+	}
+	media, err := client.Media(ctx, *session.AppID)
+	if err != nil {
+		return nil, err
+	}
+	if media.MediaSessionID == 0 {
+		// pick up the session of media loaded by another sender
+		if _, err := media.GetStatus(ctx); err != nil {
+			return nil, err
+		}
+	}
+	return media, nil
+}
+
+func mediaAction(fn func(*controllers.MediaController, context.Context) (*api.CastMessage, error)) func(context.Context, *cast.Client, interface{}) (interface{}, error) {
+	return func(ctx context.Context, client *cast.Client, _ interface{}) (interface{}, error) {
+		media, err := RunningMedia(ctx, client)
+		if err != nil {
+			return nil, err
+		}
+		_, err = fn(media, ctx)
+		return nil, err
+	}
+}
+
+func (h *Handler) status(ctx context.Context, client *cast.Client, _ interface{}) (interface{}, error) {
+	receiver, err := client.Receiver()
+	if err != nil {
+		return nil, err
+	}
+	status, err := receiver.GetStatus(ctx)
+	if err != nil {
+		return nil, err
+	}
+	result := &DeviceStatus{Device: client.DeviceInfo(), State: client.State().String(), Receiver: status}
+	media, err := RunningMedia(ctx, client)
+	if errors.Is(err, errNoMedia) {
+		return result, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	response, err := media.GetStatus(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if len(response.Status) > 0 {
+		result.Media = response.Status[0]
+	}
+	result.State = client.State().String()
+	return result, nil
+}
+
+func (h *Handler) launch(ctx context.Context, client *cast.Client, body interface{}) (interface{}, error) {
+	appID := body.(*LaunchRequest).AppID
+	if appID == "" {
+		return nil, badRequest("appId is required")
+	}
+	receiver, err := client.Receiver()
+	if err != nil {
+		return nil, err
+	}
+	return receiver.LaunchApp(ctx, appID)
+}
+
+func (h *Handler) quit(ctx context.Context, client *cast.Client, body interface{}) (interface{}, error) {
+	receiver, err := client.Receiver()
+	if err != nil {
+		return nil, err
+	}
+	_, err = receiver.StopApp(ctx, body.(*QuitRequest).Force)
+	return nil, err
+}
+
+// MediaItem returns the item to load, probing its content type if it
+// isn't given.
+func (r LoadRequest) MediaItem(ctx context.Context, probe *controllers.ContentProbe) (controllers.MediaItem, error) {
+	if r.URL == "" {
+		return controllers.MediaItem{}, badRequest("url is required")
+	}
+	item := controllers.MediaItem{
+		ContentId:   r.URL,
+		StreamType:  controllers.StreamTypeBuffered,
+		ContentType: r.ContentType,
+	}
+	if r.ContentType == "" {
+		var err error
+		if item, err = probe.Probe(ctx, r.URL); err != nil {
+			return item, err
+		}
+	}
+	if r.Title != "" {
+		item.MetaData.Title = r.Title
+	}
+	return item, nil
+}
+
+func (h *Handler) mediaApp(ctx context.Context, client *cast.Client, appID string) (*controllers.MediaController, error) {
+	if appID == "" {
+		appID = cast.AppMedia
+	}
+	return client.Media(ctx, appID)
+}
+
+func (h *Handler) load(ctx context.Context, client *cast.Client, body interface{}) (interface{}, error) {
+	request := body.(*LoadRequest)
+	item, err := request.MediaItem(ctx, h.probe)
+	if err != nil {
+		return nil, err
+	}
+	media, err := h.mediaApp(ctx, client, request.AppID)
+	if err != nil {
+		return nil, err
+	}
+	autoplay := request.Autoplay == nil || *request.Autoplay
+	_, err = media.LoadMedia(ctx, item, int(request.CurrentTime), autoplay, map[string]interface{}{})
+	return nil, err
+}
+
+func (h *Handler) queueItems(ctx context.Context, request *QueueRequest) ([]controllers.MediaItemQueue, error) {
+	if len(request.Items) == 0 {
+		return nil, badRequest("items are required")
+	}
+	items := make([]controllers.MediaItemQueue, 0, len(request.Items))
+	for _, entry := range request.Items {
+		item, err := entry.MediaItem(ctx, h.probe)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, controllers.MediaItemQueue{
+			Media:     item,
+			Autoplay:  entry.Autoplay == nil || *entry.Autoplay,
+			StartTime: int(entry.CurrentTime),
+		})
+	}
+	return items, nil
+}
+
+func (h *Handler) queue(ctx context.Context, client *cast.Client, body interface{}) (interface{}, error) {
+	request := body.(*QueueRequest)
+	items, err := h.queueItems(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+	media, err := h.mediaApp(ctx, client, request.AppID)
+	if err != nil {
+		return nil, err
+	}
+	if err := playlist.LoadItems(ctx, media, items); err != nil {
+		return nil, err
+	}
+	if request.RepeatMode != "" {
+		_, err = media.SetRepeatMode(ctx, request.RepeatMode)
+	}
+	return nil, err
+}
+
+func (h *Handler) queueInsert(ctx context.Context, client *cast.Client, body interface{}) (interface{}, error) {
+	items, err := h.queueItems(ctx, body.(*QueueRequest))
+	if err != nil {
+		return nil, err
+	}
+	media, err := RunningMedia(ctx, client)
+	if err != nil {
+		return nil, err
+	}
+	_, err = media.QueueInsert(ctx, items, 0, false, map[string]interface{}{})
+	return nil, err
+}
+
+func (h *Handler) repeat(ctx context.Context, client *cast.Client, body interface{}) (interface{}, error) {
+	mode := body.(*RepeatRequest).Mode
+	if mode == "" {
+		return nil, badRequest("mode is required")
+	}
+	media, err := RunningMedia(ctx, client)
+	if err != nil {
+		return nil, err
+	}
+	_, err = media.SetRepeatMode(ctx, mode)
+	return nil, err
+}
+
+func (h *Handler) seek(ctx context.Context, client *cast.Client, body interface{}) (interface{}, error) {
+	position := body.(*SeekRequest).Position
+	if position == nil || *position < 0 {
+		return nil, badRequest("position must be a number of seconds")
+	}
+	media, err := RunningMedia(ctx, client)
+	if err != nil {
+		return nil, err
+	}
+	_, err = media.Seek(ctx, *position)
+	return nil, err
+}
+
+func (h *Handler) volume(ctx context.Context, client *cast.Client, _ interface{}) (interface{}, error) {
+	receiver, err := client.Receiver()
+	if err != nil {
+		return nil, err
+	}
+	return receiver.GetVolume(ctx)
+}
+
+func (h *Handler) setVolume(ctx context.Context, client *cast.Client, body interface{}) (interface{}, error) {
+	request := body.(*VolumeRequest)
+	if request.Level != nil && (*request.Level < 0 || *request.Level > 1) {
+		return nil, badRequest("level must be between 0 and 1")
+	}
+	if request.Level == nil && request.Muted == nil && request.Step == 0 {
+		return nil, badRequest("one of level, muted or step is required")
+	}
+	receiver, err := client.Receiver()
+	if err != nil {
+		return nil, err
+	}
+	if request.Level != nil {
+		if _, err := receiver.SetVolumeLevel(ctx, *request.Level); err != nil {
+			return nil, err
+		}
+	}
+	if request.Step != 0 {
+		if _, err := receiver.StepVolume(ctx, request.Step); err != nil {
+			return nil, err
+		}
+	}
+	if request.Muted != nil {
+		if _, err := receiver.SetMuted(ctx, *request.Muted); err != nil {
+			return nil, err
+		}
+	}
+	return receiver.GetVolume(ctx)
+}
@@ -0,0 +1,241 @@
+package daemon
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+
+	"github.com/vkl/go-cast"
+	castnet "github.com/vkl/go-cast/net"
+)
+
+const namespaceReceiver = "urn:x-cast:com.google.cast.receiver"
+
+func out(namespace, payload string) castnet.Record {
+	return castnet.Record{Direction: castnet.DirectionOutbound, SourceId: cast.DefaultSender, DestinationId: cast.DefaultReceiver, Namespace: namespace, Payload: payload}
+}
+
+func in(namespace, payload string) castnet.Record {
+	return castnet.Record{Direction: castnet.DirectionInbound, SourceId: cast.DefaultReceiver, DestinationId: cast.DefaultSender, Namespace: namespace, Payload: payload}
+}
+
+func receiverStatus(requestId, level string) string {
+	return `{"type":"RECEIVER_STATUS","requestId":` + requestId + `,"status":{"applications":[],"volume":{"level":` + level + `,"muted":false}}}`
+}
+
+// newTestManager returns a manager with one device, which plays records
+// back when it connects, and a count of its connections.
+func newTestManager(t *testing.T, records ...castnet.Record) (*Manager, *int) {
+	// hold the connection open once the records are played
+	records = append(records, out("urn:x-cast:test", ``))
+	dials := 0
+	manager := NewManager(context.Background())
+	manager.SetDialer(func(ctx context.Context, client *cast.Client) error {
+		dials++
+		return client.ConnectTransport(ctx, castnet.NewReplay(records))
+	})
+	client := cast.NewClientWithOptions(net.IPv4(192, 168, 1, 20), 8009, cast.WithSenderID(cast.DefaultSender))
+	client.SetName("Living Room")
+	client.SetInfo(map[string]string{"id": "uuid-1", "md": "Chromecast"})
+	manager.Add(client)
+	t.Cleanup(manager.Close)
+	return manager, &dials
+}
+
+func serve(handler http.Handler, method, path, body string) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	request := httptest.NewRequest(method, path, strings.NewReader(body))
+	if body != "" {
+		request.Header.Set("Content-Type", "application/json")
+	}
+	handler.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func TestDevices(t *testing.T) {
+	manager, _ := newTestManager(t)
+	handler := NewHandler(manager)
+
+	response := serve(handler, http.MethodGet, "/devices", "")
+	assert.Equal(t, http.StatusOK, response.Code)
+	var devices []DeviceEntry
+	assert.NoError(t, json.Unmarshal(response.Body.Bytes(), &devices))
+	assert.Equal(t, []DeviceEntry{{
+		DeviceInfo: cast.DeviceInfo{Name: "Living Room", UUID: "uuid-1", Model: "Chromecast", Host: "192.168.1.20", Port: 8009},
+		State:      "Disconnected",
+	}}, devices)
+
+	// the same device comes back from discovery
+	again := cast.NewClientWithOptions(net.IPv4(192, 168, 1, 20), 8009)
+	again.SetInfo(map[string]string{"id": "uuid-1"})
+	manager.Add(again)
+	assert.Len(t, manager.Devices(), 1)
+
+	assert.Equal(t, http.StatusNotFound, serve(handler, http.MethodGet, "/devices/kitchen", "").Code)
+	assert.Equal(t, http.StatusNotFound, serve(handler, http.MethodPost, "/devices/uuid-1/dance", "").Code)
+	assert.Equal(t, http.StatusMethodNotAllowed, serve(handler, http.MethodGet, "/devices/uuid-1/pause", "").Code)
+	assert.Equal(t, http.StatusBadRequest, serve(handler, http.MethodPost, "/devices/uuid-1/seek", "{").Code)
+}
+
+func TestVolumeReusesConnection(t *testing.T) {
+	manager, dials := newTestManager(t,
+		out(castnet.NamespaceConnection, `{"type":"CONNECT"}`),
+		out(namespaceReceiver, `{"type":"SET_VOLUME","requestId":1,"volume":{"level":0.3}}`),
+		in(namespaceReceiver, receiverStatus("1", "0.3")),
+		out(namespaceReceiver, `{"type":"GET_STATUS","requestId":2}`),
+		in(namespaceReceiver, receiverStatus("2", "0.3")),
+		out(namespaceReceiver, `{"type":"GET_STATUS","requestId":3}`),
+		in(namespaceReceiver, receiverStatus("3", "0.3")),
+		out(namespaceReceiver, `{"type":"GET_STATUS","requestId":4}`),
+		in(namespaceReceiver, receiverStatus("4", "0.3")),
+	)
+	handler := NewHandler(manager)
+
+	response := serve(handler, http.MethodPost, "/devices/living%20room/volume", `{"level":0.3}`)
+	assert.Equal(t, http.StatusOK, response.Code, response.Body.String())
+	assert.JSONEq(t, `{"level":0.3,"muted":false}`, response.Body.String())
+
+	response = serve(handler, http.MethodGet, "/devices/uuid-1/volume", "")
+	assert.Equal(t, http.StatusOK, response.Code, response.Body.String())
+	assert.Equal(t, 1, *dials)
+
+	// nothing is playing
+	response = serve(handler, http.MethodPost, "/devices/uuid-1/pause", "")
+	assert.Equal(t, http.StatusConflict, response.Code)
+	assert.JSONEq(t, `{"error":"no media session"}`, response.Body.String())
+
+	response = serve(handler, http.MethodPost, "/devices/uuid-1/volume", `{"level":2}`)
+	assert.Equal(t, http.StatusBadRequest, response.Code)
+}
+
+func TestCrossSiteRequests(t *testing.T) {
+	manager, dials := newTestManager(t)
+	handler := NewHandler(manager)
+
+	// a form another site posts through the user's browser
+	request := httptest.NewRequest(http.MethodPost, "/devices/uuid-1/volume", strings.NewReader(`{"level":1}`))
+	request.Header.Set("Content-Type", "text/plain")
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	assert.Equal(t, http.StatusUnsupportedMediaType, recorder.Code)
+
+	request = httptest.NewRequest(http.MethodPost, "/devices/uuid-1/pause", nil)
+	request.Header.Set("Origin", "http://attacker.test")
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	assert.Equal(t, http.StatusForbidden, recorder.Code)
+	assert.Equal(t, 0, *dials)
+}
+
+func TestMetrics(t *testing.T) {
+	manager, _ := newTestManager(t,
+		out(castnet.NamespaceConnection, `{"type":"CONNECT"}`),
+		out(namespaceReceiver, `{"type":"SET_VOLUME","requestId":1,"volume":{"level":0.3}}`),
+		in(namespaceReceiver, receiverStatus("1", "0.3")),
+		out(namespaceReceiver, `{"type":"GET_STATUS","requestId":2}`),
+		in(namespaceReceiver, receiverStatus("2", "0.3")),
+	)
+	handler := NewHandler(manager)
+
+	response := serve(handler, http.MethodPost, "/devices/uuid-1/volume", `{"level":0.3}`)
+	assert.Equal(t, http.StatusOK, response.Code, response.Body.String())
+
+	response = serve(handler, http.MethodGet, "/metrics", "")
+	assert.Equal(t, http.StatusOK, response.Code)
+	body := response.Body.String()
+	assert.Contains(t, body, "cast_devices 1\n")
+	assert.Contains(t, body, `cast_volume_level{device="uuid-1",name="Living Room"} 0.3`)
+	assert.Contains(t, body, `cast_messages_received_total{device="uuid-1",name="Living Room",namespace="urn:x-cast:com.google.cast.receiver"} 2`)
+	assert.Contains(t, body, `cast_request_duration_seconds_count{device="uuid-1",name="Living Room",namespace="urn:x-cast:com.google.cast.receiver",type="SET_VOLUME"} 1`)
+}
+
+func TestParallelDevices(t *testing.T) {
+	// each status request asks the receiver for its status twice
+	const requests = 10
+	records := func() []castnet.Record {
+		records := []castnet.Record{out(castnet.NamespaceConnection, `{"type":"CONNECT"}`)}
+		for id := 1; id <= 2*requests; id++ {
+			requestId := strconv.Itoa(id)
+			records = append(records,
+				out(namespaceReceiver, `{"type":"GET_STATUS","requestId":`+requestId+`}`),
+				in(namespaceReceiver, receiverStatus(requestId, "0.5")))
+		}
+		return append(records, out("urn:x-cast:test", ``))
+	}
+	manager := NewManager(context.Background())
+	manager.SetDialer(func(ctx context.Context, client *cast.Client) error {
+		return client.ConnectTransport(ctx, castnet.NewReplay(records()))
+	})
+	t.Cleanup(manager.Close)
+	for i, name := range []string{"Kitchen", "Hifi"} {
+		client := cast.NewClientWithOptions(net.IPv4(192, 168, 1, byte(20+i)), 8009, cast.WithSenderID(cast.DefaultSender))
+		client.SetName(name)
+		client.SetInfo(map[string]string{"id": name})
+		manager.Add(client)
+	}
+	handler := NewHandler(manager)
+
+	var wg sync.WaitGroup
+	for _, id := range []string{"Kitchen", "Hifi"} {
+		wg.Add(1)
+		go func(id string) {
+			defer wg.Done()
+			for i := 0; i < requests; i++ {
+				response := serve(handler, http.MethodGet, "/devices/"+id, "")
+				assert.Equal(t, http.StatusOK, response.Code, response.Body.String())
+			}
+		}(id)
+	}
+	wg.Wait()
+}
+
+func TestAddDuringSlowDial(t *testing.T) {
+	dialing := make(chan struct{})
+	release := make(chan struct{})
+	manager := NewManager(context.Background())
+	manager.SetDialer(func(ctx context.Context, client *cast.Client) error {
+		close(dialing)
+		<-release
+		return errors.New("unreachable")
+	})
+	t.Cleanup(manager.Close)
+	client := cast.NewClientWithOptions(net.IPv4(192, 168, 1, 20), 8009)
+	client.SetName("Living Room")
+	client.SetInfo(map[string]string{"id": "uuid-1"})
+	device := manager.Add(client)
+
+	done := make(chan error)
+	go func() {
+		done <- device.Do(func(*cast.Client) error { return nil })
+	}()
+	<-dialing
+
+	// discovery finds the device elsewhere while the request dials it
+	moved := cast.NewClientWithOptions(net.IPv4(192, 168, 1, 30), 8009)
+	moved.SetName("Living Room")
+	moved.SetInfo(map[string]string{"id": "uuid-1"})
+	added := make(chan struct{})
+	go func() {
+		manager.Add(moved)
+		_, ok := manager.Device("living room")
+		assert.True(t, ok)
+		close(added)
+	}()
+	select {
+	case <-added:
+	case <-time.After(time.Second):
+		t.Error("Add waited for the dial")
+	}
+	close(release)
+	assert.Error(t, <-done)
+}
@@ -0,0 +1,103 @@
+package daemon
+
+import (
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/vkl/go-cast/events"
+)
+
+// DefaultEventHistory is the number of events kept for clients resuming a
+// stream.
+const DefaultEventHistory = 1000
+
+// subscriberBuffer is how far a subscriber can fall behind before it is
+// dropped. It can resume from the last event it received.
+const subscriberBuffer = 64
+
+// Event is an event of a device, numbered in the order the daemon
+// received it.
+type Event struct {
+	ID     uint64    `json:"id"`
+	Time   time.Time `json:"time"`
+	Device string    `json:"device"`
+	Name   string    `json:"name"`
+	// Type is the name of the event type, such as MediaStatusUpdated.
+	Type string       `json:"type"`
+	Data events.Event `json:"data"`
+}
+
+// EventLog keeps the latest events and passes new ones on to subscribers.
+type EventLog struct {
+	mu          sync.Mutex
+	history     []Event
+	size        int
+	next        uint64
+	subscribers map[chan Event]struct{}
+}
+
+func NewEventLog(size int) *EventLog {
+	return &EventLog{
+		size:        size,
+		next:        1,
+		subscribers: map[chan Event]struct{}{},
+	}
+}
+
+// Publish numbers the event of a device and sends it to the subscribers.
+// Subscribers that fall behind are dropped, closing their channel.
+func (l *EventLog) Publish(device, name string, event events.Event) Event {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	e := Event{
+		ID:     l.next,
+		Time:   time.Now(),
+		Device: device,
+		Name:   name,
+		Type:   reflect.Indirect(reflect.ValueOf(event)).Type().Name(),
+		Data:   event,
+	}
+	l.next++
+	l.history = append(l.history, e)
+	if len(l.history) > l.size {
+		l.history = l.history[len(l.history)-l.size:]
+	}
+	for ch := range l.subscribers {
+		select {
+		case ch <- e:
+		default:
+			delete(l.subscribers, ch)
+			close(ch)
+		}
+	}
+	return e
+}
+
+// Subscribe returns the events kept after the event with id after, the
+// channel of the events that follow, and a function to cancel the
+// subscription. Events older than the history are lost.
+func (l *EventLog) Subscribe(after uint64) ([]Event, <-chan Event, func()) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	backlog := []Event{}
+	for _, e := range l.history {
+		if e.ID > after {
+			backlog = append(backlog, e)
+		}
+	}
+	ch := make(chan Event, subscriberBuffer)
+	l.subscribers[ch] = struct{}{}
+
+	var once sync.Once
+	return backlog, ch, func() {
+		once.Do(func() {
+			l.mu.Lock()
+			defer l.mu.Unlock()
+			if _, ok := l.subscribers[ch]; ok {
+				delete(l.subscribers, ch)
+				close(ch)
+			}
+		})
+	}
+}
@@ -0,0 +1,344 @@
+// Package daemon keeps connections to the cast devices on the network and
+// controls them through an HTTP JSON API.
+package daemon
+
+import (
+	"log/slog"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/vkl/go-cast"
+	"github.com/vkl/go-cast/discovery"
+	"github.com/vkl/go-cast/events"
+	"github.com/vkl/go-cast/logger"
+	"github.com/vkl/go-cast/metrics"
+)
+
+// Reconnection backoff of devices kept connected.
+const (
+	minReconnectDelay = time.Second
+	maxReconnectDelay = time.Minute
+)
+
+// Dialer connects a client to its device.
+type Dialer func(ctx context.Context, client *cast.Client) error
+
+func dialDevice(ctx context.Context, client *cast.Client) error {
+	return client.Connect(ctx)
+}
+
+// Device is a device known to the manager, with the client connection
+// reused by every request to it.
+type Device struct {
+	// mu serialises the operations on the client, whose controllers are
+	// set up lazily and can't be shared by concurrent requests
+	mu  sync.Mutex
+	key string
+	// client is replaced and read with the manager's lock held
+	client  *cast.Client
+	manager *Manager
+	// stop ends the watch of the current client
+	stop       chan struct{}
+	lastSeen   time.Time
+	discovered bool
+}
+
+// ID returns the UUID of the device, or its address if it has none.
+func (d *Device) ID() string {
+	return d.key
+}
+
+// Client returns the client of the device, to watch it. Use Do to send it
+// requests.
+func (d *Device) Client() *cast.Client {
+	d.manager.mu.Lock()
+	defer d.manager.mu.Unlock()
+	return d.client
+}
+
+func (d *Device) Info() cast.DeviceInfo {
+	return d.Client().DeviceInfo()
+}
+
+// State returns the connection state of the client.
+func (d *Device) State() cast.State {
+	return d.Client().State()
+}
+
+// Do runs fn with the client, connecting it first if it isn't connected.
+// Operations on a device run one at a time.
+func (d *Device) Do(fn func(client *cast.Client) error) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	client := d.Client()
+	if err := d.connect(client); err != nil {
+		return err
+	}
+	return fn(client)
+}
+
+// connect connects the client unless it is connected, with d.mu held.
+func (d *Device) connect(client *cast.Client) error {
+	if client.IsConnected() {
+		return nil
+	}
+	// the connection outlives the request that opens it
+	return d.manager.dial(d.manager.ctx, client)
+}
+
+// Manager tracks the devices found by discovery and their connections.
+type Manager struct {
+	ctx           context.Context
+	mu            sync.Mutex
+	devices       map[string]*Device
+	dial          Dialer
+	logger        *slog.Logger
+	events        *EventLog
+	metrics       *metrics.Collector
+	keepConnected bool
+	expiry        time.Duration
+}
+
+// NewManager returns a manager whose connections last until ctx is done.
+func NewManager(ctx context.Context) *Manager {
+	return &Manager{
+		ctx:     ctx,
+		devices: map[string]*Device{},
+		dial:    dialDevice,
+		logger:  logger.Discard(),
+		events:  NewEventLog(DefaultEventHistory),
+		metrics: metrics.NewCollector(),
+	}
+}
+
+// Metrics returns the collector of the measurements of all devices.
+func (m *Manager) Metrics() *metrics.Collector {
+	return m.metrics
+}
+
+// Events returns the log of the events of all devices.
+func (m *Manager) Events() *EventLog {
+	return m.events
+}
+
+// SetKeepConnected makes the manager connect to devices as they are added
+// and reconnect when they drop, so that their events keep flowing. Devices
+// are otherwise connected on their first request. It applies to devices
+// added afterwards.
+func (m *Manager) SetKeepConnected(keep bool) {
+	m.keepConnected = keep
+}
+
+// SetExpiry sets how long a discovered device that isn't connected stays
+// known after discovery last found it. Devices never expire by default.
+func (m *Manager) SetExpiry(expiry time.Duration) {
+	m.expiry = expiry
+}
+
+func (m *Manager) SetLogger(logger *slog.Logger) {
+	m.logger = logger
+}
+
+// SetDialer replaces how clients are connected, such as to connect them
+// over a castnet.Replay in tests.
+func (m *Manager) SetDialer(dial Dialer) {
+	m.dial = dial
+}
+
+// deviceKey identifies a device by its UUID, or by its address if it
+// didn't announce one.
+func deviceKey(client *cast.Client) string {
+	if uuid := client.Uuid(); uuid != "" {
+		return uuid
+	}
+	return client.String()
+}
+
+// Add adds a device, or refreshes one already known. A device that moved
+// to another address gets a new client, unless its current one is
+// connected or connecting.
+func (m *Manager) Add(client *cast.Client) *Device {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key := deviceKey(client)
+	device, ok := m.devices[key]
+	if ok {
+		moved := !device.client.IP().Equal(client.IP()) || device.client.Port() != client.Port()
+		// requests hold device.mu for as long as a dial takes, so the
+		// client is swapped without waiting for them
+		if moved && device.client.State() == cast.StateDisconnected {
+			m.logger.Info("device moved", "name", client.Name(), "host", client.IP(), "port", client.Port())
+			close(device.stop)
+			client.SetMetrics(m.metrics.Device(key, client.Name()))
+			device.client = client
+			device.stop = make(chan struct{})
+			go m.watch(device, client, device.stop)
+		}
+		device.lastSeen = time.Now()
+		return device
+	}
+
+	m.logger.Info("device found", "name", client.Name(), "host", client.IP(), "port", client.Port())
+	device = &Device{key: key, client: client, manager: m, stop: make(chan struct{}), lastSeen: time.Now()}
+	m.devices[key] = device
+	client.SetMetrics(m.metrics.Device(key, client.Name()))
+	m.metrics.SetDevices(len(m.devices))
+	m.metrics.SetState(key, client.Name(), client.State())
+	info := client.DeviceInfo()
+	m.events.Publish(key, info.Name, events.DeviceDiscovered{
+		Name:  info.Name,
+		UUID:  info.UUID,
+		Model: info.Model,
+		Host:  info.Host,
+		Port:  info.Port,
+	})
+	go m.watch(device, client, device.stop)
+	return device
+}
+
+// watch publishes the events of a device's client until stop is closed,
+// and keeps the client connected if the manager is told to.
+func (m *Manager) watch(device *Device, client *cast.Client, stop chan struct{}) {
+	eventsCh, unsubscribe := client.Subscribe()
+	defer unsubscribe()
+
+	// dropped tells a reconnection from the first connection
+	dropped := false
+	delay := minReconnectDelay
+	retry := time.NewTimer(0)
+	if !m.keepConnected {
+		retry.Stop()
+	}
+	defer retry.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-m.ctx.Done():
+			return
+		case event := <-eventsCh:
+			m.events.Publish(device.key, client.Name(), event)
+			switch event.(type) {
+			case events.StateChanged:
+				m.metrics.SetState(device.key, client.Name(), client.State())
+			case events.Connected:
+				delay = minReconnectDelay
+				if dropped {
+					m.metrics.Reconnected(device.key, client.Name())
+					dropped = false
+				}
+			case events.Disconnected:
+				dropped = true
+				if m.keepConnected {
+					retry.Reset(delay)
+				}
+			}
+		case <-retry.C:
+			device.mu.Lock()
+			err := device.connect(client)
+			device.mu.Unlock()
+			if err != nil {
+				m.logger.Warn("failed to connect", "name", client.Name(), "error", err, "retry", delay)
+				retry.Reset(delay)
+				delay = min(delay*2, maxReconnectDelay)
+			}
+		}
+	}
+}
+
+// Expire forgets the discovered devices that aren't connected and that
+// discovery hasn't found within the expiry.
+func (m *Manager) Expire() {
+	if m.expiry <= 0 {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for key, device := range m.devices {
+		if !device.discovered || time.Since(device.lastSeen) < m.expiry || device.client.IsConnected() {
+			continue
+		}
+		m.logger.Info("device lost", "name", device.client.Name())
+		close(device.stop)
+		delete(m.devices, key)
+		m.metrics.Forget(key)
+		m.metrics.SetDevices(len(m.devices))
+		m.events.Publish(key, device.client.Name(), events.DeviceLost{
+			Name: device.client.Name(),
+			UUID: device.client.Uuid(),
+		})
+	}
+}
+
+// Device returns the device with the given UUID or, ignoring case, name.
+func (m *Manager) Device(id string) (*Device, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if device, ok := m.devices[id]; ok {
+		return device, true
+	}
+	for _, device := range m.devices {
+		if strings.EqualFold(device.client.Name(), id) {
+			return device, true
+		}
+	}
+	return nil, false
+}
+
+// Devices returns the known devices, sorted by name.
+func (m *Manager) Devices() []*Device {
+	m.mu.Lock()
+	devices := make([]*Device, 0, len(m.devices))
+	names := map[*Device]string{}
+	for _, device := range m.devices {
+		devices = append(devices, device)
+		names[device] = device.client.Name()
+	}
+	m.mu.Unlock()
+	sort.Slice(devices, func(i, j int) bool {
+		return names[devices[i]] < names[devices[j]]
+	})
+	return devices
+}
+
+// Discover adds the devices found by service until ctx is done, and
+// expires those it stops finding.
+func (m *Manager) Discover(ctx context.Context, service *discovery.Service) {
+	ticker := time.NewTicker(time.Second * 10)
+	defer ticker.Stop()
+	for {
+		select {
+		case client := <-service.Found():
+			device := m.Add(client)
+			m.mu.Lock()
+			device.discovered = true
+			m.mu.Unlock()
+		case <-ticker.C:
+			m.Expire()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Close disconnects from every device.
+func (m *Manager) Close() {
+	m.mu.Lock()
+	for _, device := range m.devices {
+		close(device.stop)
+		device.stop = make(chan struct{})
+	}
+	m.mu.Unlock()
+	for _, device := range m.Devices() {
+		device.mu.Lock()
+		client := device.Client()
+		if err := client.Close(); err != nil {
+			m.logger.Warn("failed to close client", "name", client.Name(), "error", err)
+		}
+		device.mu.Unlock()
+	}
+}
@@ -0,0 +1,172 @@
+package daemon
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/websocket"
+)
+
+// keepAlive is the interval of the comments sent on idle event streams,
+// to keep proxies from closing them.
+const keepAlive = time.Second * 15
+
+// streamEvents streams the events of the device with key device, or of all
+// devices if it is empty, over a WebSocket if the request asks for one and
+// as server-sent events otherwise. Clients resume after the last event they
+// received with the Last-Event-ID header or the since query parameter.
+func (h *Handler) streamEvents(w http.ResponseWriter, r *http.Request, device string) {
+	after, err := lastEventID(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	backlog, ch, cancel := h.manager.Events().Subscribe(after)
+	defer cancel()
+	matches := func(e Event) bool {
+		return device == "" || e.Device == device
+	}
+
+	if strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+		server := websocket.Server{
+			// accept clients that aren't browsers, which send no Origin,
+			// and pages served by the daemon's own host, but not other
+			// sites reading the events through the user's browser
+			Handshake: func(_ *websocket.Config, r *http.Request) error {
+				if !sameOrigin(r) {
+					return fmt.Errorf("origin %s not allowed", r.Header.Get("Origin"))
+				}
+				return nil
+			},
+			Handler: func(conn *websocket.Conn) {
+				streamWebSocket(conn, backlog, ch, matches)
+			},
+		}
+		server.ServeHTTP(w, r)
+		return
+	}
+	streamSSE(w, r, backlog, ch, matches)
+}
+
+// sameOrigin reports whether the request has no Origin, or one on the host
+// it was sent to.
+func sameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(u.Host, r.Host)
+}
+
+func lastEventID(r *http.Request) (uint64, error) {
+	id := r.Header.Get("Last-Event-ID")
+	if since := r.URL.Query().Get("since"); since != "" {
+		id = since
+	}
+	if id == "" {
+		return 0, nil
+	}
+	after, err := strconv.ParseUint(id, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid event id %q", id)
+	}
+	return after, nil
+}
+
+func streamSSE(w http.ResponseWriter, r *http.Request, backlog []Event, ch <-chan Event, matches func(Event) bool) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, fmt.Errorf("streaming is not supported"))
+		return
+	}
+	header := w.Header()
+	header.Set("Content-Type", "text/event-stream")
+	header.Set("Cache-Control", "no-cache")
+	header.Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	write := func(e Event) error {
+		if !matches(e) {
+			return nil
+		}
+		data, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", e.ID, e.Type, data)
+		return err
+	}
+	for _, e := range backlog {
+		if err := write(e); err != nil {
+			return
+		}
+	}
+	flusher.Flush()
+
+	ticker := time.NewTicker(keepAlive)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ticker.C:
+			if _, err := io.WriteString(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+		case e, ok := <-ch:
+			if !ok {
+				// fell behind, the client resumes from the last event
+				return
+			}
+			if err := write(e); err != nil {
+				return
+			}
+		}
+		flusher.Flush()
+	}
+}
+
+func streamWebSocket(conn *websocket.Conn, backlog []Event, ch <-chan Event, matches func(Event) bool) {
+	defer conn.Close()
+	// the client sends nothing, reading tells when it goes away
+	closed := make(chan struct{})
+	go func() {
+		io.Copy(io.Discard, conn)
+		close(closed)
+	}()
+
+	for _, e := range backlog {
+		if !matches(e) {
+			continue
+		}
+		if err := websocket.JSON.Send(conn, e); err != nil {
+			return
+		}
+	}
+	for {
+		select {
+		case <-closed:
+			return
+		case e, ok := <-ch:
+			if !ok {
+				return
+			}
+			if !matches(e) {
+				continue
+			}
+			if err := websocket.JSON.Send(conn, e); err != nil {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package daemon
+
+import (
+	"bufio"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+	"golang.org/x/net/websocket"
+
+	"github.com/vkl/go-cast"
+	"github.com/vkl/go-cast/events"
+	castnet "github.com/vkl/go-cast/net"
+)
+
+func TestEventLog(t *testing.T) {
+	log := NewEventLog(2)
+	log.Publish("a", "A", events.Connected{})
+	log.Publish("a", "A", events.StatusUpdated{Level: 0.5})
+	log.Publish("b", "B", events.AppStarted{AppID: "CC1AD845"})
+
+	// the first event fell out of the history
+	backlog, ch, cancel := log.Subscribe(0)
+	defer cancel()
+	assert.Len(t, backlog, 2)
+	assert.Equal(t, uint64(2), backlog[0].ID)
+	assert.Equal(t, "StatusUpdated", backlog[0].Type)
+
+	backlog, _, cancelResumed := log.Subscribe(2)
+	cancelResumed()
+	cancelResumed()
+	assert.Len(t, backlog, 1)
+	assert.Equal(t, "AppStarted", backlog[0].Type)
+
+	e := log.Publish("a", "A", events.Disconnected{Reason: errors.New("EOF")})
+	assert.Equal(t, e, <-ch)
+	// a subscriber that falls behind is dropped
+	for i := 0; i <= subscriberBuffer; i++ {
+		log.Publish("a", "A", events.Connected{})
+	}
+	for range ch {
+	}
+}
+
+func TestStreamEvents(t *testing.T) {
+	manager, _ := newTestManager(t)
+	server := httptest.NewServer(NewHandler(manager))
+	defer server.Close()
+
+	request, _ := http.NewRequest(http.MethodGet, server.URL+"/events", nil)
+	request.Header.Set("Last-Event-ID", "0")
+	response, err := http.DefaultClient.Do(request)
+	assert.NoError(t, err)
+	defer response.Body.Close()
+	assert.Equal(t, "text/event-stream", response.Header.Get("Content-Type"))
+
+	reader := bufio.NewReader(response.Body)
+	readEvent := func() []string {
+		lines := []string{}
+		for {
+			line, err := reader.ReadString('\n')
+			assert.NoError(t, err)
+			if line == "\n" {
+				return lines
+			}
+			lines = append(lines, strings.TrimSuffix(line, "\n"))
+		}
+	}
+	discovered := readEvent()
+	assert.Equal(t, []string{"id: 1", "event: DeviceDiscovered"}, discovered[:2])
+	assert.Contains(t, discovered[2], `"data":{"name":"Living Room","uuid":"uuid-1"`)
+
+	manager.Events().Publish("uuid-1", "Living Room", events.StatusUpdated{Level: 0.25, DisplayName: "Spotify"})
+	status := readEvent()
+	assert.Equal(t, []string{"id: 2", "event: StatusUpdated"}, status[:2])
+	assert.Contains(t, status[2], `"device":"uuid-1","name":"Living Room","type":"StatusUpdated",`+
+		`"data":{"level":0.25,"muted":false,"displayName":"Spotify"}}`)
+
+	response, err = http.Get(server.URL + "/events?since=x")
+	assert.NoError(t, err)
+	response.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, response.StatusCode)
+}
+
+func TestStreamDeviceEventsOverWebSocket(t *testing.T) {
+	manager, _ := newTestManager(t)
+	server := httptest.NewServer(NewHandler(manager))
+	defer server.Close()
+
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/devices/living%20room/events?since=1"
+	// other sites can't read the events through a browser
+	_, err := websocket.Dial(url, "", "http://example.com")
+	assert.Error(t, err)
+
+	conn, err := websocket.Dial(url, "", server.URL)
+	assert.NoError(t, err)
+	defer conn.Close()
+
+	manager.Events().Publish("uuid-2", "Kitchen", events.Connected{})
+	manager.Events().Publish("uuid-1", "Living Room", events.MediaStatusUpdated{PlayerState: "PLAYING"})
+	var e struct {
+		Event
+		Data events.MediaStatusUpdated `json:"data"`
+	}
+	assert.NoError(t, websocket.JSON.Receive(conn, &e))
+	assert.Equal(t, uint64(3), e.ID)
+	assert.Equal(t, "MediaStatusUpdated", e.Type)
+	assert.Equal(t, "PLAYING", e.Data.PlayerState)
+}
+
+func TestKeepConnected(t *testing.T) {
+	var dials int32
+	manager := NewManager(context.Background())
+	manager.SetKeepConnected(true)
+	manager.SetDialer(func(ctx context.Context, client *cast.Client) error {
+		if atomic.AddInt32(&dials, 1) > 1 {
+			return errors.New("unreachable")
+		}
+		// the replay ends after the connection, dropping it
+		return client.ConnectTransport(ctx, castnet.NewReplay([]castnet.Record{
+			out(castnet.NamespaceConnection, `{"type":"CONNECT"}`),
+		}))
+	})
+	_, ch, cancel := manager.Events().Subscribe(0)
+	defer cancel()
+	client := cast.NewClientWithOptions(nil, 8009, cast.WithSenderID(cast.DefaultSender))
+	client.SetInfo(map[string]string{"id": "uuid-1"})
+	manager.Add(client)
+	defer manager.Close()
+
+	types := []string{}
+	for e := range ch {
+		types = append(types, e.Type)
+		if e.Type == "Disconnected" {
+			break
+		}
+	}
+	assert.Contains(t, types, "Connected")
+	assert.Eventually(t, func() bool { return atomic.LoadInt32(&dials) == 2 }, 3*time.Second, 50*time.Millisecond)
+}
+
+func TestExpire(t *testing.T) {
+	manager, _ := newTestManager(t)
+	manager.SetExpiry(time.Minute)
+	device, _ := manager.Device("uuid-1")
+	device.discovered = true
+	manager.Expire()
+	assert.Len(t, manager.Devices(), 1)
+
+	device.lastSeen = time.Now().Add(-2 * time.Minute)
+	manager.Expire()
+	assert.Empty(t, manager.Devices())
+	backlog, _, cancel := manager.Events().Subscribe(1)
+	cancel()
+	assert.Equal(t, events.DeviceLost{Name: "Living Room", UUID: "uuid-1"}, backlog[0].Data)
+}
@@ -2,17 +2,18 @@
 package discovery
 
 import (
-	"log"
+	"log/slog"
 	"regexp"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"golang.org/x/net/context"
 
 	"github.com/hashicorp/mdns"
 	"github.com/vkl/go-cast"
-	_ "github.com/vkl/go-cast/logger"
+	"github.com/vkl/go-cast/logger"
 )
 
 type Service struct {
@@ -20,25 +21,56 @@ type Service struct {
 	entriesCh chan *mdns.ServiceEntry
 
 	stopPeriodic chan struct{}
+
+	mu            sync.Mutex
+	logger        *slog.Logger
+	clientOptions []cast.Option
 }
 
 func NewService(ctx context.Context) *Service {
 	s := &Service{
 		found:     make(chan *cast.Client),
 		entriesCh: make(chan *mdns.ServiceEntry, 10),
+		logger:    logger.Discard(),
 	}
 
 	go s.listener(ctx)
 	return s
 }
 
-func (d *Service) Run(ctx context.Context, interval time.Duration) error {
-	err := mdns.Query(&mdns.QueryParam{
+// SetLogger sets the logger of the service, which also receives the output
+// of the mDNS queries. Clients it discovers inherit it.
+func (d *Service) SetLogger(logger *slog.Logger) {
+	d.mu.Lock()
+	d.logger = logger
+	d.mu.Unlock()
+}
+
+// SetClientOptions sets the options discovered clients are created with.
+func (d *Service) SetClientOptions(opts ...cast.Option) {
+	d.mu.Lock()
+	d.clientOptions = opts
+	d.mu.Unlock()
+}
+
+func (d *Service) getLogger() *slog.Logger {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.logger
+}
+
+func (d *Service) query(timeout time.Duration) error {
+	return mdns.Query(&mdns.QueryParam{
 		Service: "_googlecast._tcp",
 		Domain:  "local",
-		Timeout: interval,
+		Timeout: timeout,
 		Entries: d.entriesCh,
+		Logger:  logger.Std(d.getLogger()),
 	})
+}
+
+func (d *Service) Run(ctx context.Context, interval time.Duration) error {
+	err := d.query(interval)
 	if err != nil {
 		return err
 	}
@@ -47,12 +79,7 @@ func (d *Service) Run(ctx context.Context, interval time.Duration) error {
 	for {
 		select {
 		case <-ticker.C:
-			err = mdns.Query(&mdns.QueryParam{
-				Service: "_googlecast._tcp",
-				Domain:  "local",
-				Timeout: time.Second * 3,
-				Entries: d.entriesCh,
-			})
+			err = d.query(time.Second * 3)
 			if err != nil {
 				return err
 			}
@@ -81,8 +108,12 @@ func (d *Service) listener(ctx context.Context) {
 			continue
 		}
 
-		log.Printf("New entry: %#v\n", entry)
-		client := cast.NewClient(entry.AddrV4, entry.Port)
+		d.mu.Lock()
+		logger := d.logger
+		opts := append([]cast.Option{cast.WithLogger(logger)}, d.clientOptions...)
+		d.mu.Unlock()
+		logger.Debug("new entry", "name", entry.Name, "host", entry.AddrV4, "port", entry.Port)
+		client := cast.NewClientWithOptions(entry.AddrV4, entry.Port, opts...)
 		info := decodeTxtRecord(entry.Info)
 		client.SetName(info["fn"])
 		client.SetInfo(info)
@@ -1,7 +1,8 @@
 package events
 
 type AppStopped struct {
-	AppID       string
-	DisplayName string
-	StatusText  string
+	AppID       string `json:"appId"`
+	SessionID   string `json:"sessionId"`
+	DisplayName string `json:"displayName"`
+	StatusText  string `json:"statusText"`
 }
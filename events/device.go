@@ -0,0 +1,18 @@
+package events
+
+// DeviceDiscovered is emitted by the daemon when discovery finds a new
+// device.
+type DeviceDiscovered struct {
+	Name  string `json:"name"`
+	UUID  string `json:"uuid"`
+	Model string `json:"model"`
+	Host  string `json:"host"`
+	Port  int    `json:"port"`
+}
+
+// DeviceLost is emitted by the daemon when a device it isn't connected to
+// stops answering discovery.
+type DeviceLost struct {
+	Name string `json:"name"`
+	UUID string `json:"uuid"`
+}
@@ -1,5 +1,17 @@
 package events
 
+import "encoding/json"
+
 type Disconnected struct {
 	Reason error
 }
+
+func (d Disconnected) MarshalJSON() ([]byte, error) {
+	reason := ""
+	if d.Reason != nil {
+		reason = d.Reason.Error()
+	}
+	return json.Marshal(struct {
+		Reason string `json:"reason"`
+	}{reason})
+}
@@ -0,0 +1,11 @@
+package events
+
+import "time"
+
+// LinkDegraded is emitted when the heartbeat round-trip time rises above
+// the configured threshold. Durations are encoded in nanoseconds.
+type LinkDegraded struct {
+	RTT       time.Duration `json:"rtt"`
+	Jitter    time.Duration `json:"jitter"`
+	Threshold time.Duration `json:"threshold"`
+}
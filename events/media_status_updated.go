@@ -1,7 +1,15 @@
 package events
 
 type MediaStatusUpdated struct {
-	PlayerState string
-	CurrentTime float64
-	MetaData    *string
+	PlayerState string `json:"playerState"`
+	// IdleReason tells why the player went IDLE: FINISHED, CANCELLED,
+	// INTERRUPTED or ERROR.
+	IdleReason  string  `json:"idleReason,omitempty"`
+	CurrentTime float64 `json:"currentTime"`
+	// Duration of the current media in seconds, zero if unknown.
+	Duration float64 `json:"duration,omitempty"`
+	IsLive   bool    `json:"isLive"`
+	MetaData *string `json:"metadata,omitempty"`
+	// SupportedCommands names the media commands the current app accepts.
+	SupportedCommands []string `json:"supportedCommands,omitempty"`
 }
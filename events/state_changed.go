@@ -0,0 +1,8 @@
+package events
+
+// StateChanged is emitted when a client moves between connection states.
+// From and To are the names of the states.
+type StateChanged struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
@@ -1,7 +1,7 @@
 package events
 
 type StatusUpdated struct {
-	Level       float64
-	Muted       bool
-	DisplayName string
+	Level       float64 `json:"level"`
+	Muted       bool    `json:"muted"`
+	DisplayName string  `json:"displayName"`
 }
@@ -1,15 +1,64 @@
+// Package logger provides the structured loggers used across go-cast.
+//
+// The library never writes to the standard logger. Clients, connections and
+// the discovery service log through an injected *slog.Logger and are silent
+// until one is set.
 package logger
 
 import (
+	"context"
 	"io"
 	"log"
+	"log/slog"
+	"strings"
 )
 
-var CastDebug = false
+// Level is the minimum level of loggers created with New. It can be
+// adjusted at runtime, e.g. logger.Level.Set(slog.LevelDebug) to trace
+// every message sent and received.
+var Level = new(slog.LevelVar)
 
-func init() {
-	if !CastDebug {
-		log.SetOutput(io.Discard)
+// New returns a text logger writing to w, filtered by Level.
+func New(w io.Writer) *slog.Logger {
+	return slog.New(slog.NewTextHandler(w, &slog.HandlerOptions{Level: Level}))
+}
+
+// Std returns a standard library logger writing to l, for dependencies
+// that only take a *log.Logger. Lines with an "[ERR]" or "[WARN]" prefix
+// are logged as errors or warnings, and everything else at Debug, as such
+// libraries also report routine work.
+func Std(l *slog.Logger) *log.Logger {
+	return log.New(stdWriter{l}, "", 0)
+}
+
+type stdWriter struct {
+	logger *slog.Logger
+}
+
+func (w stdWriter) Write(p []byte) (int, error) {
+	msg := strings.TrimSuffix(string(p), "\n")
+	level := slog.LevelDebug
+	for prefix, l := range map[string]slog.Level{"[ERR]": slog.LevelError, "[WARN]": slog.LevelWarn, "[INFO]": slog.LevelDebug, "[DEBUG]": slog.LevelDebug} {
+		if strings.HasPrefix(msg, prefix) {
+			level = l
+			msg = strings.TrimSpace(msg[len(prefix):])
+			break
+		}
 	}
-	log.SetFlags(log.LstdFlags | log.Lmicroseconds | log.Lshortfile)
+	w.logger.Log(context.Background(), level, msg)
+	return len(p), nil
 }
+
+// Discard returns a logger that drops all records.
+func Discard() *slog.Logger {
+	return discard
+}
+
+var discard = slog.New(discardHandler{})
+
+type discardHandler struct{}
+
+func (discardHandler) Enabled(context.Context, slog.Level) bool  { return false }
+func (discardHandler) Handle(context.Context, slog.Record) error { return nil }
+func (h discardHandler) WithAttrs([]slog.Attr) slog.Handler      { return h }
+func (h discardHandler) WithGroup(string) slog.Handler           { return h }
@@ -0,0 +1,33 @@
+package logger
+
+import (
+	"bytes"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStd(t *testing.T) {
+	var buf bytes.Buffer
+	l := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{
+		Level: slog.LevelDebug,
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if a.Key == slog.TimeKey {
+				return slog.Attr{}
+			}
+			return a
+		},
+	}))
+
+	std := Std(l)
+	std.Printf("[ERR] mdns: Failed to bind to udp6 port: %v", "denied")
+	std.Printf("[WARN] mdns: slow")
+	std.Printf("[INFO] mdns: Closing client")
+	std.Print("plain")
+	assert.Equal(t, `level=ERROR msg="mdns: Failed to bind to udp6 port: denied"
+level=WARN msg="mdns: slow"
+level=DEBUG msg="mdns: Closing client"
+level=DEBUG msg=plain
+`, buf.String())
+}
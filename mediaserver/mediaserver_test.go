@@ -0,0 +1,156 @@
+package mediaserver
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+
+	"github.com/vkl/go-cast/controllers"
+)
+
+// id3 returns an ID3v2.3 tag with the given text frames, followed by a
+// few bytes standing in for the audio.
+func id3(frames map[string]string) []byte {
+	body := &bytes.Buffer{}
+	for _, id := range []string{"TIT2", "TPE1", "TALB", "TRCK", "TPOS"} {
+		text, ok := frames[id]
+		if !ok {
+			continue
+		}
+		body.WriteString(id)
+		binary.Write(body, binary.BigEndian, uint32(len(text)+1))
+		body.Write([]byte{0, 0, 0}) // flags, ISO-8859-1 encoding
+		body.WriteString(text)
+	}
+	size := body.Len()
+	tag := []byte{'I', 'D', '3', 3, 0, 0,
+		byte(size >> 21 & 0x7f), byte(size >> 14 & 0x7f), byte(size >> 7 & 0x7f), byte(size & 0x7f)}
+	return append(append(tag, body.Bytes()...), 0xff, 0xfb, 0x90, 0x00)
+}
+
+func writeFile(t *testing.T, path string, data []byte) {
+	assert.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+	assert.NoError(t, os.WriteFile(path, data, 0644))
+}
+
+func TestScan(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "b.mp3"), id3(map[string]string{
+		"TIT2": "Second", "TPE1": "Band", "TALB": "Album", "TRCK": "2/3"}))
+	writeFile(t, filepath.Join(dir, "a.mp3"), id3(map[string]string{
+		"TIT2": "Third", "TRCK": "3/3"}))
+	writeFile(t, filepath.Join(dir, "c.mp3"), id3(map[string]string{
+		"TIT2": "First", "TRCK": "1"}))
+	writeFile(t, filepath.Join(dir, "CD2", "01 Untagged.flac"), []byte("fLaC"))
+	writeFile(t, filepath.Join(dir, "cover.jpg"), []byte{0xff, 0xd8})
+	writeFile(t, filepath.Join(dir, "notes.txt"), []byte("notes"))
+	writeFile(t, filepath.Join(dir, ".hidden", "x.mp3"), []byte{})
+
+	tracks, err := Scan(dir)
+	assert.NoError(t, err)
+	titles := []string{}
+	for _, track := range tracks {
+		titles = append(titles, track.Title)
+	}
+	assert.Equal(t, []string{"First", "Second", "Third", "01 Untagged"}, titles)
+	assert.Equal(t, "Band", tracks[1].Artist)
+	assert.Equal(t, "Album", tracks[1].Album)
+	assert.Equal(t, 2, tracks[1].Number)
+
+	tracks, err = Scan(filepath.Join(dir, "b.mp3"))
+	assert.NoError(t, err)
+	assert.Len(t, tracks, 1)
+
+	_, err = Scan(filepath.Join(dir, "notes.txt"))
+	assert.Error(t, err)
+	empty := t.TempDir()
+	_, err = Scan(empty)
+	assert.EqualError(t, err, "no playable files in "+empty)
+}
+
+func TestServer(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "My Song.mp3")
+	writeFile(t, path, []byte("0123456789"))
+
+	server := New()
+	assert.NoError(t, server.Listen("127.0.0.1:0"))
+	defer server.Close()
+
+	cover := &Picture{MIMEType: "image/png", Ext: "png", Data: []byte("png")}
+	items, err := server.QueueItems(context.Background(), []Track{
+		{Path: path, Title: "My Song", Cover: cover},
+		{Path: path, Title: "Again", Cover: cover},
+	}, nil)
+	assert.NoError(t, err)
+	assert.Len(t, items, 2)
+	media := items[0].Media
+	assert.True(t, strings.HasPrefix(media.ContentId, server.URL()+"/"))
+	assert.True(t, strings.HasSuffix(media.ContentId, "/My%20Song.mp3"))
+	assert.Equal(t, "audio/mpeg", media.ContentType)
+	assert.Equal(t, "My Song", media.MetaData.Title)
+	// one cover for the album
+	assert.Equal(t, media.MetaData.Images, items[1].Media.MetaData.Images)
+
+	req, _ := http.NewRequest(http.MethodGet, media.ContentId, nil)
+	req.Header.Set("Range", "bytes=2-4")
+	resp, err := http.DefaultClient.Do(req)
+	assert.NoError(t, err)
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusPartialContent, resp.StatusCode)
+	assert.Equal(t, "234", string(body))
+	assert.Equal(t, "audio/mpeg", resp.Header.Get("Content-Type"))
+	assert.Equal(t, "*", resp.Header.Get("Access-Control-Allow-Origin"))
+
+	resp, err = http.Get(media.MetaData.Images[0].Url)
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, "image/png", resp.Header.Get("Content-Type"))
+
+	resp, err = http.Get(server.URL() + "/1/My%20Song.mp3")
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func TestSubtitles(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "movie.mp4"), []byte("video"))
+	writeFile(t, filepath.Join(dir, "movie.en.srt"), []byte("1\n00:00:05,000 --> 00:00:06,000\nHello\n"))
+
+	tracks, err := Scan(dir)
+	assert.NoError(t, err)
+	assert.Len(t, tracks, 1)
+	assert.Len(t, tracks[0].Subtitles, 1)
+	assert.Equal(t, "en", tracks[0].Subtitles[0].Language)
+
+	server := New()
+	assert.NoError(t, server.Listen("127.0.0.1:0"))
+	defer server.Close()
+	server.SetSubtitleOffset(-time.Second)
+	items, err := server.QueueItems(context.Background(), tracks, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []int{1}, items[0].ActiveTrackIds)
+	textTrack := items[0].Media.Tracks[0]
+	assert.Equal(t, controllers.TrackTypeText, textTrack.Type)
+	assert.Equal(t, "text/vtt", textTrack.TrackContentType)
+	assert.True(t, strings.HasSuffix(textTrack.TrackContentId, "/movie.en.vtt"))
+
+	resp, err := http.Get(textTrack.TrackContentId)
+	assert.NoError(t, err)
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.Equal(t, "text/vtt", resp.Header.Get("Content-Type"))
+	assert.Equal(t, "*", resp.Header.Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "WEBVTT\n\n00:00:04.000 --> 00:00:05.000\nHello\n", string(body))
+}
@@ -0,0 +1,181 @@
+// Package mediaserver serves local files over HTTP so that a cast device
+// can play them, and reads their tags to describe them.
+package mediaserver
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/vkl/go-cast/controllers"
+)
+
+// resource is a file on disk, or data held in memory.
+type resource struct {
+	path        string
+	data        []byte
+	contentType string
+	modTime     time.Time
+}
+
+// Server serves the files added to it under paths that can't be guessed
+// from outside. Responses
+// allow cross-origin requests, which receivers need for text tracks and
+// adaptive streams, and support range requests for seeking.
+type Server struct {
+	mu        sync.Mutex
+	resources map[string]*resource
+	next      int
+	token     string
+	server    *http.Server
+	baseURL   string
+	// subtitleOffset shifts the subtitles served
+	subtitleOffset time.Duration
+}
+
+func New() *Server {
+	token := make([]byte, 8)
+	rand.Read(token)
+	return &Server{
+		resources: map[string]*resource{},
+		token:     hex.EncodeToString(token),
+	}
+}
+
+// LocalAddr returns the address of the local interface that routes to the
+// device, for it to reach the server.
+func LocalAddr(device net.IP) (net.IP, error) {
+	conn, err := net.Dial("udp", net.JoinHostPort(device.String(), "8009"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to find a route to %s: %w", device, err)
+	}
+	defer conn.Close()
+	return conn.LocalAddr().(*net.UDPAddr).IP, nil
+}
+
+// Listen starts serving on addr, such as "192.168.1.10:0" to pick a free
+// port on the interface the device can reach.
+func (s *Server) Listen(addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", addr, err)
+	}
+	s.mu.Lock()
+	s.server = &http.Server{Handler: s}
+	s.baseURL = "http://" + listener.Addr().String()
+	s.mu.Unlock()
+
+	go s.server.Serve(listener)
+	return nil
+}
+
+// URL returns the base URL of the server, once listening.
+func (s *Server) URL() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.baseURL
+}
+
+// SetSubtitleOffset shifts the subtitles added afterwards by offset,
+// negative to show them earlier.
+func (s *Server) SetSubtitleOffset(offset time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.subtitleOffset = offset
+}
+
+func (s *Server) SubtitleOffset() time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.subtitleOffset
+}
+
+// Close stops the server.
+func (s *Server) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.server == nil {
+		return nil
+	}
+	err := s.server.Close()
+	s.server = nil
+	return err
+}
+
+// AddFile serves the file at path and returns its URL. The URL keeps the
+// file name, so its extension tells the content type. Files are added once
+// the server is listening.
+func (s *Server) AddFile(path string) string {
+	return s.add(filepath.Base(path), &resource{path: path})
+}
+
+// AddData serves data as a file named name and returns its URL.
+func (s *Server) AddData(name, contentType string, data []byte) string {
+	return s.add(name, &resource{data: data, contentType: contentType, modTime: time.Now()})
+}
+
+func (s *Server) add(name string, r *resource) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.next++
+	p := "/" + s.token + "/" + strconv.Itoa(s.next) + "/" + name
+	s.resources[p] = r
+	return s.baseURL + (&url.URL{Path: p}).EscapedPath()
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	header := w.Header()
+	header.Set("Access-Control-Allow-Origin", "*")
+	header.Set("Access-Control-Allow-Methods", "GET, HEAD, OPTIONS")
+	header.Set("Access-Control-Allow-Headers", "Range, Content-Type")
+	header.Set("Access-Control-Expose-Headers", "Content-Length, Content-Range, Accept-Ranges")
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	s.mu.Lock()
+	res, ok := s.resources[r.URL.Path]
+	s.mu.Unlock()
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	name := path.Base(r.URL.Path)
+	if res.contentType != "" {
+		header.Set("Content-Type", res.contentType)
+	} else if contentType, _ := controllers.ContentTypeOf(name); contentType != "" {
+		header.Set("Content-Type", contentType)
+	}
+
+	if res.data != nil {
+		http.ServeContent(w, r, name, res.modTime, bytes.NewReader(res.data))
+		return
+	}
+	f, err := os.Open(res.path)
+	if err != nil {
+		http.Error(w, "file not available", http.StatusNotFound)
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		http.Error(w, "file not available", http.StatusNotFound)
+		return
+	}
+	http.ServeContent(w, r, name, info.ModTime(), f)
+}
@@ -0,0 +1,203 @@
+package mediaserver
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/dhowden/tag"
+	"golang.org/x/net/context"
+
+	"github.com/vkl/go-cast/controllers"
+	"github.com/vkl/go-cast/subtitle"
+)
+
+// Picture is embedded cover art.
+type Picture struct {
+	MIMEType string
+	Ext      string
+	Data     []byte
+}
+
+// Track is a local media file and the tags read from it.
+type Track struct {
+	Path   string
+	Title  string
+	Artist string
+	Album  string
+	Disc   int
+	Number int
+	Cover  *Picture
+	// Subtitles are the subtitle files of a video, served as text tracks.
+	Subtitles []subtitle.Sidecar
+}
+
+// ReadTrack reads the ID3, Vorbis or MP4 tags of the file at path. Files
+// without tags are titled after their file name.
+func ReadTrack(path string) (Track, error) {
+	track := Track{
+		Path:  path,
+		Title: strings.TrimSuffix(filepath.Base(path), filepath.Ext(path)),
+	}
+	if contentType, _ := controllers.ContentTypeOf(path); strings.HasPrefix(contentType, "video/") {
+		sidecars, err := subtitle.FindSidecars(path)
+		if err != nil {
+			return track, err
+		}
+		track.Subtitles = sidecars
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return track, err
+	}
+	defer f.Close()
+
+	metadata, err := tag.ReadFrom(f)
+	if err != nil {
+		// missing or unreadable tags shouldn't stop the file from playing
+		return track, nil
+	}
+	if title := metadata.Title(); title != "" {
+		track.Title = title
+	}
+	track.Artist = metadata.Artist()
+	if track.Artist == "" {
+		track.Artist = metadata.AlbumArtist()
+	}
+	track.Album = metadata.Album()
+	track.Number, _ = metadata.Track()
+	track.Disc, _ = metadata.Disc()
+	if picture := metadata.Picture(); picture != nil && len(picture.Data) > 0 {
+		track.Cover = &Picture{MIMEType: picture.MIMEType, Ext: picture.Ext, Data: picture.Data}
+	}
+	return track, nil
+}
+
+// Scan returns the playable tracks of a file or, recursively, a directory,
+// in album order: by directory, disc and track number, then file name.
+func Scan(root string) ([]Track, error) {
+	info, err := os.Stat(root)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		if _, supported := controllers.ContentTypeOf(root); !supported {
+			return nil, fmt.Errorf("%s is not in a format the device can play", root)
+		}
+		track, err := ReadTrack(root)
+		if err != nil {
+			return nil, err
+		}
+		return []Track{track}, nil
+	}
+
+	tracks := []Track{}
+	err = filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			if path != root && strings.HasPrefix(entry.Name(), ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		// skip hidden files and cover art
+		contentType, supported := controllers.ContentTypeOf(path)
+		if !supported || strings.HasPrefix(contentType, "image/") || strings.HasPrefix(entry.Name(), ".") {
+			return nil
+		}
+		track, err := ReadTrack(path)
+		if err != nil {
+			return err
+		}
+		tracks = append(tracks, track)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(tracks) == 0 {
+		return nil, fmt.Errorf("no playable files in %s", root)
+	}
+	sortTracks(tracks)
+	return tracks, nil
+}
+
+func sortTracks(tracks []Track) {
+	sort.SliceStable(tracks, func(i, j int) bool {
+		a, b := tracks[i], tracks[j]
+		if dirA, dirB := filepath.Dir(a.Path), filepath.Dir(b.Path); dirA != dirB {
+			return dirA < dirB
+		}
+		if a.Disc != b.Disc {
+			return a.Disc < b.Disc
+		}
+		if a.Number != b.Number {
+			return a.Number < b.Number
+		}
+		return a.Path < b.Path
+	})
+}
+
+// QueueItems serves the tracks, their cover art and subtitles, and returns
+// queue items to play them in order. Cover art shared by an album is served
+// once. The first subtitle track of each item is enabled.
+func (s *Server) QueueItems(ctx context.Context, tracks []Track, probe *controllers.ContentProbe) ([]controllers.MediaItemQueue, error) {
+	if probe == nil {
+		probe = &controllers.ContentProbe{}
+	}
+	covers := map[string]string{}
+	items := make([]controllers.MediaItemQueue, 0, len(tracks))
+	for _, track := range tracks {
+		media, err := probe.Probe(ctx, s.AddFile(track.Path))
+		if err != nil {
+			return nil, err
+		}
+		media.MetaData.Title = track.Title
+		media.MetaData.Artist = track.Artist
+		media.MetaData.AlbumName = track.Album
+		if track.Cover != nil {
+			sum := sha1.Sum(track.Cover.Data)
+			key := hex.EncodeToString(sum[:])
+			if _, ok := covers[key]; !ok {
+				ext := track.Cover.Ext
+				if ext == "" {
+					ext = "jpg"
+				}
+				covers[key] = s.AddData("cover."+ext, track.Cover.MIMEType, track.Cover.Data)
+			}
+			media.MetaData.Images = []controllers.MediaImage{{Url: covers[key]}}
+		}
+		item := controllers.MediaItemQueue{Media: media, Autoplay: true}
+		for i, sidecar := range track.Subtitles {
+			textTrack, err := s.AddSubtitles(sidecar, i+1)
+			if err != nil {
+				return nil, err
+			}
+			item.Media.Tracks = append(item.Media.Tracks, textTrack)
+		}
+		if len(item.Media.Tracks) > 0 {
+			item.ActiveTrackIds = []int{item.Media.Tracks[0].TrackId}
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+// AddSubtitles serves a subtitle file converted to WebVTT, shifted by the
+// subtitle offset, and returns a text track with the given id for it.
+func (s *Server) AddSubtitles(sidecar subtitle.Sidecar, id int) (controllers.MediaTrack, error) {
+	data, err := subtitle.ConvertFile(sidecar.Path, s.SubtitleOffset())
+	if err != nil {
+		return controllers.MediaTrack{}, err
+	}
+	name := strings.TrimSuffix(filepath.Base(sidecar.Path), filepath.Ext(sidecar.Path)) + ".vtt"
+	url := s.AddData(name, subtitle.ContentTypeVTT, data)
+	return controllers.NewTextTrack(id, url, sidecar.Name, sidecar.Language), nil
+}
@@ -0,0 +1,253 @@
+// Package metrics exports the measurements of cast devices to Prometheus.
+//
+// Every series of a device carries its ID, the UUID or address, as the
+// device label and its name as the name label.
+package metrics
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"golang.org/x/net/context"
+
+	"github.com/vkl/go-cast"
+	"github.com/vkl/go-cast/controllers"
+	castnet "github.com/vkl/go-cast/net"
+)
+
+const namespace = "cast"
+
+var playerStates = []string{"IDLE", "PLAYING", "PAUSED", "BUFFERING"}
+
+var states = []cast.State{
+	cast.StateDisconnected,
+	cast.StateConnecting,
+	cast.StateConnected,
+	cast.StateAppLaunching,
+	cast.StateAppConnected,
+	cast.StateClosing,
+}
+
+// Collector collects the measurements of the devices. It is a
+// prometheus.Collector, to register with a registry of one's own, and
+// serves them itself with Handler.
+type Collector struct {
+	registry *prometheus.Registry
+
+	devices          prometheus.Gauge
+	connectionState  *prometheus.GaugeVec
+	reconnects       *prometheus.CounterVec
+	heartbeatRTT     *prometheus.HistogramVec
+	messagesSent     *prometheus.CounterVec
+	messagesReceived *prometheus.CounterVec
+	requestDuration  *prometheus.HistogramVec
+	requestErrors    *prometheus.CounterVec
+	volume           *prometheus.GaugeVec
+	muted            *prometheus.GaugeVec
+	playerState      *prometheus.GaugeVec
+}
+
+func NewCollector() *Collector {
+	device := []string{"device", "name"}
+	c := &Collector{
+		devices: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "devices",
+			Help:      "Number of known devices.",
+		}),
+		connectionState: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "connection_state",
+			Help:      "Connection state of the device, 1 for the current state.",
+		}, append(device, "state")),
+		reconnects: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "reconnects_total",
+			Help:      "Number of times the device was reconnected after losing its connection.",
+		}, device),
+		heartbeatRTT: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "heartbeat_rtt_seconds",
+			Help:      "Round-trip time of the heartbeat pings.",
+			Buckets:   []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5},
+		}, device),
+		messagesSent: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "messages_sent_total",
+			Help:      "Number of messages sent to the device.",
+		}, append(device, "namespace")),
+		messagesReceived: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "messages_received_total",
+			Help:      "Number of messages received from the device.",
+		}, append(device, "namespace")),
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "request_duration_seconds",
+			Help:      "Time the device took to answer requests.",
+			Buckets:   []float64{.01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30},
+		}, append(device, "namespace", "type")),
+		requestErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "request_errors_total",
+			Help:      "Number of failed requests, by error response type, or timeout, cancelled or failed when none came.",
+		}, append(device, "namespace", "type", "response")),
+		volume: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "volume_level",
+			Help:      "Volume level of the device, between 0 and 1.",
+		}, device),
+		muted: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "volume_muted",
+			Help:      "Whether the device is muted.",
+		}, device),
+		playerState: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "player_state",
+			Help:      "State of the media player of the device, 1 for the current state.",
+		}, append(device, "state")),
+	}
+	c.registry = prometheus.NewRegistry()
+	c.registry.MustRegister(c, collectors.NewGoCollector(), collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
+	return c
+}
+
+func (c *Collector) collectors() []prometheus.Collector {
+	return []prometheus.Collector{
+		c.devices,
+		c.connectionState,
+		c.reconnects,
+		c.heartbeatRTT,
+		c.messagesSent,
+		c.messagesReceived,
+		c.requestDuration,
+		c.requestErrors,
+		c.volume,
+		c.muted,
+		c.playerState,
+	}
+}
+
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	for _, collector := range c.collectors() {
+		collector.Describe(ch)
+	}
+}
+
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	for _, collector := range c.collectors() {
+		collector.Collect(ch)
+	}
+}
+
+// Handler serves the measurements, along with those of the Go runtime and
+// the process, in the Prometheus exposition format.
+func (c *Collector) Handler() http.Handler {
+	return promhttp.HandlerFor(c.registry, promhttp.HandlerOpts{})
+}
+
+// SetDevices sets the number of known devices.
+func (c *Collector) SetDevices(count int) {
+	c.devices.Set(float64(count))
+}
+
+// SetState sets the connection state of a device.
+func (c *Collector) SetState(id, name string, state cast.State) {
+	for _, s := range states {
+		value := 0.0
+		if s == state {
+			value = 1
+		}
+		c.connectionState.WithLabelValues(id, name, s.String()).Set(value)
+	}
+}
+
+// Reconnected counts a reconnection of a device.
+func (c *Collector) Reconnected(id, name string) {
+	c.reconnects.WithLabelValues(id, name).Inc()
+}
+
+// Forget removes the series of a device that is gone.
+func (c *Collector) Forget(id string) {
+	labels := prometheus.Labels{"device": id}
+	c.connectionState.DeletePartialMatch(labels)
+	c.reconnects.DeletePartialMatch(labels)
+	c.heartbeatRTT.DeletePartialMatch(labels)
+	c.messagesSent.DeletePartialMatch(labels)
+	c.messagesReceived.DeletePartialMatch(labels)
+	c.requestDuration.DeletePartialMatch(labels)
+	c.requestErrors.DeletePartialMatch(labels)
+	c.volume.DeletePartialMatch(labels)
+	c.muted.DeletePartialMatch(labels)
+	c.playerState.DeletePartialMatch(labels)
+}
+
+// Device returns the castnet.Metrics of a device, to pass to its client
+// with cast.WithMetrics or SetMetrics.
+func (c *Collector) Device(id, name string) castnet.Metrics {
+	return &deviceMetrics{collector: c, id: id, name: name}
+}
+
+type deviceMetrics struct {
+	collector *Collector
+	id        string
+	name      string
+}
+
+func (m *deviceMetrics) MessageSent(namespace string) {
+	m.collector.messagesSent.WithLabelValues(m.id, m.name, namespace).Inc()
+}
+
+func (m *deviceMetrics) MessageReceived(namespace string) {
+	m.collector.messagesReceived.WithLabelValues(m.id, m.name, namespace).Inc()
+}
+
+func (m *deviceMetrics) RequestDone(namespace, requestType, responseType string, duration time.Duration, err error) {
+	if err != nil {
+		m.collector.requestErrors.WithLabelValues(m.id, m.name, namespace, requestType, errorKind(err)).Inc()
+		return
+	}
+	m.collector.requestDuration.WithLabelValues(m.id, m.name, namespace, requestType).Observe(duration.Seconds())
+	if controllers.IsErrorResponse(responseType) {
+		m.collector.requestErrors.WithLabelValues(m.id, m.name, namespace, requestType, responseType).Inc()
+	}
+}
+
+// errorKind names the failure of a request that got no response.
+func errorKind(err error) string {
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return "timeout"
+	case errors.Is(err, context.Canceled):
+		return "cancelled"
+	}
+	return "failed"
+}
+
+func (m *deviceMetrics) HeartbeatRTT(rtt time.Duration) {
+	m.collector.heartbeatRTT.WithLabelValues(m.id, m.name).Observe(rtt.Seconds())
+}
+
+func (m *deviceMetrics) Volume(level float64, muted bool) {
+	m.collector.volume.WithLabelValues(m.id, m.name).Set(level)
+	value := 0.0
+	if muted {
+		value = 1
+	}
+	m.collector.muted.WithLabelValues(m.id, m.name).Set(value)
+}
+
+func (m *deviceMetrics) PlayerState(state string) {
+	for _, s := range playerStates {
+		value := 0.0
+		if s == state {
+			value = 1
+		}
+		m.collector.playerState.WithLabelValues(m.id, m.name, s).Set(value)
+	}
+}
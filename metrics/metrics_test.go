@@ -0,0 +1,67 @@
+package metrics
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+
+	"github.com/vkl/go-cast"
+)
+
+func TestCollector(t *testing.T) {
+	collector := NewCollector()
+	device := collector.Device("uuid-1", "Hifi")
+
+	device.MessageSent("urn:x-cast:com.google.cast.media")
+	device.MessageSent("urn:x-cast:com.google.cast.media")
+	device.MessageReceived("urn:x-cast:com.google.cast.media")
+	assert.Equal(t, 2.0, testutil.ToFloat64(collector.messagesSent.WithLabelValues("uuid-1", "Hifi", "urn:x-cast:com.google.cast.media")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(collector.messagesReceived.WithLabelValues("uuid-1", "Hifi", "urn:x-cast:com.google.cast.media")))
+
+	device.RequestDone("urn:x-cast:com.google.cast.media", "LOAD", "MEDIA_STATUS", time.Millisecond*20, nil)
+	device.RequestDone("urn:x-cast:com.google.cast.media", "LOAD", "LOAD_FAILED", time.Millisecond*30, nil)
+	device.RequestDone("urn:x-cast:com.google.cast.media", "LOAD", "", time.Second, context.DeadlineExceeded)
+	device.RequestDone("urn:x-cast:com.google.cast.media", "LOAD", "", 0, errors.New("broken pipe"))
+	assert.Equal(t, 1, testutil.CollectAndCount(collector.requestDuration))
+	assert.Equal(t, 1.0, testutil.ToFloat64(collector.requestErrors.WithLabelValues("uuid-1", "Hifi", "urn:x-cast:com.google.cast.media", "LOAD", "LOAD_FAILED")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(collector.requestErrors.WithLabelValues("uuid-1", "Hifi", "urn:x-cast:com.google.cast.media", "LOAD", "timeout")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(collector.requestErrors.WithLabelValues("uuid-1", "Hifi", "urn:x-cast:com.google.cast.media", "LOAD", "failed")))
+
+	device.Volume(0.4, true)
+	assert.Equal(t, 0.4, testutil.ToFloat64(collector.volume.WithLabelValues("uuid-1", "Hifi")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(collector.muted.WithLabelValues("uuid-1", "Hifi")))
+
+	device.PlayerState("PLAYING")
+	device.PlayerState("PAUSED")
+	assert.Equal(t, 0.0, testutil.ToFloat64(collector.playerState.WithLabelValues("uuid-1", "Hifi", "PLAYING")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(collector.playerState.WithLabelValues("uuid-1", "Hifi", "PAUSED")))
+
+	collector.SetState("uuid-1", "Hifi", cast.StateConnected)
+	collector.SetState("uuid-1", "Hifi", cast.StateAppConnected)
+	assert.Equal(t, 0.0, testutil.ToFloat64(collector.connectionState.WithLabelValues("uuid-1", "Hifi", "Connected")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(collector.connectionState.WithLabelValues("uuid-1", "Hifi", "AppConnected")))
+
+	collector.Forget("uuid-1")
+	assert.Equal(t, 0, testutil.CollectAndCount(collector.connectionState))
+	assert.Equal(t, 0, testutil.CollectAndCount(collector.volume))
+}
+
+func TestHandler(t *testing.T) {
+	collector := NewCollector()
+	collector.SetDevices(2)
+	collector.Device("uuid-1", "Hifi").HeartbeatRTT(time.Millisecond * 12)
+
+	recorder := httptest.NewRecorder()
+	collector.Handler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	body := recorder.Body.String()
+	assert.Contains(t, body, "cast_devices 2\n")
+	assert.Contains(t, body, `cast_heartbeat_rtt_seconds_count{device="uuid-1",name="Hifi"} 1`)
+	assert.Contains(t, body, "go_goroutines")
+}
@@ -0,0 +1,431 @@
+// Package mqttbridge publishes the state of cast devices to an MQTT broker
+// and controls them from command topics.
+//
+// Under the topic prefix, each device has:
+//
+//	<prefix>/<device>/state          retained JSON DeviceState
+//	<prefix>/<device>/availability   retained "online" or "offline"
+//	<prefix>/<device>/error          the error of a failed command
+//	<prefix>/<device>/command/<cmd>  commands: play, pause, stop,
+//	                                 quit ("force" for others' apps),
+//	                                 volume ("0.4"), mute ("true"),
+//	                                 load (a URL or a daemon.LoadRequest)
+//
+// Devices are named by a slug of their name, such as living-room, or by
+// their UUID when another device took the slug first. Commands also accept
+// the UUID, and are dropped for unknown devices. A device is offline while
+// its connection is lost or once discovery loses it. <prefix>/bridge/state
+// is "online" while the bridge is connected.
+package mqttbridge
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"golang.org/x/net/context"
+
+	"github.com/vkl/go-cast"
+	"github.com/vkl/go-cast/api"
+	"github.com/vkl/go-cast/controllers"
+	"github.com/vkl/go-cast/daemon"
+	"github.com/vkl/go-cast/events"
+	"github.com/vkl/go-cast/logger"
+)
+
+const DefaultPrefix = "cast"
+
+// publishTimeout bounds waiting for the broker to acknowledge a message.
+const publishTimeout = time.Second * 10
+
+// DeviceState is the retained state of a device.
+type DeviceState struct {
+	Name        string  `json:"name"`
+	UUID        string  `json:"uuid"`
+	Model       string  `json:"model,omitempty"`
+	Host        string  `json:"host"`
+	Connected   bool    `json:"connected"`
+	App         string  `json:"app,omitempty"`
+	Volume      float64 `json:"volume"`
+	Muted       bool    `json:"muted"`
+	PlayerState string  `json:"playerState,omitempty"`
+	Title       string  `json:"title,omitempty"`
+	CurrentTime float64 `json:"currentTime,omitempty"`
+	Duration    float64 `json:"duration,omitempty"`
+}
+
+// apply updates the state with event and reports whether it changed.
+func (s *DeviceState) apply(event events.Event) bool {
+	before := *s
+	switch e := event.(type) {
+	case events.DeviceDiscovered:
+		s.Name, s.UUID, s.Model, s.Host = e.Name, e.UUID, e.Model, e.Host
+	case events.Connected:
+		s.Connected = true
+	case events.Disconnected:
+		s.Connected = false
+	case events.StatusUpdated:
+		s.Volume, s.Muted, s.App = e.Level, e.Muted, e.DisplayName
+	case events.AppStarted:
+		s.App = e.DisplayName
+	case events.AppStopped:
+		s.App, s.PlayerState, s.Title, s.CurrentTime, s.Duration = "", "", "", 0, 0
+	case events.MediaStatusUpdated:
+		s.PlayerState, s.CurrentTime, s.Duration = e.PlayerState, e.CurrentTime, e.Duration
+		if e.MetaData != nil {
+			s.Title = *e.MetaData
+		}
+	}
+	return *s != before
+}
+
+// Bridge connects the devices of a daemon.Manager to an MQTT broker.
+type Bridge struct {
+	client  mqtt.Client
+	manager *daemon.Manager
+	prefix  string
+	timeout time.Duration
+	probe   *controllers.ContentProbe
+	logger  *slog.Logger
+
+	mu sync.Mutex
+	// states and topic ids are keyed by device ID
+	states    map[string]*DeviceState
+	topics    map[string]string
+	published map[string][]byte
+}
+
+// New returns a bridge that connects to the broker configured by opts. The
+// bridge sets the will and the connection handler of opts.
+func New(opts *mqtt.ClientOptions, manager *daemon.Manager, prefix string) *Bridge {
+	if prefix == "" {
+		prefix = DefaultPrefix
+	}
+	b := &Bridge{
+		manager:   manager,
+		prefix:    strings.TrimSuffix(prefix, "/"),
+		timeout:   daemon.DefaultTimeout,
+		probe:     &controllers.ContentProbe{},
+		logger:    logger.Discard(),
+		states:    map[string]*DeviceState{},
+		topics:    map[string]string{},
+		published: map[string][]byte{},
+	}
+	opts.SetWill(b.prefix+"/bridge/state", "offline", 1, true)
+	opts.SetOnConnectHandler(b.onConnect)
+	b.client = mqtt.NewClient(opts)
+	return b
+}
+
+func (b *Bridge) SetLogger(logger *slog.Logger) {
+	b.logger = logger
+}
+
+// SetTimeout bounds each command to a device.
+func (b *Bridge) SetTimeout(timeout time.Duration) {
+	b.timeout = timeout
+}
+
+// Run connects to the broker and bridges the devices until ctx is done.
+func (b *Bridge) Run(ctx context.Context) error {
+	if err := wait(b.client.Connect()); err != nil {
+		return fmt.Errorf("failed to connect to the broker: %w", err)
+	}
+	defer func() {
+		wait(b.client.Publish(b.prefix+"/bridge/state", 1, true, "offline"))
+		b.client.Disconnect(250)
+	}()
+
+	var last uint64
+	for {
+		backlog, ch, cancel := b.manager.Events().Subscribe(last)
+		for _, e := range backlog {
+			b.handleEvent(e)
+			last = e.ID
+		}
+	stream:
+		for {
+			select {
+			case <-ctx.Done():
+				cancel()
+				return nil
+			case e, ok := <-ch:
+				if !ok {
+					// fell behind, resume from the last event handled
+					break stream
+				}
+				b.handleEvent(e)
+				last = e.ID
+			}
+		}
+		cancel()
+	}
+}
+
+func wait(token mqtt.Token) error {
+	if !token.WaitTimeout(publishTimeout) {
+		return fmt.Errorf("timed out waiting for the broker")
+	}
+	return token.Error()
+}
+
+// onConnect subscribes to the commands and publishes the state again, in
+// case the broker lost it, on every connection.
+func (b *Bridge) onConnect(client mqtt.Client) {
+	b.logger.Info("connected to broker")
+	token := client.Subscribe(b.prefix+"/+/command/+", 1, func(_ mqtt.Client, message mqtt.Message) {
+		// commands can take a while, don't hold up other messages
+		go b.handleCommand(message.Topic(), message.Payload())
+	})
+	go func() {
+		if err := wait(token); err != nil {
+			b.logger.Warn("failed to subscribe to commands", "error", err)
+		}
+		b.publish(b.prefix+"/bridge/state", true, []byte("online"))
+		b.mu.Lock()
+		topics := make(map[string][]byte, len(b.published))
+		for topic, payload := range b.published {
+			topics[topic] = payload
+		}
+		b.mu.Unlock()
+		for topic, payload := range topics {
+			b.publish(topic, true, payload)
+		}
+	}()
+}
+
+func (b *Bridge) publish(topic string, retained bool, payload []byte) {
+	if err := wait(b.client.Publish(topic, 1, retained, payload)); err != nil {
+		b.logger.Warn("failed to publish", "topic", topic, "error", err)
+	}
+}
+
+// publishRetained publishes a retained payload unless it was already
+// published.
+func (b *Bridge) publishRetained(topic string, payload []byte) {
+	b.mu.Lock()
+	if bytes.Equal(b.published[topic], payload) {
+		b.mu.Unlock()
+		return
+	}
+	b.published[topic] = payload
+	b.mu.Unlock()
+	b.publish(topic, true, payload)
+}
+
+// topicID returns the topic segment of a device, a slug of its name or
+// its ID if it has no name.
+func topicID(name, id string) string {
+	slug := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+			return r
+		case r >= 'A' && r <= 'Z':
+			return r - 'A' + 'a'
+		}
+		return '-'
+	}, name)
+	slug = strings.Trim(slug, "-")
+	for strings.Contains(slug, "--") {
+		slug = strings.Replace(slug, "--", "-", -1)
+	}
+	if slug == "" {
+		return id
+	}
+	return slug
+}
+
+// uniqueTopicID returns the topic segment of a new device, falling back to
+// its ID when another device's name has the same slug, with b.mu held.
+func (b *Bridge) uniqueTopicID(name, id string) string {
+	taken := func(topic string) bool {
+		for _, t := range b.topics {
+			if t == topic {
+				return true
+			}
+		}
+		return false
+	}
+	topic := topicID(name, id)
+	if !taken(topic) {
+		return topic
+	}
+	topic = topicID(id, id)
+	for n := 2; taken(topic); n++ {
+		topic = fmt.Sprintf("%s-%d", topicID(id, id), n)
+	}
+	return topic
+}
+
+func (b *Bridge) handleEvent(e daemon.Event) {
+	b.mu.Lock()
+	state, ok := b.states[e.Device]
+	if !ok {
+		state = &DeviceState{Name: e.Name}
+		b.states[e.Device] = state
+		b.topics[e.Device] = b.uniqueTopicID(e.Name, e.Device)
+	}
+	changed := state.apply(e.Data)
+	topic := b.prefix + "/" + b.topics[e.Device]
+	payload, err := json.Marshal(state)
+	b.mu.Unlock()
+	if err != nil {
+		return
+	}
+
+	switch e.Data.(type) {
+	case events.DeviceDiscovered, events.Connected:
+		b.publishRetained(topic+"/availability", []byte("online"))
+	case events.Disconnected, events.DeviceLost:
+		b.publishRetained(topic+"/availability", []byte("offline"))
+	}
+	if changed || !ok {
+		b.publishRetained(topic+"/state", payload)
+	}
+}
+
+// device returns the device named by the topic segment id, and its topic
+// segment.
+func (b *Bridge) device(id string) (*daemon.Device, string, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for key, topic := range b.topics {
+		if topic == id {
+			id = key
+			break
+		}
+	}
+	device, ok := b.manager.Device(id)
+	if !ok {
+		return nil, "", false
+	}
+	topic, ok := b.topics[device.ID()]
+	return device, topic, ok
+}
+
+func (b *Bridge) handleCommand(topic string, payload []byte) {
+	parts := strings.Split(strings.TrimPrefix(topic, b.prefix+"/"), "/")
+	if len(parts) != 3 {
+		return
+	}
+	id, command := parts[0], parts[2]
+	device, deviceTopic, ok := b.device(id)
+	if !ok {
+		// no error topic for devices that don't exist, such as bridge
+		b.logger.Debug("command for unknown device", "device", id, "command", command)
+		return
+	}
+	b.logger.Debug("command", "device", id, "command", command)
+	err := b.command(device, command, strings.TrimSpace(string(payload)))
+	if err != nil {
+		b.logger.Warn("command failed", "device", id, "command", command, "error", err)
+		b.publish(b.prefix+"/"+deviceTopic+"/error", false, []byte(fmt.Sprintf("%s: %s", command, err)))
+	}
+}
+
+func (b *Bridge) command(device *daemon.Device, command, payload string) error {
+	run, err := b.commandFunc(command, payload)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), b.timeout)
+	defer cancel()
+	return device.Do(func(client *cast.Client) error {
+		return run(ctx, client)
+	})
+}
+
+// commandFunc parses a command, returning the function that runs it.
+func (b *Bridge) commandFunc(command, payload string) (func(context.Context, *cast.Client) error, error) {
+	switch command {
+	case "play":
+		return mediaCommand((*controllers.MediaController).Play), nil
+	case "pause":
+		return mediaCommand((*controllers.MediaController).Pause), nil
+	case "stop":
+		return mediaCommand((*controllers.MediaController).Stop), nil
+	case "quit":
+		force := payload == "force"
+		if payload != "" && !force {
+			return nil, fmt.Errorf(`quit takes no payload, or "force"`)
+		}
+		return func(ctx context.Context, client *cast.Client) error {
+			return receiverCommand(client, func(receiver *controllers.ReceiverController) error {
+				_, err := receiver.StopApp(ctx, force)
+				return err
+			})
+		}, nil
+	case "volume":
+		level, err := strconv.ParseFloat(payload, 64)
+		if err != nil || level < 0 || level > 1 {
+			return nil, fmt.Errorf("volume must be a number between 0 and 1")
+		}
+		return func(ctx context.Context, client *cast.Client) error {
+			return receiverCommand(client, func(receiver *controllers.ReceiverController) error {
+				_, err := receiver.SetVolumeLevel(ctx, level)
+				return err
+			})
+		}, nil
+	case "mute":
+		muted, err := strconv.ParseBool(payload)
+		if err != nil {
+			return nil, fmt.Errorf("mute must be true or false")
+		}
+		return func(ctx context.Context, client *cast.Client) error {
+			return receiverCommand(client, func(receiver *controllers.ReceiverController) error {
+				_, err := receiver.SetMuted(ctx, muted)
+				return err
+			})
+		}, nil
+	case "load":
+		request := daemon.LoadRequest{URL: payload}
+		if strings.HasPrefix(payload, "{") {
+			if err := json.Unmarshal([]byte(payload), &request); err != nil {
+				return nil, fmt.Errorf("invalid load request: %w", err)
+			}
+		}
+		return func(ctx context.Context, client *cast.Client) error {
+			item, err := request.MediaItem(ctx, b.probe)
+			if err != nil {
+				return err
+			}
+			appID := request.AppID
+			if appID == "" {
+				appID = cast.AppMedia
+			}
+			media, err := client.Media(ctx, appID)
+			if err != nil {
+				return err
+			}
+			autoplay := request.Autoplay == nil || *request.Autoplay
+			_, err = media.LoadMedia(ctx, item, int(request.CurrentTime), autoplay, map[string]interface{}{})
+			return err
+		}, nil
+	}
+	return nil, fmt.Errorf("unknown command %q", command)
+}
+
+func mediaCommand(fn func(*controllers.MediaController, context.Context) (*api.CastMessage, error)) func(context.Context, *cast.Client) error {
+	return func(ctx context.Context, client *cast.Client) error {
+		media, err := daemon.RunningMedia(ctx, client)
+		if err != nil {
+			return err
+		}
+		_, err = fn(media, ctx)
+		return err
+	}
+}
+
+func receiverCommand(client *cast.Client, fn func(*controllers.ReceiverController) error) error {
+	receiver, err := client.Receiver()
+	if err != nil {
+		return err
+	}
+	return fn(receiver)
+}
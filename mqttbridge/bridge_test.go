@@ -0,0 +1,165 @@
+package mqttbridge
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	server "github.com/mochi-mqtt/server/v2"
+	"github.com/mochi-mqtt/server/v2/hooks/auth"
+	"github.com/mochi-mqtt/server/v2/listeners"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+
+	"github.com/vkl/go-cast"
+	"github.com/vkl/go-cast/daemon"
+	"github.com/vkl/go-cast/events"
+	"github.com/vkl/go-cast/logger"
+	castnet "github.com/vkl/go-cast/net"
+)
+
+// startBroker starts an embedded broker and returns its URL.
+func startBroker(t *testing.T) string {
+	broker := server.New(&server.Options{Logger: logger.Discard()})
+	assert.NoError(t, broker.AddHook(new(auth.AllowHook), nil))
+	tcp := listeners.NewTCP(listeners.Config{ID: "tcp", Address: "127.0.0.1:0"})
+	assert.NoError(t, broker.AddListener(tcp))
+	go broker.Serve()
+	t.Cleanup(func() { broker.Close() })
+	return "tcp://" + tcp.Address()
+}
+
+// observer queues the messages published under the prefix by topic.
+type observer struct {
+	mu     sync.Mutex
+	topics map[string][]string
+}
+
+func observe(t *testing.T, url string) *observer {
+	o := &observer{topics: map[string][]string{}}
+	client := mqtt.NewClient(mqtt.NewClientOptions().AddBroker(url).SetClientID("observer"))
+	assert.NoError(t, wait(client.Connect()))
+	t.Cleanup(func() { client.Disconnect(0) })
+	assert.NoError(t, wait(client.Subscribe("cast/#", 1, func(_ mqtt.Client, message mqtt.Message) {
+		o.mu.Lock()
+		defer o.mu.Unlock()
+		o.topics[message.Topic()] = append(o.topics[message.Topic()], string(message.Payload()))
+	})))
+	return o
+}
+
+// next returns the next message on topic.
+func (o *observer) next(t *testing.T, topic string) string {
+	var payload string
+	received := func() bool {
+		o.mu.Lock()
+		defer o.mu.Unlock()
+		if len(o.topics[topic]) == 0 {
+			return false
+		}
+		payload, o.topics[topic] = o.topics[topic][0], o.topics[topic][1:]
+		return true
+	}
+	if !assert.Eventually(t, received, 5*time.Second, 10*time.Millisecond, "no message on %s", topic) {
+		t.FailNow()
+	}
+	return payload
+}
+
+// await skips the messages on topic until payload, as retained messages
+// may be published again on connection.
+func (o *observer) await(t *testing.T, topic, payload string) {
+	for o.next(t, topic) != payload {
+	}
+}
+
+func TestBridge(t *testing.T) {
+	url := startBroker(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	receiver := "urn:x-cast:com.google.cast.receiver"
+	replay := castnet.NewReplay([]castnet.Record{
+		{Direction: castnet.DirectionOutbound, Namespace: castnet.NamespaceConnection, Payload: `{"type":"CONNECT"}`},
+		{Direction: castnet.DirectionOutbound, Namespace: receiver, Payload: `{"type":"SET_VOLUME","requestId":1,"volume":{"level":0.3}}`},
+		{Direction: castnet.DirectionInbound, SourceId: cast.DefaultReceiver, DestinationId: cast.DefaultSender, Namespace: receiver,
+			Payload: `{"type":"RECEIVER_STATUS","requestId":1,"status":{"applications":[],"volume":{"level":0.3,"muted":false}}}`},
+		// hold the connection open
+		{Direction: castnet.DirectionOutbound, Namespace: "urn:x-cast:test"},
+	})
+	manager := daemon.NewManager(ctx)
+	manager.SetDialer(func(ctx context.Context, client *cast.Client) error {
+		return client.ConnectTransport(ctx, replay)
+	})
+	defer manager.Close()
+	client := cast.NewClientWithOptions(net.IPv4(192, 168, 1, 20), 8009, cast.WithSenderID(cast.DefaultSender))
+	client.SetName("Living Room")
+	client.SetInfo(map[string]string{"id": "uuid-1"})
+	manager.Add(client)
+	// its name has the same slug, it falls back to its UUID
+	namesake := cast.NewClientWithOptions(net.IPv4(192, 168, 1, 21), 8009)
+	namesake.SetName("living-room")
+	namesake.SetInfo(map[string]string{"id": "uuid-2"})
+	manager.Add(namesake)
+
+	messages := observe(t, url)
+	bridge := New(mqtt.NewClientOptions().AddBroker(url).SetClientID("bridge"), manager, "cast/")
+	done := make(chan error)
+	go func() { done <- bridge.Run(ctx) }()
+
+	assert.Equal(t, "online", messages.next(t, "cast/bridge/state"))
+	assert.Equal(t, "online", messages.next(t, "cast/living-room/availability"))
+	var state DeviceState
+	assert.NoError(t, json.Unmarshal([]byte(messages.next(t, "cast/living-room/state")), &state))
+	assert.Equal(t, DeviceState{Name: "Living Room", UUID: "uuid-1", Host: "192.168.1.20"}, state)
+	assert.Equal(t, "online", messages.next(t, "cast/uuid-2/availability"))
+
+	manager.Events().Publish("uuid-1", "Living Room", events.MediaStatusUpdated{PlayerState: "PLAYING"})
+	// the state may be published again on connection before the update
+	for i := 0; i < 2 && state.PlayerState == ""; i++ {
+		assert.NoError(t, json.Unmarshal([]byte(messages.next(t, "cast/living-room/state")), &state))
+	}
+	assert.Equal(t, "PLAYING", state.PlayerState)
+
+	publisher := mqtt.NewClient(mqtt.NewClientOptions().AddBroker(url).SetClientID("publisher"))
+	assert.NoError(t, wait(publisher.Connect()))
+	defer publisher.Disconnect(0)
+	assert.NoError(t, wait(publisher.Publish("cast/living-room/command/volume", 1, false, "0.3")))
+	assert.Eventually(t, func() bool { return replay.Remaining() == 1 }, 5*time.Second, 20*time.Millisecond)
+
+	// commands to unknown devices are dropped without an error topic
+	assert.NoError(t, wait(publisher.Publish("cast/kitchen/command/play", 1, false, "")))
+	assert.NoError(t, wait(publisher.Publish("cast/bridge/command/play", 1, false, "")))
+	assert.NoError(t, wait(publisher.Publish("cast/uuid-1/command/volume", 1, false, "loud")))
+	assert.Equal(t, "volume: volume must be a number between 0 and 1", messages.next(t, "cast/living-room/error"))
+	messages.mu.Lock()
+	assert.NotContains(t, messages.topics, "cast/kitchen/error")
+	assert.NotContains(t, messages.topics, "cast/bridge/error")
+	messages.mu.Unlock()
+
+	// a dropped connection makes the device unavailable until it is back
+	manager.Events().Publish("uuid-2", "Living Room", events.Disconnected{Reason: errors.New("ping timeout")})
+	messages.await(t, "cast/uuid-2/availability", "offline")
+	manager.Events().Publish("uuid-2", "Living Room", events.Connected{})
+	messages.await(t, "cast/uuid-2/availability", "online")
+
+	cancel()
+	assert.NoError(t, <-done)
+	assert.Equal(t, "offline", messages.next(t, "cast/bridge/state"))
+}
+
+func TestTopicID(t *testing.T) {
+	assert.Equal(t, "living-room", topicID("Living Room", "uuid"))
+	assert.Equal(t, "kitchen-speaker-2", topicID("  Kitchen / Speaker #2 ", "uuid"))
+	assert.Equal(t, "uuid", topicID("", "uuid"))
+
+	bridge := &Bridge{topics: map[string]string{"uuid-1": "living-room"}}
+	assert.Equal(t, "uuid-2", bridge.uniqueTopicID("living-room", "uuid-2"))
+	bridge.topics["uuid-2"] = "uuid-2"
+	bridge.topics["other"] = "uuid-3"
+	assert.Equal(t, "uuid-3-2", bridge.uniqueTopicID("Living Room", "UUID-3"))
+}
@@ -1,13 +1,15 @@
 package net
 
 import (
-	"log"
+	"encoding/json"
+	"log/slog"
+	"sync"
 	"sync/atomic"
+	"time"
 
 	"golang.org/x/net/context"
 
 	"github.com/vkl/go-cast/api"
-	_ "github.com/vkl/go-cast/logger"
 )
 
 type Channel struct {
@@ -17,6 +19,7 @@ type Channel struct {
 	namespace     string
 	_             int32
 	requestId     int64
+	mu            sync.Mutex
 	inFlight      map[int]chan *api.CastMessage
 	listeners     []channelListener
 }
@@ -29,6 +32,7 @@ type channelListener struct {
 type Payload interface {
 	setRequestId(id int)
 	getRequestId() int
+	getType() string
 }
 
 func NewChannel(conn *Connection, sourceId, destinationId, namespace string) *Channel {
@@ -48,14 +52,17 @@ func (c *Channel) Message(message *api.CastMessage, headers *PayloadHeaders) {
 	}
 
 	if headers.Type == "" {
-		log.Printf("Warning: No message type. Don't know what to do. headers: %v message:%v", headers, message)
+		c.Logger().Warn("no message type, don't know what to do", "payload", message.GetPayloadUtf8())
 		return
 	}
 
 	if headers.RequestId != nil && *headers.RequestId != 0 {
-		if listener, ok := c.inFlight[*headers.RequestId]; ok {
+		c.mu.Lock()
+		listener, ok := c.inFlight[*headers.RequestId]
+		delete(c.inFlight, *headers.RequestId)
+		c.mu.Unlock()
+		if ok {
 			listener <- message
-			delete(c.inFlight, *headers.RequestId)
 		}
 	}
 
@@ -66,6 +73,20 @@ func (c *Channel) Message(message *api.CastMessage, headers *PayloadHeaders) {
 	}
 }
 
+// Metrics returns where the channel's controllers report measurements.
+func (c *Channel) Metrics() Metrics {
+	return c.conn.Metrics()
+}
+
+// Logger returns the connection's logger annotated with the channel's
+// namespace, source and destination.
+func (c *Channel) Logger() *slog.Logger {
+	return c.conn.Logger().With(
+		"namespace", c.namespace,
+		"source", c.sourceId,
+		"destination", c.DestinationId)
+}
+
 func (c *Channel) OnMessage(responseType string, cb func(*api.CastMessage)) {
 	c.listeners = append(c.listeners, channelListener{responseType, cb})
 }
@@ -75,23 +96,54 @@ func (c *Channel) Send(payload interface{}) error {
 }
 
 func (c *Channel) Request(ctx context.Context, payload Payload) (*api.CastMessage, error) {
+	start := time.Now()
+	reply, err := c.request(ctx, payload)
+	responseType := ""
+	if reply != nil {
+		var headers PayloadHeaders
+		if json.Unmarshal([]byte(reply.GetPayloadUtf8()), &headers) == nil {
+			responseType = headers.Type
+		}
+	}
+	c.Metrics().RequestDone(c.namespace, payload.getType(), responseType, time.Since(start), err)
+	return reply, err
+}
+
+func (c *Channel) request(ctx context.Context, payload Payload) (*api.CastMessage, error) {
 	requestId := int(atomic.AddInt64(&c.requestId, 1))
 
 	payload.setRequestId(requestId)
-	response := make(chan *api.CastMessage)
+	response := make(chan *api.CastMessage, 1)
+	c.mu.Lock()
 	c.inFlight[requestId] = response
+	c.mu.Unlock()
 
 	err := c.Send(payload)
 	if err != nil {
-		delete(c.inFlight, requestId)
+		c.forget(requestId)
 		return nil, err
 	}
 
 	select {
 	case reply := <-response:
 		return reply, nil
+	case <-c.conn.Done():
+		c.forget(requestId)
+		select {
+		case reply := <-response:
+			// the reply arrived just before the connection went away
+			return reply, nil
+		default:
+		}
+		return nil, c.conn.Err()
 	case <-ctx.Done():
-		delete(c.inFlight, requestId)
+		c.forget(requestId)
 		return nil, ctx.Err()
 	}
 }
+
+func (c *Channel) forget(requestId int) {
+	c.mu.Lock()
+	delete(c.inFlight, requestId)
+	c.mu.Unlock()
+}
@@ -1,119 +1,283 @@
 package net
 
 import (
+	"bytes"
 	"crypto/tls"
 	"encoding/binary"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"log/slog"
 	"net"
-	"log"
+	"sync"
+	"time"
 
 	"golang.org/x/net/context"
 
 	"github.com/gogo/protobuf/proto"
 	"github.com/vkl/go-cast/api"
-	_ "github.com/vkl/go-cast/logger"
+	"github.com/vkl/go-cast/logger"
 )
 
+const NamespaceConnection = "urn:x-cast:com.google.cast.tp.connection"
+
+// ErrConnectionClosed is reported once the connection has been shut down
+// by Close.
+var ErrConnectionClosed = errors.New("connection closed")
+
 type Connection struct {
-	conn     *tls.Conn
+	conn     net.Conn
 	channels []*Channel
+
+	mu      sync.Mutex
+	writeMu sync.Mutex
+	done    chan struct{}
+	err     error
+	tap     Tap
+	logger  *slog.Logger
+	metrics Metrics
+
+	tlsConfig   *tls.Config
+	dialTimeout time.Duration
 }
 
 func NewConnection() *Connection {
 	return &Connection{
 		conn:     nil,
 		channels: make([]*Channel, 0),
+		done:     make(chan struct{}),
+		logger:   logger.Discard(),
+		metrics:  nopMetrics{},
 	}
 }
 
+// SetLogger sets the logger used by the connection and its channels.
+func (c *Connection) SetLogger(logger *slog.Logger) {
+	c.mu.Lock()
+	c.logger = logger
+	c.mu.Unlock()
+}
+
+// SetMetrics sets where the connection, its channels and their controllers
+// report measurements. Passing nil removes it.
+func (c *Connection) SetMetrics(metrics Metrics) {
+	if metrics == nil {
+		metrics = nopMetrics{}
+	}
+	c.mu.Lock()
+	c.metrics = metrics
+	c.mu.Unlock()
+}
+
+func (c *Connection) Metrics() Metrics {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.metrics
+}
+
+// SetTLSConfig sets the TLS configuration used by Connect. By default
+// certificates are not verified, as cast devices present self-signed ones.
+func (c *Connection) SetTLSConfig(config *tls.Config) {
+	c.tlsConfig = config
+}
+
+// SetDialTimeout bounds how long Connect waits for the TCP connection.
+func (c *Connection) SetDialTimeout(timeout time.Duration) {
+	c.dialTimeout = timeout
+}
+
+func (c *Connection) Logger() *slog.Logger {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.logger
+}
+
+func logMessage(logger *slog.Logger, msg string, message *api.CastMessage) {
+	if !logger.Enabled(context.Background(), slog.LevelDebug) {
+		return
+	}
+	logger.Debug(msg,
+		"source", message.GetSourceId(),
+		"destination", message.GetDestinationId(),
+		"namespace", message.GetNamespace(),
+		"requestId", requestIdOf(message.GetPayloadUtf8()),
+		"payload", message.GetPayloadUtf8())
+}
+
 func (c *Connection) NewChannel(sourceId, destinationId, namespace string) *Channel {
 	channel := NewChannel(c, sourceId, destinationId, namespace)
+	c.mu.Lock()
 	c.channels = append(c.channels, channel)
+	c.mu.Unlock()
 	return channel
 }
 
+// GetTlsConnectionState returns the TLS state of the connection, or nil if
+// the transport is not TLS.
 func (c *Connection) GetTlsConnectionState() *tls.ConnectionState {
-	connState := c.conn.ConnectionState()
+	conn, ok := c.conn.(*tls.Conn)
+	if !ok {
+		return nil
+	}
+	connState := conn.ConnectionState()
 	return &connState
 }
 
+// SetTap installs a tap that observes every message sent and received.
+// Passing nil removes it.
+func (c *Connection) SetTap(tap Tap) {
+	c.mu.Lock()
+	c.tap = tap
+	c.mu.Unlock()
+}
+
+func (c *Connection) getTap() Tap {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.tap
+}
+
+// Done returns a channel that is closed when the connection terminates,
+// either because Close was called or because the socket failed.
+func (c *Connection) Done() <-chan struct{} {
+	return c.done
+}
+
+// Err returns the reason the connection terminated, or nil while it is
+// still open.
+func (c *Connection) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
+
+func (c *Connection) shutdown(err error) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		return false
+	}
+	c.err = err
+	close(c.done)
+	return true
+}
+
 func (c *Connection) Connect(ctx context.Context, host net.IP, port int) error {
-	var err error
 	deadline, _ := ctx.Deadline()
 	dialer := &net.Dialer{
 		Deadline: deadline,
+		Timeout:  c.dialTimeout,
 	}
-	log.Printf("connect %s:%d", host, port)
-	c.conn, err = tls.DialWithDialer(dialer, "tcp", fmt.Sprintf("%s:%d", host, port), &tls.Config{
-		InsecureSkipVerify: true,
-	})
+	config := c.tlsConfig
+	if config == nil {
+		config = &tls.Config{InsecureSkipVerify: true}
+	}
+	c.Logger().Info("connecting", "host", host, "port", port)
+	conn, err := tls.DialWithDialer(dialer, "tcp", fmt.Sprintf("%s:%d", host, port), config)
 	if err != nil {
-		return fmt.Errorf("failed to connect to Chromecast: %s", err)
+		return fmt.Errorf("failed to connect to Chromecast: %w", err)
 	}
 
+	return c.ConnectTransport(ctx, conn)
+}
+
+// ConnectTransport runs the connection over an already established
+// transport, such as a Replay of a recorded session.
+func (c *Connection) ConnectTransport(ctx context.Context, conn net.Conn) error {
+	c.conn = conn
+
 	go c.ReceiveLoop(ctx)
 
 	return nil
 }
 
+// ReceiveLoop reads messages from the socket and dispatches them to the
+// channels until the context is cancelled or the socket fails. Either
+// terminates the connection, with ErrConnectionClosed wrapping the context
+// error or with the underlying read error, failing pending requests.
 func (c *Connection) ReceiveLoop(ctx context.Context) {
-	for {
+	go func() {
 		select {
 		case <-ctx.Done():
-			log.Println("stop receive loop")
-			return
-		default:
-			var length uint32
-			err := binary.Read(c.conn, binary.BigEndian, &length)
-			if err != nil {
-				log.Printf("Failed to read packet length: %s", err)
-				break
-			}
-			if length == 0 {
-				log.Println("Empty packet received")
-				continue
+			c.Logger().Debug("stop receive loop")
+			if c.shutdown(fmt.Errorf("%w: %w", ErrConnectionClosed, ctx.Err())) {
+				c.conn.Close()
 			}
+		case <-c.done:
+		}
+	}()
 
-			packet := make([]byte, length)
-			i, err := io.ReadFull(c.conn, packet)
-			if err != nil {
-				log.Printf("Failed to read packet: %s", err)
-				break
-			}
+	for {
+		var length uint32
+		err := binary.Read(c.conn, binary.BigEndian, &length)
+		if err != nil {
+			c.Fail(fmt.Errorf("failed to read packet length: %w", err))
+			return
+		}
+		if length == 0 {
+			c.Logger().Debug("empty packet received")
+			continue
+		}
 
-			if i != int(length) {
-				log.Printf("Invalid packet size. Wanted: %d Read: %d", length, i)
-				break
-			}
+		packet := make([]byte, length)
+		_, err = io.ReadFull(c.conn, packet)
+		if err != nil {
+			c.Fail(fmt.Errorf("failed to read packet: %w", err))
+			return
+		}
 
-			message := &api.CastMessage{}
-			err = proto.Unmarshal(packet, message)
-			if err != nil {
-				log.Printf("Failed to unmarshal CastMessage: %s", err)
-				break
-			}
+		message := &api.CastMessage{}
+		err = proto.Unmarshal(packet, message)
+		if err != nil {
+			c.Logger().Warn("failed to unmarshal CastMessage", "error", err)
+			continue
+		}
 
-			log.Printf("%s ⇐ %s [%s]: %+v",
-				*message.DestinationId, *message.SourceId, *message.Namespace, *message.PayloadUtf8)
+		if tap := c.getTap(); tap != nil {
+			tap.Inbound(message)
+		}
 
-			var headers PayloadHeaders
-			err = json.Unmarshal([]byte(*message.PayloadUtf8), &headers)
+		logMessage(c.Logger(), "received", message)
+		c.Metrics().MessageReceived(message.GetNamespace())
 
-			if err != nil {
-				log.Printf("Failed to unmarshal message: %s", err)
-				break
-			}
+		var headers PayloadHeaders
+		err = json.Unmarshal([]byte(*message.PayloadUtf8), &headers)
 
-			for _, channel := range c.channels {
-				channel.Message(message, &headers)
-			}
+		if err != nil {
+			c.Logger().Warn("failed to unmarshal message", "error", err, "namespace", message.GetNamespace())
+			continue
 		}
+
+		c.mu.Lock()
+		channels := c.channels
+		c.mu.Unlock()
+		for _, channel := range channels {
+			channel.Message(message, &headers)
+		}
+	}
+}
+
+// Fail terminates the connection with err, as a socket failure does,
+// closing the socket without saying goodbye. Controllers use it when they
+// find the device gone, such as after missed heartbeats.
+func (c *Connection) Fail(err error) {
+	if c.shutdown(err) {
+		c.Logger().Warn("connection lost", "error", err)
+		c.conn.Close()
 	}
 }
 
 func (c *Connection) Send(payload interface{}, sourceId, destinationId, namespace string) error {
+	select {
+	case <-c.done:
+		return c.Err()
+	default:
+	}
+	return c.send(payload, sourceId, destinationId, namespace)
+}
+
+func (c *Connection) send(payload interface{}, sourceId, destinationId, namespace string) error {
 	payloadJson, err := json.Marshal(payload)
 	if err != nil {
 		return err
@@ -135,17 +299,67 @@ func (c *Connection) Send(payload interface{}, sourceId, destinationId, namespac
 		return err
 	}
 
-	log.Printf("%s ⇒ %s [%s]: %s", *message.SourceId, *message.DestinationId, *message.Namespace, *message.PayloadUtf8)
+	logMessage(c.Logger(), "sending", message)
 
-	err = binary.Write(c.conn, binary.BigEndian, uint32(len(data)))
-	if err != nil {
-		return err
+	// length prefix and body go out in a single write so that concurrent
+	// senders cannot interleave their packets
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.BigEndian, uint32(len(data)))
+	buf.Write(data)
+
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	_, err = c.conn.Write(buf.Bytes())
+	if err == nil {
+		c.Metrics().MessageSent(namespace)
+		if tap := c.getTap(); tap != nil {
+			tap.Outbound(message)
+		}
 	}
-	_, err = c.conn.Write(data)
 	return err
 }
 
+// Close shuts the connection down. If the socket is still healthy, every
+// virtual connection opened over it is sent a CLOSE and pending writes are
+// allowed to finish before the socket is closed.
 func (c *Connection) Close() error {
-	// TODO: graceful shutdown
+	if c.conn == nil {
+		c.shutdown(ErrConnectionClosed)
+		return nil
+	}
+
+	select {
+	case <-c.done:
+		// socket already failed, nothing to say goodbye over
+	default:
+		c.mu.Lock()
+		channels := c.channels
+		c.mu.Unlock()
+
+		closed := map[string]bool{}
+		for _, channel := range channels {
+			if channel.namespace != NamespaceConnection {
+				continue
+			}
+			key := channel.sourceId + "/" + channel.DestinationId
+			if closed[key] {
+				continue
+			}
+			closed[key] = true
+			err := c.send(PayloadHeaders{Type: "CLOSE"}, channel.sourceId, channel.DestinationId, NamespaceConnection)
+			if err != nil {
+				c.Logger().Warn("failed to close virtual connection",
+					"source", channel.sourceId, "destination", channel.DestinationId, "error", err)
+			}
+		}
+	}
+
+	// wait for in-flight writes to drain before closing the socket, unless
+	// it was already closed when the connection terminated
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if !c.shutdown(ErrConnectionClosed) {
+		return nil
+	}
 	return c.conn.Close()
 }
@@ -0,0 +1,144 @@
+package net
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+
+	"github.com/vkl/go-cast/api"
+)
+
+const namespaceReceiver = "urn:x-cast:com.google.cast.receiver"
+
+func out(namespace, payload string) Record {
+	return Record{Direction: DirectionOutbound, SourceId: "sender-0", DestinationId: "receiver-0", Namespace: namespace, Payload: payload}
+}
+
+func in(namespace, payload string) Record {
+	return Record{Direction: DirectionInbound, SourceId: "receiver-0", DestinationId: "sender-0", Namespace: namespace, Payload: payload}
+}
+
+// sentTap keeps the messages sent over a connection.
+type sentTap struct {
+	mu   sync.Mutex
+	sent []*api.CastMessage
+}
+
+func (s *sentTap) Inbound(*api.CastMessage) {}
+
+func (s *sentTap) Outbound(message *api.CastMessage) {
+	s.mu.Lock()
+	s.sent = append(s.sent, message)
+	s.mu.Unlock()
+}
+
+func (s *sentTap) Sent() []*api.CastMessage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.sent
+}
+
+// writeLog records every write made to the transport it wraps.
+type writeLog struct {
+	net.Conn
+	mu     sync.Mutex
+	writes [][]byte
+}
+
+func (w *writeLog) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	w.writes = append(w.writes, append([]byte(nil), p...))
+	w.mu.Unlock()
+	return w.Conn.Write(p)
+}
+
+func TestReceiveLoopEOF(t *testing.T) {
+	conn := NewConnection()
+	channel := conn.NewChannel("sender-0", "receiver-0", namespaceReceiver)
+	received := make(chan struct{})
+	channel.OnMessage("RECEIVER_STATUS", func(*api.CastMessage) { close(received) })
+	assert.NoError(t, conn.ConnectTransport(context.Background(), NewReplay([]Record{
+		in(namespaceReceiver, `{"type":"RECEIVER_STATUS","status":{}}`),
+	})))
+
+	<-received
+	<-conn.Done()
+	assert.True(t, errors.Is(conn.Err(), io.EOF), "unexpected error: %v", conn.Err())
+	assert.NoError(t, conn.Close())
+}
+
+func TestCloseSendsClose(t *testing.T) {
+	replay := NewReplay([]Record{out("urn:x-cast:test", ``)})
+	conn := NewConnection()
+	tap := &sentTap{}
+	conn.SetTap(tap)
+	assert.NoError(t, conn.ConnectTransport(context.Background(), replay))
+	conn.NewChannel("sender-0", "receiver-0", NamespaceConnection)
+	conn.NewChannel("sender-0", "receiver-0", NamespaceConnection)
+
+	assert.NoError(t, conn.Close())
+	<-conn.Done()
+	assert.Equal(t, ErrConnectionClosed, conn.Err())
+	sent := tap.Sent()
+	if assert.Len(t, sent, 1) {
+		assert.Equal(t, NamespaceConnection, sent[0].GetNamespace())
+		assert.JSONEq(t, `{"type":"CLOSE"}`, sent[0].GetPayloadUtf8())
+	}
+	assert.Error(t, conn.Send(PayloadHeaders{Type: "CONNECT"}, "sender-0", "receiver-0", NamespaceConnection))
+	assert.NoError(t, conn.Close())
+}
+
+func TestCancelFailsPendingRequest(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	conn := NewConnection()
+	assert.NoError(t, conn.ConnectTransport(ctx, NewReplay([]Record{
+		out(namespaceReceiver, `{"type":"GET_STATUS","requestId":1}`),
+		out("urn:x-cast:test", ``),
+	})))
+
+	channel := conn.NewChannel("sender-0", "receiver-0", namespaceReceiver)
+	done := make(chan error)
+	go func() {
+		_, err := channel.Request(context.Background(), &PayloadHeaders{Type: "GET_STATUS"})
+		done <- err
+	}()
+	cancel()
+
+	err := <-done
+	assert.True(t, errors.Is(err, ErrConnectionClosed), "unexpected error: %v", err)
+	assert.True(t, errors.Is(err, context.Canceled), "unexpected error: %v", err)
+	<-conn.Done()
+	assert.NoError(t, conn.Close())
+}
+
+func TestSendWritesWholePackets(t *testing.T) {
+	transport := &writeLog{Conn: NewReplay([]Record{out("urn:x-cast:test", ``)})}
+	conn := NewConnection()
+	assert.NoError(t, conn.ConnectTransport(context.Background(), transport))
+	defer conn.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, conn.Send(PayloadHeaders{Type: "PING"}, "sender-0", "receiver-0", "urn:x-cast:com.google.cast.tp.heartbeat"))
+		}()
+	}
+	wg.Wait()
+
+	transport.mu.Lock()
+	defer transport.mu.Unlock()
+	assert.Len(t, transport.writes, 20)
+	for _, write := range transport.writes {
+		if assert.True(t, len(write) > 4) {
+			assert.Equal(t, len(write)-4, int(binary.BigEndian.Uint32(write)))
+		}
+	}
+}
@@ -0,0 +1,25 @@
+package net
+
+import "time"
+
+// Metrics receives the measurements of a connection, its channels and the
+// controllers using them. Implementations must be safe for concurrent use.
+type Metrics interface {
+	MessageSent(namespace string)
+	MessageReceived(namespace string)
+	// RequestDone reports a request answered with responseType, or failed
+	// with err before a response arrived.
+	RequestDone(namespace, requestType, responseType string, duration time.Duration, err error)
+	HeartbeatRTT(rtt time.Duration)
+	Volume(level float64, muted bool)
+	PlayerState(state string)
+}
+
+type nopMetrics struct{}
+
+func (nopMetrics) MessageSent(string)                                       {}
+func (nopMetrics) MessageReceived(string)                                   {}
+func (nopMetrics) RequestDone(string, string, string, time.Duration, error) {}
+func (nopMetrics) HeartbeatRTT(time.Duration)                               {}
+func (nopMetrics) Volume(float64, bool)                                     {}
+func (nopMetrics) PlayerState(string)                                       {}
@@ -12,3 +12,7 @@ func (h *PayloadHeaders) setRequestId(id int) {
 func (h *PayloadHeaders) getRequestId() int {
 	return *h.RequestId
 }
+
+func (h *PayloadHeaders) getType() string {
+	return h.Type
+}
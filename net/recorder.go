@@ -0,0 +1,127 @@
+package net
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/vkl/go-cast/api"
+)
+
+// Tap observes the messages passing through a Connection.
+type Tap interface {
+	Inbound(message *api.CastMessage)
+	Outbound(message *api.CastMessage)
+}
+
+const (
+	DirectionInbound  = "in"
+	DirectionOutbound = "out"
+)
+
+// Record is a single recorded CastMessage, as stored one per line in a
+// JSON Lines session file.
+type Record struct {
+	Time          time.Time `json:"time"`
+	Direction     string    `json:"direction"`
+	SourceId      string    `json:"sourceId"`
+	DestinationId string    `json:"destinationId"`
+	Namespace     string    `json:"namespace"`
+	Payload       string    `json:"payload,omitempty"`
+	PayloadBinary []byte    `json:"payloadBinary,omitempty"`
+}
+
+func newRecord(direction string, message *api.CastMessage) Record {
+	return Record{
+		Time:          time.Now(),
+		Direction:     direction,
+		SourceId:      message.GetSourceId(),
+		DestinationId: message.GetDestinationId(),
+		Namespace:     message.GetNamespace(),
+		Payload:       message.GetPayloadUtf8(),
+		PayloadBinary: message.GetPayloadBinary(),
+	}
+}
+
+// Message converts the record back into a CastMessage.
+func (r *Record) Message() *api.CastMessage {
+	message := &api.CastMessage{
+		ProtocolVersion: api.CastMessage_CASTV2_1_0.Enum(),
+		SourceId:        &r.SourceId,
+		DestinationId:   &r.DestinationId,
+		Namespace:       &r.Namespace,
+	}
+	if r.PayloadBinary != nil {
+		message.PayloadType = api.CastMessage_BINARY.Enum()
+		message.PayloadBinary = r.PayloadBinary
+	} else {
+		message.PayloadType = api.CastMessage_STRING.Enum()
+		message.PayloadUtf8 = &r.Payload
+	}
+	return message
+}
+
+// Recorder is a Tap that writes every message to a JSON Lines stream.
+type Recorder struct {
+	mu      sync.Mutex
+	encoder *json.Encoder
+	closer  io.Closer
+}
+
+func NewRecorder(w io.Writer) *Recorder {
+	r := &Recorder{encoder: json.NewEncoder(w)}
+	if closer, ok := w.(io.Closer); ok {
+		r.closer = closer
+	}
+	return r
+}
+
+// CreateRecorder records to the named file, truncating it if it exists.
+func CreateRecorder(path string) (*Recorder, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	return NewRecorder(f), nil
+}
+
+func (r *Recorder) Inbound(message *api.CastMessage) {
+	r.write(newRecord(DirectionInbound, message))
+}
+
+func (r *Recorder) Outbound(message *api.CastMessage) {
+	r.write(newRecord(DirectionOutbound, message))
+}
+
+func (r *Recorder) write(record Record) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.encoder.Encode(record)
+}
+
+// Close closes the underlying writer if it is an io.Closer.
+func (r *Recorder) Close() error {
+	if r.closer == nil {
+		return nil
+	}
+	return r.closer.Close()
+}
+
+// ReadRecords reads a JSON Lines session as written by a Recorder.
+func ReadRecords(r io.Reader) ([]Record, error) {
+	records := make([]Record, 0)
+	decoder := json.NewDecoder(r)
+	for {
+		var record Record
+		err := decoder.Decode(&record)
+		if err == io.EOF {
+			return records, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+}
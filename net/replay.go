@@ -0,0 +1,188 @@
+package net
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/vkl/go-cast/api"
+)
+
+// Replay is a transport that plays a recorded session back to a
+// Connection, for reproducing device behaviour in tests.
+//
+// Inbound records are delivered in order. Whenever the next record is an
+// outbound one, the replay waits until the library sends a message on the
+// same namespace before continuing; messages on other namespaces are
+// accepted and ignored. Request ids in recorded replies are rewritten to
+// the ids used by the library for the matching requests.
+type Replay struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	records []Record
+	pos     int
+	pending bytes.Buffer
+	ids     map[string]int
+	closed  bool
+}
+
+func NewReplay(records []Record) *Replay {
+	r := &Replay{
+		records: records,
+		ids:     make(map[string]int),
+	}
+	r.cond = sync.NewCond(&r.mu)
+	return r
+}
+
+// OpenReplay loads a session file written by a Recorder.
+func OpenReplay(path string) (*Replay, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	records, err := ReadRecords(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read session %s: %s", path, err)
+	}
+	return NewReplay(records), nil
+}
+
+// Remaining returns the number of records not yet played back.
+func (r *Replay) Remaining() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.records) - r.pos
+}
+
+func (r *Replay) Read(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for {
+		if r.pending.Len() > 0 {
+			return r.pending.Read(p)
+		}
+		if r.closed || r.pos == len(r.records) {
+			return 0, io.EOF
+		}
+		if !r.release() {
+			r.cond.Wait()
+		}
+	}
+}
+
+// release frames the inbound records up to the next outbound one, and
+// reports whether anything was released.
+func (r *Replay) release() bool {
+	released := false
+	for r.pos < len(r.records) && r.records[r.pos].Direction == DirectionInbound {
+		record := r.records[r.pos]
+		r.pos++
+		if id := requestIdOf(record.Payload); id != 0 {
+			if actual, ok := r.ids[fmt.Sprintf("%s/%d", record.Namespace, id)]; ok {
+				record.Payload = withRequestId(record.Payload, actual)
+			}
+		}
+		data, err := proto.Marshal(record.Message())
+		if err != nil {
+			continue
+		}
+		binary.Write(&r.pending, binary.BigEndian, uint32(len(data)))
+		r.pending.Write(data)
+		released = true
+	}
+	return released
+}
+
+func (r *Replay) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return 0, io.ErrClosedPipe
+	}
+
+	buf := bytes.NewReader(p)
+	for buf.Len() > 0 {
+		var length uint32
+		if err := binary.Read(buf, binary.BigEndian, &length); err != nil {
+			return 0, err
+		}
+		packet := make([]byte, length)
+		if _, err := io.ReadFull(buf, packet); err != nil {
+			return 0, err
+		}
+		message := &api.CastMessage{}
+		if err := proto.Unmarshal(packet, message); err != nil {
+			return 0, err
+		}
+		r.match(message)
+	}
+	return len(p), nil
+}
+
+func (r *Replay) match(message *api.CastMessage) {
+	r.release()
+	if r.pos == len(r.records) {
+		return
+	}
+	record := r.records[r.pos]
+	if record.Direction != DirectionOutbound || record.Namespace != message.GetNamespace() {
+		return
+	}
+	r.pos++
+	recorded := requestIdOf(record.Payload)
+	actual := requestIdOf(message.GetPayloadUtf8())
+	if recorded != 0 && actual != 0 {
+		r.ids[fmt.Sprintf("%s/%d", record.Namespace, recorded)] = actual
+	}
+	r.cond.Broadcast()
+}
+
+func (r *Replay) Close() error {
+	r.mu.Lock()
+	r.closed = true
+	r.cond.Broadcast()
+	r.mu.Unlock()
+	return nil
+}
+
+func requestIdOf(payload string) int {
+	var headers PayloadHeaders
+	if err := json.Unmarshal([]byte(payload), &headers); err != nil || headers.RequestId == nil {
+		return 0
+	}
+	return *headers.RequestId
+}
+
+func withRequestId(payload string, id int) string {
+	var fields map[string]interface{}
+	if err := json.Unmarshal([]byte(payload), &fields); err != nil {
+		return payload
+	}
+	fields["requestId"] = id
+	data, err := json.Marshal(fields)
+	if err != nil {
+		return payload
+	}
+	return string(data)
+}
+
+type replayAddr struct{}
+
+func (replayAddr) Network() string { return "replay" }
+func (replayAddr) String() string  { return "replay" }
+
+func (r *Replay) LocalAddr() net.Addr                { return replayAddr{} }
+func (r *Replay) RemoteAddr() net.Addr               { return replayAddr{} }
+func (r *Replay) SetDeadline(t time.Time) error      { return nil }
+func (r *Replay) SetReadDeadline(t time.Time) error  { return nil }
+func (r *Replay) SetWriteDeadline(t time.Time) error { return nil }
@@ -0,0 +1,53 @@
+package net
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+)
+
+func TestReplayRewritesRequestIds(t *testing.T) {
+	replay, err := OpenReplay("testdata/receiver_status.jsonl")
+	assert.NoError(t, err)
+
+	var recording bytes.Buffer
+	conn := NewConnection()
+	conn.SetTap(NewRecorder(&recording))
+	assert.NoError(t, conn.ConnectTransport(context.Background(), replay))
+	defer conn.Close()
+
+	channel := conn.NewChannel("sender-0", "receiver-0", "urn:x-cast:com.google.cast.receiver")
+	reply, err := channel.Request(context.Background(), &PayloadHeaders{Type: "GET_STATUS"})
+	assert.NoError(t, err)
+
+	var headers PayloadHeaders
+	assert.NoError(t, json.Unmarshal([]byte(reply.GetPayloadUtf8()), &headers))
+	assert.Equal(t, "RECEIVER_STATUS", headers.Type)
+	assert.Equal(t, 1, *headers.RequestId)
+	assert.Equal(t, 0, replay.Remaining())
+
+	records, err := ReadRecords(&recording)
+	assert.NoError(t, err)
+	assert.Len(t, records, 2)
+	assert.Equal(t, DirectionOutbound, records[0].Direction)
+	assert.Equal(t, DirectionInbound, records[1].Direction)
+	assert.Equal(t, "receiver-0", records[1].SourceId)
+}
+
+func TestRequestFailsWhenConnectionDrops(t *testing.T) {
+	conn := NewConnection()
+	assert.NoError(t, conn.ConnectTransport(context.Background(), NewReplay(nil)))
+
+	channel := conn.NewChannel("sender-0", "receiver-0", "urn:x-cast:com.google.cast.receiver")
+	_, err := channel.Request(context.Background(), &PayloadHeaders{Type: "GET_STATUS"})
+	assert.True(t, errors.Is(err, io.EOF), "unexpected error: %v", err)
+
+	<-conn.Done()
+	assert.True(t, errors.Is(conn.Err(), io.EOF))
+	assert.NoError(t, conn.Close())
+}
@@ -0,0 +1,157 @@
+package cast
+
+import (
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/vkl/go-cast/controllers"
+	"github.com/vkl/go-cast/logger"
+	castnet "github.com/vkl/go-cast/net"
+)
+
+// ClientOptions holds the configuration of a Client.
+type ClientOptions struct {
+	// SenderID identifies this client to the device. It must be unique
+	// among the senders connected to a device.
+	SenderID string
+	// EventBuffer is the capacity of the Events channel.
+	EventBuffer int
+	Heartbeat   controllers.HeartbeatConfig
+	// TLSConfig is used to dial the device. Cast devices present
+	// self-signed certificates, so the default skips verification.
+	TLSConfig   *tls.Config
+	DialTimeout time.Duration
+	Logger      *slog.Logger
+	// Metrics receives the measurements of the connection. None are taken
+	// by default.
+	Metrics castnet.Metrics
+}
+
+// Option configures a Client created with NewClientWithOptions.
+type Option func(*ClientOptions)
+
+// DefaultOptions returns the default configuration, with a freshly
+// generated sender ID.
+func DefaultOptions() ClientOptions {
+	return ClientOptions{
+		SenderID:    NewSenderID(),
+		EventBuffer: 16,
+		Heartbeat:   controllers.DefaultHeartbeatConfig,
+		TLSConfig:   &tls.Config{InsecureSkipVerify: true},
+		DialTimeout: time.Second * 10,
+		Logger:      logger.Discard(),
+	}
+}
+
+// withDefaults returns the options with their zero fields set as in
+// DefaultOptions, so that a partly filled ClientOptions works.
+func (o ClientOptions) withDefaults() ClientOptions {
+	defaults := DefaultOptions()
+	if o.SenderID == "" {
+		o.SenderID = defaults.SenderID
+	}
+	if o.EventBuffer == 0 {
+		o.EventBuffer = defaults.EventBuffer
+	}
+	if o.Heartbeat == (controllers.HeartbeatConfig{}) {
+		o.Heartbeat = defaults.Heartbeat
+	} else {
+		o.Heartbeat = o.Heartbeat.WithDefaults()
+	}
+	if o.TLSConfig == nil {
+		o.TLSConfig = defaults.TLSConfig
+	}
+	if o.DialTimeout == 0 {
+		o.DialTimeout = defaults.DialTimeout
+	}
+	if o.Logger == nil {
+		o.Logger = defaults.Logger
+	}
+	return o
+}
+
+// Validate returns an error if an option has a value the client can't
+// use, such as a negative size or duration.
+func (o ClientOptions) Validate() error {
+	if o.EventBuffer < 0 {
+		return fmt.Errorf("invalid client options: negative event buffer %d", o.EventBuffer)
+	}
+	if o.DialTimeout < 0 {
+		return fmt.Errorf("invalid client options: negative dial timeout %s", o.DialTimeout)
+	}
+	return o.Heartbeat.Validate()
+}
+
+// eventBuffer returns the capacity of event channels, leaving them
+// unbuffered if EventBuffer is invalid, as Connect will refuse it.
+func (o ClientOptions) eventBuffer() int {
+	return max(o.EventBuffer, 0)
+}
+
+// NewSenderID returns a random sender ID, so that several clients on the
+// same host don't collide on DefaultSender.
+func NewSenderID() string {
+	b := make([]byte, 4)
+	if _, err := rand.Read(b); err != nil {
+		return DefaultSender
+	}
+	return "sender-" + hex.EncodeToString(b)
+}
+
+func WithSenderID(id string) Option {
+	return func(o *ClientOptions) {
+		o.SenderID = id
+	}
+}
+
+// WithEventBuffer sets the capacity of the Events channel and of the
+// subscriptions. A negative size fails Connect.
+func WithEventBuffer(size int) Option {
+	return func(o *ClientOptions) {
+		o.EventBuffer = size
+	}
+}
+
+// WithHeartbeat sets the heartbeat configuration, with unset fields taken
+// from controllers.DefaultHeartbeatConfig. Negative values fail Connect.
+func WithHeartbeat(config controllers.HeartbeatConfig) Option {
+	return func(o *ClientOptions) {
+		o.Heartbeat = config.WithDefaults()
+	}
+}
+
+func WithTLSConfig(config *tls.Config) Option {
+	return func(o *ClientOptions) {
+		o.TLSConfig = config
+	}
+}
+
+func WithDialTimeout(timeout time.Duration) Option {
+	return func(o *ClientOptions) {
+		o.DialTimeout = timeout
+	}
+}
+
+func WithLogger(logger *slog.Logger) Option {
+	return func(o *ClientOptions) {
+		o.Logger = logger
+	}
+}
+
+func WithMetrics(metrics castnet.Metrics) Option {
+	return func(o *ClientOptions) {
+		o.Metrics = metrics
+	}
+}
+
+// WithOptions replaces the whole configuration, for callers that build a
+// ClientOptions struct themselves. Fields left unset take their defaults.
+func WithOptions(options ClientOptions) Option {
+	return func(o *ClientOptions) {
+		*o = options
+	}
+}
@@ -0,0 +1,48 @@
+package cast
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+
+	"github.com/vkl/go-cast/controllers"
+)
+
+func TestNewClientWithOptions(t *testing.T) {
+	a := NewClient(net.IPv4(127, 0, 0, 1), 8009)
+	b := NewClient(net.IPv4(127, 0, 0, 1), 8009)
+	assert.NotEqual(t, a.SenderID(), b.SenderID())
+	assert.Equal(t, 16, cap(a.Events))
+
+	c := NewClientWithOptions(net.IPv4(127, 0, 0, 1), 8009,
+		WithSenderID(DefaultSender),
+		WithEventBuffer(64),
+		WithDialTimeout(time.Second))
+	assert.Equal(t, DefaultSender, c.SenderID())
+	assert.Equal(t, 64, cap(c.Events))
+	assert.Equal(t, time.Second, c.Options().DialTimeout)
+}
+
+func TestWithPartialOptions(t *testing.T) {
+	client := NewClientWithOptions(net.IPv4(127, 0, 0, 1), 8009, WithOptions(ClientOptions{DialTimeout: time.Second}))
+	options := client.Options()
+	assert.NotEmpty(t, options.SenderID)
+	assert.Equal(t, 16, cap(client.Events))
+	assert.Equal(t, time.Second, options.DialTimeout)
+	assert.Equal(t, controllers.DefaultHeartbeatConfig, options.Heartbeat)
+	assert.NotNil(t, options.TLSConfig)
+	assert.NotNil(t, options.Logger)
+}
+
+func TestInvalidOptions(t *testing.T) {
+	client := NewClientWithOptions(net.IPv4(127, 0, 0, 1), 8009, WithEventBuffer(-1))
+	assert.Equal(t, 0, cap(client.Events))
+	assert.EqualError(t, client.Connect(context.Background()), "invalid client options: negative event buffer -1")
+	assert.Equal(t, StateDisconnected, client.State())
+
+	client = NewClientWithOptions(net.IPv4(127, 0, 0, 1), 8009, WithHeartbeat(controllers.HeartbeatConfig{Interval: -time.Second}))
+	assert.Error(t, client.Connect(context.Background()))
+}
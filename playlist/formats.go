@@ -0,0 +1,144 @@
+package playlist
+
+import (
+	"encoding/xml"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// parseM3U reads plain and extended M3U. #EXTINF lines give the duration
+// in seconds and "Artist - Title" of the following entry.
+func parseM3U(data []byte) (*Playlist, error) {
+	playlist := &Playlist{Entries: make([]Entry, 0)}
+	var next Entry
+	for _, line := range lines(data) {
+		switch {
+		case line == "":
+			continue
+		case strings.HasPrefix(line, "#EXT-X-TARGETDURATION"), strings.HasPrefix(line, "#EXT-X-STREAM-INF"):
+			return nil, ErrHLSPlaylist
+		case strings.HasPrefix(line, "#PLAYLIST:"):
+			playlist.Title = strings.TrimSpace(strings.TrimPrefix(line, "#PLAYLIST:"))
+		case strings.HasPrefix(line, "#EXTINF:"):
+			info := strings.TrimPrefix(line, "#EXTINF:")
+			duration, title := info, ""
+			if i := strings.Index(info, ","); i >= 0 {
+				duration, title = info[:i], strings.TrimSpace(info[i+1:])
+			}
+			// attributes such as tvg-id="..." may follow the duration
+			if i := strings.IndexAny(duration, " \t"); i >= 0 {
+				duration = duration[:i]
+			}
+			next.Duration = seconds(duration)
+			next.Title = title
+			if parts := strings.SplitN(title, " - ", 2); len(parts) == 2 {
+				next.Artist, next.Title = strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+			}
+		case strings.HasPrefix(line, "#EXTIMG:"):
+			next.Image = strings.TrimSpace(strings.TrimPrefix(line, "#EXTIMG:"))
+		case strings.HasPrefix(line, "#"):
+			continue
+		default:
+			next.URL = line
+			playlist.Entries = append(playlist.Entries, next)
+			next = Entry{}
+		}
+	}
+	return playlist, nil
+}
+
+// parsePLS reads the INI-style PLS format.
+func parsePLS(data []byte) (*Playlist, error) {
+	playlist := &Playlist{Entries: make([]Entry, 0)}
+	entries := map[int]*Entry{}
+	order := make([]int, 0)
+	entry := func(n int) *Entry {
+		if e, ok := entries[n]; ok {
+			return e
+		}
+		e := &Entry{}
+		entries[n] = e
+		order = append(order, n)
+		return e
+	}
+
+	for _, line := range lines(data) {
+		i := strings.Index(line, "=")
+		if i < 0 || strings.HasPrefix(line, ";") {
+			continue
+		}
+		key, value := strings.ToLower(strings.TrimSpace(line[:i])), strings.TrimSpace(line[i+1:])
+		for _, field := range []string{"file", "title", "length"} {
+			if !strings.HasPrefix(key, field) {
+				continue
+			}
+			n, err := strconv.Atoi(key[len(field):])
+			if err != nil {
+				continue
+			}
+			switch field {
+			case "file":
+				entry(n).URL = value
+			case "title":
+				entry(n).Title = value
+			case "length":
+				entry(n).Duration = seconds(value)
+			}
+		}
+	}
+
+	sort.Ints(order)
+	for _, n := range order {
+		if entries[n].URL != "" {
+			playlist.Entries = append(playlist.Entries, *entries[n])
+		}
+	}
+	return playlist, nil
+}
+
+type xspfPlaylist struct {
+	Title  string      `xml:"title"`
+	Tracks []xspfTrack `xml:"trackList>track"`
+}
+
+type xspfTrack struct {
+	Locations []string `xml:"location"`
+	Title     string   `xml:"title"`
+	Creator   string   `xml:"creator"`
+	Image     string   `xml:"image"`
+	// Duration in milliseconds.
+	Duration int64 `xml:"duration"`
+}
+
+func parseXSPF(data []byte) (*Playlist, error) {
+	var doc xspfPlaylist
+	if err := xml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse XSPF: %s", err)
+	}
+	playlist := &Playlist{Title: strings.TrimSpace(doc.Title), Entries: make([]Entry, 0)}
+	for _, track := range doc.Tracks {
+		if len(track.Locations) == 0 {
+			continue
+		}
+		playlist.Entries = append(playlist.Entries, Entry{
+			URL:      track.Locations[0],
+			Title:    strings.TrimSpace(track.Title),
+			Artist:   strings.TrimSpace(track.Creator),
+			Image:    strings.TrimSpace(track.Image),
+			Duration: time.Duration(track.Duration) * time.Millisecond,
+		})
+	}
+	return playlist, nil
+}
+
+// seconds parses a duration in seconds; negative values mean unknown.
+func seconds(value string) time.Duration {
+	s, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if err != nil || s <= 0 {
+		return 0
+	}
+	return time.Duration(s * float64(time.Second))
+}
@@ -0,0 +1,119 @@
+package playlist
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+
+	"golang.org/x/net/context"
+
+	"github.com/vkl/go-cast/api"
+	"github.com/vkl/go-cast/controllers"
+)
+
+// MaxChunkSize bounds the JSON size of the items sent in one queue
+// message, leaving headroom below the receiver's 64 KiB message limit.
+const MaxChunkSize = 48 * 1024
+
+// Queue is the part of *controllers.MediaController used to load a
+// playlist.
+type Queue interface {
+	QueueLoad(ctx context.Context, items []controllers.MediaItemQueue, startIndex int, repeatMode string, customData interface{}) (*api.CastMessage, error)
+	QueueInsert(ctx context.Context, items []controllers.MediaItemQueue, currentTime int, autoplay bool, customData interface{}) (*api.CastMessage, error)
+}
+
+var _ Queue = (*controllers.MediaController)(nil)
+
+// QueueItems converts the entries into queue items. The content type of
+// each entry is worked out by probe; entries that cannot be played on the
+// device are reported as an error.
+func (p *Playlist) QueueItems(ctx context.Context, probe *controllers.ContentProbe) ([]controllers.MediaItemQueue, error) {
+	if probe == nil {
+		probe = &controllers.ContentProbe{}
+	}
+	items := make([]controllers.MediaItemQueue, 0, len(p.Entries))
+	for _, entry := range p.Entries {
+		u, err := url.Parse(entry.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			return nil, fmt.Errorf("%s is not an http(s) URL the device can fetch", entry.URL)
+		}
+		media, err := probe.Probe(ctx, entry.URL)
+		if err != nil {
+			return nil, err
+		}
+		if entry.Title != "" {
+			media.MetaData.Title = entry.Title
+		}
+		media.MetaData.Artist = entry.Artist
+		if entry.Image != "" {
+			media.MetaData.Images = []controllers.MediaImage{{Url: entry.Image}}
+		}
+		if entry.Duration > 0 {
+			media.Duration = entry.Duration.Seconds()
+		}
+		items = append(items, controllers.MediaItemQueue{
+			Media:    media,
+			Autoplay: true,
+		})
+	}
+	return items, nil
+}
+
+// Load replaces the device's queue with the playlist and starts playing
+// it. Large playlists are sent in several messages to stay within the
+// receiver's message size limit.
+func Load(ctx context.Context, queue Queue, playlist *Playlist, probe *controllers.ContentProbe) error {
+	items, err := playlist.QueueItems(ctx, probe)
+	if err != nil {
+		return err
+	}
+	return LoadItems(ctx, queue, items)
+}
+
+// LoadItems loads queue items, chunked to stay within the receiver's
+// message size limit.
+func LoadItems(ctx context.Context, queue Queue, items []controllers.MediaItemQueue) error {
+	if len(items) == 0 {
+		return fmt.Errorf("playlist is empty")
+	}
+	chunks, err := chunk(items, MaxChunkSize)
+	if err != nil {
+		return err
+	}
+	if _, err := queue.QueueLoad(ctx, chunks[0], 0, controllers.RepeatOff, map[string]interface{}{}); err != nil {
+		return err
+	}
+	for _, c := range chunks[1:] {
+		if _, err := queue.QueueInsert(ctx, c, 0, false, map[string]interface{}{}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// chunk splits items so that each chunk encodes to at most maxSize bytes.
+func chunk(items []controllers.MediaItemQueue, maxSize int) ([][]controllers.MediaItemQueue, error) {
+	chunks := make([][]controllers.MediaItemQueue, 0)
+	current := make([]controllers.MediaItemQueue, 0)
+	size := 0
+	for _, item := range items {
+		data, err := json.Marshal(item)
+		if err != nil {
+			return nil, err
+		}
+		if len(data) > maxSize {
+			return nil, fmt.Errorf("queue item %s is too large to send", item.Media.ContentId)
+		}
+		if size+len(data)+1 > maxSize && len(current) > 0 {
+			chunks = append(chunks, current)
+			current = make([]controllers.MediaItemQueue, 0)
+			size = 0
+		}
+		current = append(current, item)
+		size += len(data) + 1
+	}
+	if len(current) > 0 {
+		chunks = append(chunks, current)
+	}
+	return chunks, nil
+}
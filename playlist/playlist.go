@@ -0,0 +1,217 @@
+// Package playlist reads M3U, PLS and XSPF playlists and loads them onto
+// a cast device's media queue.
+package playlist
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// Format is a playlist file format.
+type Format int
+
+const (
+	FormatUnknown Format = iota
+	FormatM3U
+	FormatPLS
+	FormatXSPF
+)
+
+func (f Format) String() string {
+	switch f {
+	case FormatM3U:
+		return "m3u"
+	case FormatPLS:
+		return "pls"
+	case FormatXSPF:
+		return "xspf"
+	}
+	return "unknown"
+}
+
+// ErrHLSPlaylist is returned for an M3U8 file that is an HLS stream rather
+// than a list of tracks. Such files should be loaded directly as media.
+var ErrHLSPlaylist = errors.New("playlist is an HLS stream, load it as media instead")
+
+// Entry is a single track of a playlist.
+type Entry struct {
+	// URL of the track, resolved against the playlist location. It is an
+	// absolute file path for local playlists referring to local files.
+	URL    string
+	Title  string
+	Artist string
+	// Image is the URL of cover art, if the playlist has one.
+	Image string
+	// Duration is zero if unknown.
+	Duration time.Duration
+}
+
+type Playlist struct {
+	Title   string
+	Entries []Entry
+}
+
+// Parse reads a playlist in the given format, or detects the format from
+// the content if it is FormatUnknown. Relative entries are resolved
+// against base, which may be nil.
+func Parse(r io.Reader, format Format, base *url.URL) (*Playlist, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if format == FormatUnknown {
+		format = detectFormat(data)
+	}
+
+	var playlist *Playlist
+	switch format {
+	case FormatM3U:
+		playlist, err = parseM3U(data)
+	case FormatPLS:
+		playlist, err = parsePLS(data)
+	case FormatXSPF:
+		playlist, err = parseXSPF(data)
+	default:
+		return nil, fmt.Errorf("unknown playlist format")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range playlist.Entries {
+		playlist.Entries[i].URL = resolve(base, playlist.Entries[i].URL)
+		if playlist.Entries[i].Image != "" {
+			playlist.Entries[i].Image = resolve(base, playlist.Entries[i].Image)
+		}
+	}
+	return playlist, nil
+}
+
+// Open reads a playlist from a local path or an http(s) URL. client is
+// used for URLs and defaults to http.DefaultClient.
+func Open(ctx context.Context, location string, client *http.Client) (*Playlist, error) {
+	format := FormatByExtension(location)
+
+	u, err := url.Parse(location)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		f, err := os.Open(location)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+
+		abs, err := filepath.Abs(location)
+		if err != nil {
+			return nil, err
+		}
+		return Parse(f, format, &url.URL{Scheme: "file", Path: filepath.ToSlash(abs)})
+	}
+
+	if client == nil {
+		client = http.DefaultClient
+	}
+	req, err := http.NewRequest(http.MethodGet, location, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch playlist: %s", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch playlist: %s", resp.Status)
+	}
+	if format == FormatUnknown {
+		format = formatByContentType(resp.Header.Get("Content-Type"))
+	}
+	return Parse(resp.Body, format, u)
+}
+
+// FormatByExtension guesses the format from a file name or URL.
+func FormatByExtension(location string) Format {
+	if u, err := url.Parse(location); err == nil && u.Path != "" {
+		location = u.Path
+	}
+	switch strings.ToLower(path.Ext(location)) {
+	case ".m3u", ".m3u8":
+		return FormatM3U
+	case ".pls":
+		return FormatPLS
+	case ".xspf":
+		return FormatXSPF
+	}
+	return FormatUnknown
+}
+
+func formatByContentType(contentType string) Format {
+	contentType = strings.ToLower(contentType)
+	switch {
+	case strings.Contains(contentType, "mpegurl"):
+		return FormatM3U
+	case strings.Contains(contentType, "scpls"):
+		return FormatPLS
+	case strings.Contains(contentType, "xspf"):
+		return FormatXSPF
+	}
+	return FormatUnknown
+}
+
+func detectFormat(data []byte) Format {
+	head := bytes.TrimSpace(data)
+	head = bytes.TrimPrefix(head, []byte("\xef\xbb\xbf"))
+	switch {
+	case bytes.HasPrefix(bytes.ToLower(head), []byte("[playlist]")):
+		return FormatPLS
+	case bytes.HasPrefix(head, []byte("<")):
+		return FormatXSPF
+	}
+	return FormatM3U
+}
+
+func resolve(base *url.URL, location string) string {
+	location = strings.TrimSpace(location)
+	if base == nil {
+		return location
+	}
+	if base.Scheme == "file" {
+		if u, err := url.Parse(location); err == nil && u.Scheme != "" && len(u.Scheme) > 1 {
+			if u.Scheme == "file" {
+				return u.Path
+			}
+			return location
+		}
+		location = filepath.FromSlash(location)
+		if filepath.IsAbs(location) {
+			return location
+		}
+		return filepath.Join(filepath.Dir(filepath.FromSlash(base.Path)), location)
+	}
+	ref, err := url.Parse(location)
+	if err != nil {
+		return location
+	}
+	return base.ResolveReference(ref).String()
+}
+
+func lines(data []byte) []string {
+	result := make([]string, 0)
+	scanner := bufio.NewScanner(bytes.NewReader(bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		result = append(result, strings.TrimSpace(scanner.Text()))
+	}
+	return result
+}
@@ -0,0 +1,116 @@
+package playlist
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+
+	"github.com/vkl/go-cast/api"
+	"github.com/vkl/go-cast/controllers"
+)
+
+func TestParseM3U(t *testing.T) {
+	base, _ := url.Parse("http://music.local/lists/rock.m3u")
+	playlist, err := Parse(strings.NewReader(`#EXTM3U
+#PLAYLIST:Rock
+#EXTINF:215,Band - Song One
+../songs/one.mp3
+
+#EXTINF:-1,Radio
+http://radio.local/stream
+`), FormatUnknown, base)
+	assert.NoError(t, err)
+	assert.Equal(t, "Rock", playlist.Title)
+	assert.Equal(t, []Entry{
+		{URL: "http://music.local/songs/one.mp3", Title: "Song One", Artist: "Band", Duration: 215 * time.Second},
+		{URL: "http://radio.local/stream", Title: "Radio"},
+	}, playlist.Entries)
+
+	_, err = Parse(strings.NewReader("#EXTM3U\n#EXT-X-TARGETDURATION:10\nseg1.ts\n"), FormatM3U, nil)
+	assert.Equal(t, ErrHLSPlaylist, err)
+}
+
+func TestParsePLS(t *testing.T) {
+	playlist, err := Parse(strings.NewReader(`[playlist]
+File2=http://b.local/2.ogg
+Title2=Second
+File1=http://a.local/1.mp3
+Title1=First
+Length1=60
+NumberOfEntries=2
+Version=2
+`), FormatUnknown, nil)
+	assert.NoError(t, err)
+	assert.Len(t, playlist.Entries, 2)
+	assert.Equal(t, Entry{URL: "http://a.local/1.mp3", Title: "First", Duration: time.Minute}, playlist.Entries[0])
+	assert.Equal(t, "Second", playlist.Entries[1].Title)
+}
+
+func TestParseXSPF(t *testing.T) {
+	playlist, err := Parse(strings.NewReader(`<?xml version="1.0" encoding="UTF-8"?>
+<playlist version="1" xmlns="http://xspf.org/ns/0/">
+  <title>Mix</title>
+  <trackList>
+    <track>
+      <location>http://a.local/1.flac</location>
+      <title>Track</title>
+      <creator>Artist</creator>
+      <image>cover.jpg</image>
+      <duration>90500</duration>
+    </track>
+  </trackList>
+</playlist>`), FormatXSPF, &url.URL{Scheme: "http", Host: "a.local", Path: "/mix.xspf"})
+	assert.NoError(t, err)
+	assert.Equal(t, "Mix", playlist.Title)
+	assert.Equal(t, []Entry{{
+		URL:      "http://a.local/1.flac",
+		Title:    "Track",
+		Artist:   "Artist",
+		Image:    "http://a.local/cover.jpg",
+		Duration: 90500 * time.Millisecond,
+	}}, playlist.Entries)
+}
+
+type recordingQueue struct {
+	loads   [][]controllers.MediaItemQueue
+	inserts [][]controllers.MediaItemQueue
+}
+
+func (q *recordingQueue) QueueLoad(ctx context.Context, items []controllers.MediaItemQueue, startIndex int, repeatMode string, customData interface{}) (*api.CastMessage, error) {
+	q.loads = append(q.loads, items)
+	return nil, nil
+}
+
+func (q *recordingQueue) QueueInsert(ctx context.Context, items []controllers.MediaItemQueue, currentTime int, autoplay bool, customData interface{}) (*api.CastMessage, error) {
+	q.inserts = append(q.inserts, items)
+	return nil, nil
+}
+
+func TestLoadChunksLargePlaylists(t *testing.T) {
+	playlist := &Playlist{}
+	for i := 0; i < 1000; i++ {
+		playlist.Entries = append(playlist.Entries, Entry{
+			URL:   "http://music.local/" + strings.Repeat("x", 40) + ".mp3",
+			Title: strings.Repeat("title ", 10),
+		})
+	}
+
+	queue := &recordingQueue{}
+	assert.NoError(t, Load(context.Background(), queue, playlist, nil))
+	assert.Len(t, queue.loads, 1)
+	assert.NotEmpty(t, queue.inserts)
+
+	total := len(queue.loads[0])
+	for _, items := range queue.inserts {
+		total += len(items)
+	}
+	assert.Equal(t, 1000, total)
+	assert.Equal(t, "audio/mpeg", queue.loads[0][0].Media.ContentType)
+
+	_, err := (&Playlist{Entries: []Entry{{URL: "/home/me/song.mp3"}}}).QueueItems(context.Background(), nil)
+	assert.Error(t, err)
+}
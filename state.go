@@ -0,0 +1,65 @@
+package cast
+
+import "fmt"
+
+// State is the connection state of a Client.
+type State int
+
+const (
+	StateDisconnected State = iota
+	StateConnecting
+	StateConnected
+	StateAppLaunching
+	StateAppConnected
+	StateClosing
+)
+
+var stateNames = map[State]string{
+	StateDisconnected: "Disconnected",
+	StateConnecting:   "Connecting",
+	StateConnected:    "Connected",
+	StateAppLaunching: "AppLaunching",
+	StateAppConnected: "AppConnected",
+	StateClosing:      "Closing",
+}
+
+func (s State) String() string {
+	if name, ok := stateNames[s]; ok {
+		return name
+	}
+	return fmt.Sprintf("State(%d)", int(s))
+}
+
+// connected reports whether the client has a usable connection in state s.
+func (s State) connected() bool {
+	return s == StateConnected || s == StateAppLaunching || s == StateAppConnected
+}
+
+var transitions = map[State][]State{
+	StateDisconnected: {StateConnecting},
+	StateConnecting:   {StateConnected, StateClosing, StateDisconnected},
+	StateConnected:    {StateAppLaunching, StateAppConnected, StateClosing},
+	StateAppLaunching: {StateAppConnected, StateConnected, StateClosing},
+	StateAppConnected: {StateConnected, StateAppLaunching, StateClosing},
+	StateClosing:      {StateDisconnected},
+}
+
+func canTransition(from, to State) bool {
+	for _, s := range transitions[from] {
+		if s == to {
+			return true
+		}
+	}
+	return false
+}
+
+// StateError is returned when an operation is not valid in the current
+// state of the client.
+type StateError struct {
+	Op    string
+	State State
+}
+
+func (e *StateError) Error() string {
+	return fmt.Sprintf("cannot %s while %s", e.Op, e.State)
+}
@@ -0,0 +1,118 @@
+package cast
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+
+	"github.com/vkl/go-cast/events"
+	castnet "github.com/vkl/go-cast/net"
+)
+
+func TestClientStateTransitions(t *testing.T) {
+	client := NewClient(net.IPv4(127, 0, 0, 1), 8009)
+	assert.Equal(t, StateDisconnected, client.State())
+
+	var stateErr *StateError
+	_, err := client.Receiver()
+	assert.True(t, errors.As(err, &stateErr))
+	assert.Equal(t, StateDisconnected, stateErr.State)
+	_, err = client.Media(context.Background(), AppMedia)
+	assert.True(t, errors.As(err, &stateErr))
+	assert.NoError(t, client.Close())
+
+	// a session that never answers keeps the transport open until closed
+	replay := castnet.NewReplay([]castnet.Record{
+		{Direction: castnet.DirectionOutbound, Namespace: "urn:x-cast:test"},
+	})
+	assert.NoError(t, client.ConnectTransport(context.Background(), replay))
+	assert.Equal(t, StateConnected, client.State())
+	assert.True(t, client.IsConnected())
+
+	receiver, err := client.Receiver()
+	assert.NoError(t, err)
+	assert.NotNil(t, receiver)
+	_, err = client.YouTubeMdx()
+	assert.True(t, errors.As(err, &stateErr))
+
+	err = client.ConnectTransport(context.Background(), replay)
+	assert.True(t, errors.As(err, &stateErr))
+
+	assert.NoError(t, client.Close())
+	assert.Equal(t, StateDisconnected, client.State())
+	_, err = client.Receiver()
+	assert.Error(t, err)
+}
+
+func TestConcurrentClose(t *testing.T) {
+	client := NewClient(net.IPv4(127, 0, 0, 1), 8009)
+	replay := castnet.NewReplay([]castnet.Record{
+		{Direction: castnet.DirectionOutbound, Namespace: "urn:x-cast:test"},
+	})
+	assert.NoError(t, client.ConnectTransport(context.Background(), replay))
+
+	// Listen closes the client on Disconnected while callers close it too
+	client.Events <- events.Disconnected{Reason: errors.New("ping timeout")}
+	start := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			assert.NoError(t, client.Close())
+		}()
+	}
+	close(start)
+	wg.Wait()
+	assert.Eventually(t, func() bool {
+		return client.State() == StateDisconnected
+	}, time.Second, time.Millisecond*10)
+}
+
+func TestCloseSaysGoodbye(t *testing.T) {
+	client := NewClient(net.IPv4(127, 0, 0, 1), 8009)
+	var recording bytes.Buffer
+	client.SetTap(castnet.NewRecorder(&recording))
+	replay := castnet.NewReplay([]castnet.Record{
+		{Direction: castnet.DirectionOutbound, Namespace: "urn:x-cast:test"},
+	})
+	assert.NoError(t, client.ConnectTransport(context.Background(), replay))
+	assert.NoError(t, client.Close())
+
+	records, err := castnet.ReadRecords(&recording)
+	assert.NoError(t, err)
+	closed := false
+	for _, record := range records {
+		if record.Namespace == castnet.NamespaceConnection && strings.Contains(record.Payload, `"CLOSE"`) {
+			closed = true
+		}
+	}
+	assert.True(t, closed, "no CLOSE sent")
+}
+
+func TestWatchConnection(t *testing.T) {
+	client := NewClient(net.IPv4(127, 0, 0, 1), 8009)
+	client.Events = make(chan events.Event)
+
+	// ended by its context, which is a close rather than a loss
+	ctx, cancel := context.WithCancel(context.Background())
+	conn := castnet.NewConnection()
+	assert.NoError(t, conn.ConnectTransport(ctx, castnet.NewReplay([]castnet.Record{
+		{Direction: castnet.DirectionOutbound, Namespace: "urn:x-cast:test"},
+	})))
+	cancel()
+	client.watchConnection(context.Background(), conn)
+
+	// lost once nobody listens any more
+	conn = castnet.NewConnection()
+	assert.NoError(t, conn.ConnectTransport(context.Background(), castnet.NewReplay(nil)))
+	client.watchConnection(ctx, conn)
+}
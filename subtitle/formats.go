@@ -0,0 +1,137 @@
+package subtitle
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// parseBlocks reads SRT and WebVTT cues: blocks separated by blank lines,
+// with a timing line followed by the text. Blocks without a timing line,
+// such as the WebVTT header, notes and styles, are skipped.
+func parseBlocks(text string) ([]Cue, error) {
+	cues := []Cue{}
+	for _, block := range strings.Split(text, "\n\n") {
+		lines := strings.Split(strings.Trim(block, "\n"), "\n")
+		for i, line := range lines {
+			if !strings.Contains(line, "-->") {
+				continue
+			}
+			times := strings.SplitN(line, "-->", 2)
+			start, err := parseTimestamp(times[0])
+			if err != nil {
+				return nil, err
+			}
+			// WebVTT cue settings follow the end time
+			endTime := ""
+			if fields := strings.Fields(times[1]); len(fields) > 0 {
+				endTime = fields[0]
+			}
+			end, err := parseTimestamp(endTime)
+			if err != nil {
+				return nil, err
+			}
+			cues = append(cues, Cue{
+				Start: start,
+				End:   end,
+				Text:  cleanText(strings.Join(lines[i+1:], "\n")),
+			})
+			break
+		}
+	}
+	return cues, nil
+}
+
+// parseTimestamp reads [hh:]mm:ss,mmm or [hh:]mm:ss.mmm.
+func parseTimestamp(s string) (time.Duration, error) {
+	s = strings.Replace(strings.TrimSpace(s), ",", ".", 1)
+	parts := strings.Split(s, ":")
+	if len(parts) < 2 || len(parts) > 3 {
+		return 0, fmt.Errorf("invalid timestamp %q", s)
+	}
+	var d time.Duration
+	for _, part := range parts[:len(parts)-1] {
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			return 0, fmt.Errorf("invalid timestamp %q", s)
+		}
+		d = d*60 + time.Duration(n)
+	}
+	seconds, err := strconv.ParseFloat(parts[len(parts)-1], 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid timestamp %q", s)
+	}
+	return d*time.Minute + time.Duration(seconds*1000+0.5)*time.Millisecond, nil
+}
+
+var (
+	overrideTags = regexp.MustCompile(`\{\\[^}]*\}`)
+	fontTags     = regexp.MustCompile(`(?i)</?font[^>]*>`)
+)
+
+// cleanText drops styling WebVTT doesn't support, keeping <i>, <b> and
+// <u>.
+func cleanText(text string) string {
+	text = overrideTags.ReplaceAllString(text, "")
+	return fontTags.ReplaceAllString(text, "")
+}
+
+// parseASS reads the dialogue lines of the [Events] section of an SSA or
+// ASS script, using its Format line to find the fields.
+func parseASS(text string) ([]Cue, error) {
+	cues := []Cue{}
+	inEvents := false
+	fields := map[string]int{}
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "[") {
+			inEvents = strings.EqualFold(line, "[Events]")
+			continue
+		}
+		if !inEvents {
+			continue
+		}
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "Format":
+			for i, name := range strings.Split(value, ",") {
+				fields[strings.TrimSpace(name)] = i
+			}
+		case "Dialogue":
+			start, end, textField := fields["Start"], fields["End"], fields["Text"]
+			if len(fields) == 0 || textField != len(fields)-1 {
+				return nil, fmt.Errorf("missing or invalid Format line in [Events]")
+			}
+			values := strings.SplitN(value, ",", len(fields))
+			if len(values) != len(fields) {
+				return nil, fmt.Errorf("invalid dialogue line %q", line)
+			}
+			startTime, err := parseTimestamp(values[start])
+			if err != nil {
+				return nil, err
+			}
+			endTime, err := parseTimestamp(values[end])
+			if err != nil {
+				return nil, err
+			}
+			cues = append(cues, Cue{
+				Start: startTime,
+				End:   endTime,
+				Text:  assText(values[textField]),
+			})
+		}
+	}
+	return cues, nil
+}
+
+var assLineBreaks = strings.NewReplacer(`\N`, "\n", `\n`, "\n", `\h`, " ")
+
+func assText(text string) string {
+	text = overrideTags.ReplaceAllString(text, "")
+	return assLineBreaks.Replace(text)
+}
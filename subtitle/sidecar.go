@@ -0,0 +1,75 @@
+package subtitle
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Sidecar is a subtitle file next to a video, named after it, such as
+// movie.srt or movie.en.forced.ass for movie.mp4.
+type Sidecar struct {
+	Path   string
+	Format Format
+	// Language is the language tag found in the file name, if any.
+	Language string
+	// Name describes the track, from the tags in the file name.
+	Name string
+}
+
+var languageTag = regexp.MustCompile(`^[a-z]{2,3}(-[A-Za-z]{2,4})?$`)
+
+// FindSidecars returns the subtitle files next to the video at path,
+// sorted by file name.
+func FindSidecars(videoPath string) ([]Sidecar, error) {
+	dir := filepath.Dir(videoPath)
+	base := strings.TrimSuffix(filepath.Base(videoPath), filepath.Ext(videoPath))
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	sidecars := []Sidecar{}
+	for _, entry := range entries {
+		name := entry.Name()
+		format, ok := FormatOf(name)
+		if entry.IsDir() || !ok {
+			continue
+		}
+		tags, ok := sidecarTags(strings.TrimSuffix(name, filepath.Ext(name)), base)
+		if !ok {
+			continue
+		}
+		sidecar := Sidecar{Path: filepath.Join(dir, name), Format: format}
+		for _, tag := range tags {
+			if sidecar.Language == "" && languageTag.MatchString(tag) {
+				sidecar.Language = tag
+			}
+		}
+		sidecar.Name = strings.Join(tags, " ")
+		if sidecar.Name == "" {
+			sidecar.Name = "Subtitles"
+		}
+		sidecars = append(sidecars, sidecar)
+	}
+	sort.Slice(sidecars, func(i, j int) bool { return sidecars[i].Path < sidecars[j].Path })
+	return sidecars, nil
+}
+
+// sidecarTags returns the dotted tags that follow the video name base in
+// the stem of a subtitle file name, matching base regardless of case.
+// The stem is cut at its own dots, as case folding can change the length
+// of a name.
+func sidecarTags(stem, base string) ([]string, bool) {
+	if strings.EqualFold(stem, base) {
+		return nil, true
+	}
+	for i := range stem {
+		if stem[i] == '.' && strings.EqualFold(stem[:i], base) {
+			return strings.Split(stem[i+1:], "."), true
+		}
+	}
+	return nil, false
+}
@@ -0,0 +1,147 @@
+// Package subtitle converts SRT, SSA/ASS and WebVTT subtitles to WebVTT,
+// the only text track format cast receivers accept.
+package subtitle
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+type Format string
+
+const (
+	FormatSRT Format = "srt"
+	FormatASS Format = "ass"
+	FormatVTT Format = "vtt"
+)
+
+// ContentTypeVTT is the content type of WebVTT text tracks.
+const ContentTypeVTT = "text/vtt"
+
+var formatsByExtension = map[string]Format{
+	".srt": FormatSRT,
+	".ass": FormatASS,
+	".ssa": FormatASS,
+	".vtt": FormatVTT,
+}
+
+// FormatOf returns the subtitle format of a file from its extension.
+func FormatOf(path string) (Format, bool) {
+	format, ok := formatsByExtension[strings.ToLower(filepath.Ext(path))]
+	return format, ok
+}
+
+// Cue is a piece of text shown between Start and End.
+type Cue struct {
+	Start time.Duration
+	End   time.Duration
+	Text  string
+}
+
+// Parse reads subtitles in format.
+func Parse(r io.Reader, format Format) ([]Cue, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	text := strings.TrimPrefix(string(data), "\uFEFF")
+	text = strings.Replace(text, "\r\n", "\n", -1)
+
+	var cues []Cue
+	switch format {
+	case FormatSRT, FormatVTT:
+		cues, err = parseBlocks(text)
+	case FormatASS:
+		cues, err = parseASS(text)
+	default:
+		return nil, fmt.Errorf("unknown subtitle format %q", format)
+	}
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(cues, func(i, j int) bool { return cues[i].Start < cues[j].Start })
+	return cues, nil
+}
+
+// Shift moves the cues by offset, negative to show them earlier. Cues that
+// would end before the start are dropped.
+func Shift(cues []Cue, offset time.Duration) []Cue {
+	shifted := make([]Cue, 0, len(cues))
+	for _, cue := range cues {
+		cue.Start += offset
+		cue.End += offset
+		if cue.End <= 0 {
+			continue
+		}
+		if cue.Start < 0 {
+			cue.Start = 0
+		}
+		shifted = append(shifted, cue)
+	}
+	return shifted
+}
+
+// WriteVTT writes the cues as a WebVTT file.
+func WriteVTT(w io.Writer, cues []Cue) error {
+	buf := &bytes.Buffer{}
+	buf.WriteString("WEBVTT\n")
+	for _, cue := range cues {
+		fmt.Fprintf(buf, "\n%s --> %s\n%s\n", timestamp(cue.Start), timestamp(cue.End), vttText(cue.Text))
+	}
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// Convert reads subtitles in format and writes them as WebVTT, shifted by
+// offset.
+func Convert(w io.Writer, r io.Reader, format Format, offset time.Duration) error {
+	cues, err := Parse(r, format)
+	if err != nil {
+		return err
+	}
+	return WriteVTT(w, Shift(cues, offset))
+}
+
+// ConvertFile converts the subtitle file at path to WebVTT.
+func ConvertFile(path string, offset time.Duration) ([]byte, error) {
+	format, ok := FormatOf(path)
+	if !ok {
+		return nil, fmt.Errorf("%s is not a subtitle file", path)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	buf := &bytes.Buffer{}
+	if err := Convert(buf, f, format, offset); err != nil {
+		return nil, fmt.Errorf("failed to convert %s: %w", path, err)
+	}
+	return buf.Bytes(), nil
+}
+
+func timestamp(d time.Duration) string {
+	ms := d.Milliseconds()
+	return fmt.Sprintf("%02d:%02d:%02d.%03d", ms/3600000, ms/60000%60, ms/1000%60, ms%1000)
+}
+
+// vttText keeps the text from ending the cue early: blank lines end a cue
+// and an arrow starts a new timing line.
+func vttText(text string) string {
+	lines := []string{}
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		lines = append(lines, strings.Replace(line, "-->", "->", -1))
+	}
+	return strings.Join(lines, "\n")
+}
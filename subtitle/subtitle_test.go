@@ -0,0 +1,98 @@
+package subtitle
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const srt = "\uFEFF1\r\n00:00:01,000 --> 00:00:02,500\r\n<font color=\"#ffffff\">Hello</font>\r\n\r\n" +
+	"2\r\n00:00:03,000 --> 00:00:05,000\r\n{\\an8}<i>Two</i>\r\nlines\r\n"
+
+func TestConvertSRT(t *testing.T) {
+	buf := &bytes.Buffer{}
+	assert.NoError(t, Convert(buf, strings.NewReader(srt), FormatSRT, 0))
+	assert.Equal(t, "WEBVTT\n\n00:00:01.000 --> 00:00:02.500\nHello\n\n"+
+		"00:00:03.000 --> 00:00:05.000\n<i>Two</i>\nlines\n", buf.String())
+}
+
+func TestConvertOffset(t *testing.T) {
+	buf := &bytes.Buffer{}
+	assert.NoError(t, Convert(buf, strings.NewReader(srt), FormatSRT, -3*time.Second))
+	// the first cue ends before the start and is dropped
+	assert.Equal(t, "WEBVTT\n\n00:00:00.000 --> 00:00:02.000\n<i>Two</i>\nlines\n", buf.String())
+
+	cues := Shift([]Cue{{Start: time.Second, End: 3 * time.Second}}, -2*time.Second)
+	assert.Equal(t, []Cue{{Start: 0, End: time.Second}}, cues)
+}
+
+func TestParseASS(t *testing.T) {
+	script := `[Script Info]
+Title: test
+
+[V4+ Styles]
+Format: Name, Fontname
+Style: Default,Arial
+
+[Events]
+Format: Layer, Start, End, Style, Name, MarginL, MarginR, MarginV, Effect, Text
+Dialogue: 0,0:00:04.50,0:00:06.00,Default,,0,0,0,,Second, with comma
+Comment: 0,0:00:00.00,0:00:01.00,Default,,0,0,0,,ignored
+Dialogue: 0,0:00:01.00,0:00:02.25,Default,,0,0,0,,{\i1}First{\i0}\Nline\hend
+`
+	cues, err := Parse(strings.NewReader(script), FormatASS)
+	assert.NoError(t, err)
+	assert.Equal(t, []Cue{
+		{Start: time.Second, End: 2250 * time.Millisecond, Text: "First\nline end"},
+		{Start: 4500 * time.Millisecond, End: 6 * time.Second, Text: "Second, with comma"},
+	}, cues)
+
+	_, err = Parse(strings.NewReader("[Events]\nDialogue: 0,0:00:01.00,0:00:02.00,x"), FormatASS)
+	assert.Error(t, err)
+}
+
+func TestParseVTT(t *testing.T) {
+	vtt := "WEBVTT\n\nNOTE a comment\n\nintro\n01:02.500 --> 01:04.000 align:start\nHi\n"
+	cues, err := Parse(strings.NewReader(vtt), FormatVTT)
+	assert.NoError(t, err)
+	assert.Equal(t, []Cue{{Start: 62500 * time.Millisecond, End: 64 * time.Second, Text: "Hi"}}, cues)
+
+	_, err = Parse(strings.NewReader("1\nxx:00:01,000 --> 00:00:02,000\nHi"), FormatSRT)
+	assert.Error(t, err)
+	_, err = Parse(strings.NewReader("1\n00:00:01,000 -->\nHi"), FormatSRT)
+	assert.ErrorContains(t, err, "invalid timestamp")
+}
+
+func TestFindSidecars(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"movie.mp4", "movie.srt", "movie.en.srt", "Movie.fr-CA.forced.ass",
+		"movie2.srt", "other.srt", "movie.txt"} {
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, name), nil, 0644))
+	}
+	sidecars, err := FindSidecars(filepath.Join(dir, "movie.mp4"))
+	assert.NoError(t, err)
+	assert.Equal(t, []Sidecar{
+		{Path: filepath.Join(dir, "Movie.fr-CA.forced.ass"), Format: FormatASS, Language: "fr-CA", Name: "fr-CA forced"},
+		{Path: filepath.Join(dir, "movie.en.srt"), Format: FormatSRT, Language: "en", Name: "en"},
+		{Path: filepath.Join(dir, "movie.srt"), Format: FormatSRT, Name: "Subtitles"},
+	}, sidecars)
+}
+
+func TestFindSidecarsCaseFolding(t *testing.T) {
+	// The Kelvin sign folds to k but is three bytes long.
+	dir := t.TempDir()
+	for _, name := range []string{"\u212Aelvin.mp4", "kelvin.srt", "kelvin.en.srt", "kelvi.srt"} {
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, name), nil, 0644))
+	}
+	sidecars, err := FindSidecars(filepath.Join(dir, "\u212Aelvin.mp4"))
+	assert.NoError(t, err)
+	assert.Equal(t, []Sidecar{
+		{Path: filepath.Join(dir, "kelvin.en.srt"), Format: FormatSRT, Language: "en", Name: "en"},
+		{Path: filepath.Join(dir, "kelvin.srt"), Format: FormatSRT, Name: "Subtitles"},
+	}, sidecars)
+}